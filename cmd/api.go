@@ -1,131 +1,287 @@
-package main
-
-import (
-	"time"
-
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
-	auth "github.com/myproject/shop/internal/Auth"
-	cart "github.com/myproject/shop/internal/Cart"
-	comment "github.com/myproject/shop/internal/Comment"
-	Coordinator "github.com/myproject/shop/internal/Coordinator"
-	"github.com/myproject/shop/internal/Order"
-	shop "github.com/myproject/shop/internal/Shop"
-	user "github.com/myproject/shop/internal/User"
-	config "github.com/myproject/shop/internal/config"
-	search "github.com/myproject/shop/internal/search"
-	"github.com/myproject/shop/pkg/logger"
-	"github.com/myproject/shop/pkg/middleware"
-)
-
-type Application struct {
-	*gin.Engine
-	config *config.Config
-}
-
-func NewApplication(cfg *config.Config,
-	userH *user.UserHandle,
-	authH *auth.AuthHandler,
-	orderH *Order.OrderHandler,
-	shopH *shop.ShopHandler,
-	searchH *search.Handler,
-	commentH *comment.CommentHandler,
-	cartH *cart.CartHandler,
-	coordinatorH *Coordinator.TradeHandler) *Application {
-	gin.SetMode(cfg.Server.Mode)
-	app := &Application{
-		Engine: gin.New(),
-		config: cfg,
-	}
-	app.Use(gin.Recovery())
-	app.Use(logger.GinLogger())
-	app.Use(cors.New(cors.Config{
-		AllowAllOrigins:  true,
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-	middleware.InitJWT(app.config.JWT.Secret)
-	v0 := app.Group("/api/v0")
-	{
-		// User routes
-		v0.POST("/users", userH.RegisterUser)
-		v0.GET("/users/:id", userH.GetUserByID)
-		v0.PATCH("/users/:id", userH.UpdateUser)
-		v0.DELETE("/users/:id", userH.DeleteUser)
-		// v0.GET("/users/:username", userHandler.GetUserByName)
-		// Auth routes
-		v0.POST("/auth/login", authH.Login)
-		v0.POST("/auth/refresh", authH.Refresh)
-		v0.POST("/auth/logout", middleware.JWTAuthMiddleware(), authH.Logout)
-	}
-
-	v1 := app.Group("/api/v1")
-	v1.Use(middleware.JWTAuthMiddleware())
-	{
-		v1.GET("/orders", orderH.ListOrders)
-		v1.GET("/orders/:id", coordinatorH.CreateOrder)
-		v1.POST("/orders", orderH.CreateOrder)
-		v1.PATCH("/orders/:id/status", orderH.UpdateOrderStatus)
-		v1.DELETE("/orders/:id", orderH.DeleteOrder)
-
-		// Cart routes
-		v1.GET("/cart", cartH.List)
-		v1.POST("/cart/items", cartH.Add)
-		v1.PATCH("/cart/items/:id", cartH.Update)
-		v1.DELETE("/cart/items/:id", cartH.Delete)
-		v1.DELETE("/cart", cartH.Clear)
-	}
-
-	v2 := app.Group("/api/v2")
-	v2.Use(middleware.JWTAuthMiddleware())
-
-	// Customer-facing (authenticated) routes
-	v2Customer := v2.Group("")
-	{
-		// Search routes
-		v2Customer.GET("/search/products", searchH.SearchProducts)
-		v2Customer.GET("/search/orders", searchH.SearchOrders)
-
-		// Shop/product discovery
-		v2Customer.GET("/shops", shopH.ListShops)
-		v2Customer.GET("/shops/:id/products", shopH.ListProducts)
-		v2Customer.GET("/shops/:id/products/search", shopH.GetProductByName)
-		v2Customer.GET("/products/:id", shopH.GetProductByCode)
-		v2Customer.GET("/shops/:id", shopH.GetShop)
-	}
-
-	// Merchant/admin routes (require role check) – paths unchanged
-	v2Merchant := v2.Group("")
-	v2Merchant.Use(middleware.MerchantAuthMiddleware())
-	{
-		// Shop & product management
-		v2Merchant.POST("/shops", shopH.CreateShop)
-		v2Merchant.POST("/shops/:id/products", shopH.CreateProduct)
-		v2Merchant.PATCH("/products/:id", shopH.UpdateProduct)
-		v2Merchant.DELETE("/products/:id", shopH.DeleteProduct)
-		v2Merchant.DELETE("/products", shopH.BatchDeleteProducts)
-		v2Merchant.PATCH("/shops/:id", shopH.UpdateShop)
-		v2Merchant.DELETE("/shops/:id", shopH.DeleteShop)
-		v2Merchant.DELETE("/shops", shopH.BatchDeleteShops)
-	}
-
-	v3 := app.Group("api/v3")
-	{
-		v3.GET("/shops/:id/comments", commentH.ListCommentsByShop)
-		v3.POST("/shops/:id/comments", middleware.JWTAuthMiddleware(), commentH.CreateComment)
-		v3.DELETE("/shops/:id/comments", commentH.DeleteComments)
-	}
-
-	return app
-}
-
-func (app *Application) run() error {
-	err := app.Run(app.config.Server.RunAddr)
-	if err != nil {
-		return err
-	}
-	return nil
-}
+package main
+
+import (
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	audit "github.com/myproject/shop/internal/Audit"
+	auth "github.com/myproject/shop/internal/Auth"
+	cart "github.com/myproject/shop/internal/Cart"
+	comment "github.com/myproject/shop/internal/Comment"
+	Coordinator "github.com/myproject/shop/internal/Coordinator"
+	merchant "github.com/myproject/shop/internal/Merchant"
+	notification "github.com/myproject/shop/internal/Notification"
+	"github.com/myproject/shop/internal/Order"
+	privacy "github.com/myproject/shop/internal/Privacy"
+	rbac "github.com/myproject/shop/internal/Rbac"
+	shop "github.com/myproject/shop/internal/Shop"
+	user "github.com/myproject/shop/internal/User"
+	config "github.com/myproject/shop/internal/config"
+	search "github.com/myproject/shop/internal/search"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/middleware"
+	"github.com/myproject/shop/pkg/scheduler"
+)
+
+type Application struct {
+	*gin.Engine
+	config *config.Config
+	jobs   scheduler.Jobs
+}
+
+func NewApplication(cfg *config.Config,
+	userH *user.UserHandle,
+	authH *auth.AuthHandler,
+	orderH *Order.OrderHandler,
+	shopH *shop.ShopHandler,
+	searchH *search.Handler,
+	commentH *comment.CommentHandler,
+	cartH *cart.CartHandler,
+	notificationH *notification.NotificationHandler,
+	coordinatorH *Coordinator.TradeHandler,
+	rbacH *rbac.RbacHandler,
+	privacyH *privacy.PrivacyHandler,
+	merchantH *merchant.MerchantHandler,
+	auditH *audit.AuditHandler,
+	jobs scheduler.Jobs) *Application {
+	gin.SetMode(cfg.Server.Mode)
+	app := &Application{
+		Engine: gin.New(),
+		config: cfg,
+		jobs:   jobs,
+	}
+	app.Use(gin.Recovery())
+	// 请求ID要在访问日志之前生成
+	app.Use(audit.Middleware())
+	app.Use(logger.GinLogger())
+	app.Use(cors.New(cors.Config{
+		AllowAllOrigins:  true,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", audit.HeaderRequestID},
+		ExposeHeaders:    []string{"Content-Length", audit.HeaderRequestID},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}))
+	app.GET("/.well-known/jwks.json", authH.JWKS)
+	v0 := app.Group("/api/v0")
+	{
+		// User routes
+		v0.POST("/users", userH.RegisterUser)
+		// 访问任意用户仅限管理员，普通用户使用 /api/v1/me
+		v0.GET("/users/:id", middleware.JWTAuthMiddleware(), middleware.RequirePermission(rbac.PermUserManage), userH.GetUserByID)
+		v0.PATCH("/users/:id", middleware.JWTAuthMiddleware(), middleware.RequirePermission(rbac.PermUserManage), userH.UpdateUser)
+		v0.DELETE("/users/:id", middleware.JWTAuthMiddleware(), middleware.RequirePermission(rbac.PermUserManage), userH.DeleteUser)
+		// v0.GET("/users/:username", userHandler.GetUserByName)
+		// Auth routes
+		v0.POST("/auth/login", authH.Login)
+		v0.POST("/auth/login/2fa", authH.LoginTwoFactor)
+		v0.POST("/auth/login/2fa/enroll", authH.LoginEnroll)
+		v0.POST("/auth/login/2fa/activate", authH.LoginActivate)
+		v0.POST("/auth/refresh", authH.Refresh)
+		v0.POST("/auth/email/verification", middleware.JWTAuthMiddleware(), authH.SendVerificationEmail)
+		v0.POST("/auth/email/verify", authH.VerifyEmail)
+		v0.POST("/auth/password/forgot", authH.ForgotPassword)
+		v0.POST("/auth/password/reset", authH.ResetPassword)
+		v0.GET("/auth/oidc/providers", authH.ListOIDCProviders)
+		v0.GET("/auth/oidc/:provider/login", authH.OIDCLogin)
+		v0.GET("/auth/oidc/:provider/callback", authH.OIDCCallback)
+		v0.POST("/auth/oidc/:provider/link", middleware.JWTAuthMiddleware(), authH.OIDCLink)
+		v0.GET("/auth/identities", middleware.JWTAuthMiddleware(), authH.ListIdentities)
+		v0.DELETE("/auth/identities/:id", middleware.JWTAuthMiddleware(), authH.UnlinkIdentity)
+		v0.POST("/auth/logout", middleware.JWTAuthMiddleware(), authH.Logout)
+		v0.GET("/auth/sessions", middleware.JWTAuthMiddleware(), authH.ListSessions)
+		v0.DELETE("/auth/sessions", middleware.JWTAuthMiddleware(), authH.RevokeAllSessions)
+		v0.DELETE("/auth/sessions/:id", middleware.JWTAuthMiddleware(), authH.RevokeSession)
+		v0.GET("/auth/2fa", middleware.JWTAuthMiddleware(), authH.TwoFactorStatus)
+		v0.POST("/auth/2fa/enroll", middleware.JWTAuthMiddleware(), authH.EnrollTwoFactor)
+		v0.POST("/auth/2fa/activate", middleware.JWTAuthMiddleware(), authH.ActivateTwoFactor)
+		v0.POST("/auth/2fa/disable", middleware.JWTAuthMiddleware(), authH.DisableTwoFactor)
+		v0.POST("/auth/2fa/recovery-codes", middleware.JWTAuthMiddleware(), authH.RegenerateRecoveryCodes)
+	}
+
+	v1 := app.Group("/api/v1")
+	v1.Use(middleware.JWTAuthMiddleware())
+	{
+		v1.GET("/orders", orderH.ListOrders)
+		// 下单要求已验证邮箱
+		v1.GET("/orders/:id", middleware.RequireVerifiedEmail(), coordinatorH.CreateOrder)
+		v1.POST("/orders", middleware.RequireVerifiedEmail(), orderH.CreateOrder)
+		v1.PATCH("/orders/:id/status", middleware.RequirePermission(rbac.PermOrderShip), coordinatorH.RequireOrderShops(rbac.PermOrderShip), orderH.UpdateOrderStatus)
+		v1.DELETE("/orders/:id", orderH.DeleteOrder)
+		v1.POST("/orders/:id/cancel", coordinatorH.CancelOrder)
+		v1.POST("/orders/:id/return", middleware.RequirePermission(rbac.PermOrderReturn), coordinatorH.RequireOrderShops(rbac.PermOrderReturn), coordinatorH.ReturnOrder)
+
+		// Cart routes
+		v1.GET("/cart", cartH.List)
+		v1.POST("/cart/items", cartH.Add)
+		v1.PATCH("/cart/items/:id", cartH.Update)
+		v1.DELETE("/cart/items/:id", cartH.Delete)
+		v1.DELETE("/cart", cartH.Clear)
+
+		// Notification routes
+		v1.GET("/notifications", notificationH.List)
+		v1.PATCH("/notifications/read", notificationH.MarkAllRead)
+		v1.PATCH("/notifications/:id/read", notificationH.MarkRead)
+
+		// Favorites & follows
+		v1.GET("/favorites", shopH.ListFavorites)
+		v1.POST("/favorites/:id", shopH.AddFavorite)
+		v1.DELETE("/favorites/:id", shopH.RemoveFavorite)
+		v1.GET("/follows", shopH.ListFollows)
+		v1.POST("/follows/:id", shopH.FollowShop)
+		v1.DELETE("/follows/:id", shopH.UnfollowShop)
+
+		// Current user
+		v1.GET("/me", userH.GetMe)
+		v1.PATCH("/me", userH.UpdateMe)
+		v1.DELETE("/me", privacyH.RequestDeletion)
+
+		// Personal data export & account deletion
+		v1.POST("/me/export", privacyH.Export)
+		v1.GET("/me/deletion", privacyH.GetDeletion)
+		v1.DELETE("/me/deletion", privacyH.CancelDeletion)
+		v1.POST("/me/deletion/confirmation", privacyH.SendDeletionConfirmation)
+
+		// Merchant onboarding
+		v1.POST("/merchant/applications", middleware.RequireVerifiedEmail(), merchantH.SubmitApplication)
+		v1.GET("/merchant/applications/current", merchantH.CurrentApplication)
+
+		// Browsing history
+		v1.GET("/me/history", shopH.ListHistory)
+		v1.DELETE("/me/history/:id", shopH.DeleteHistoryItem)
+		v1.DELETE("/me/history", shopH.ClearHistory)
+	}
+
+	// v2 只有商家商品和库存路由接受店铺 API key（用于商家 ERP 同步），其余路由只接受 JWT
+	v2 := app.Group("/api/v2")
+
+	// Customer-facing (authenticated) routes
+	v2Customer := v2.Group("", middleware.JWTAuthMiddleware())
+	{
+		// Search routes
+		v2Customer.GET("/search/products", searchH.SearchProducts)
+		v2Customer.GET("/search/orders", searchH.SearchOrders)
+
+		// Shop/product discovery
+		v2Customer.GET("/shops", shopH.ListShops)
+		v2Customer.GET("/shops/:id/products", shopH.ListProducts)
+		v2Customer.GET("/shops/:id/products/search", shopH.GetProductByName)
+		v2Customer.GET("/products/:id", shopH.GetProductByCode)
+		v2Customer.GET("/products/:id/price-history", shopH.GetPriceHistory)
+		v2Customer.GET("/products/:id/recommendations", shopH.GetRecommendations)
+		v2Customer.POST("/products/:id/price-alerts", shopH.SubscribePriceAlert)
+		v2Customer.DELETE("/products/:id/price-alerts", shopH.UnsubscribePriceAlert)
+		v2Customer.GET("/price-alerts", shopH.ListPriceAlerts)
+		v2Customer.GET("/shops/:id", shopH.GetShop)
+	}
+
+	// Merchant/admin routes (require permission) – paths unchanged.
+	// 店铺员工可能只在某个店铺拥有权限，handler 中再按店铺校验
+	v2Merchant := v2.Group("", middleware.JWTAuthMiddleware())
+	// 商品和库存路由同时接受 API key，key 必须在 scopes 中包含路由要求的权限
+	v2ERP := v2.Group("", middleware.AuthMiddleware())
+	{
+		// Shop & product management
+		v2Merchant.POST("/shops", middleware.RequirePermission(rbac.PermShopCreate), shopH.CreateShop)
+		v2ERP.POST("/shops/:id/products", middleware.RequirePermission(rbac.PermProductWrite), shopH.CreateProduct)
+		v2ERP.PATCH("/products/:id", middleware.RequirePermission(rbac.PermProductWrite), shopH.UpdateProduct)
+		v2ERP.PATCH("/products/:id/status", middleware.RequirePermission(rbac.PermProductWrite), shopH.UpdateProductStatus)
+		v2ERP.DELETE("/products/:id", middleware.RequirePermission(rbac.PermProductWrite), shopH.DeleteProduct)
+		v2ERP.DELETE("/products", middleware.RequirePermission(rbac.PermProductWrite), shopH.BatchDeleteProducts)
+		v2Merchant.PATCH("/shops/:id", middleware.RequirePermission(rbac.PermShopWrite), shopH.UpdateShop)
+		v2Merchant.DELETE("/shops/:id", middleware.RequirePermission(rbac.PermShopWrite), shopH.DeleteShop)
+		v2Merchant.DELETE("/shops", middleware.RequirePermission(rbac.PermShopWrite), shopH.BatchDeleteShops)
+
+		// Inventory & warehouses
+		inventory := v2ERP.Group("", middleware.RequirePermission(rbac.PermInventoryWrite))
+		inventory.PATCH("/products/:id/inventory/threshold", shopH.SetReorderThreshold)
+		inventory.GET("/shops/:id/inventory/alerts", shopH.ListInventoryAlerts)
+		inventory.POST("/products/:id/inventory/adjust", shopH.AdjustStock)
+		inventory.POST("/shops/:id/inventory/import", shopH.ImportStock)
+		inventory.GET("/shops/:id/inventory/movements", shopH.ListMovements)
+		inventory.GET("/shops/:id/inventory/check", shopH.CheckInventory)
+		inventory.POST("/shops/:id/warehouses", shopH.CreateWarehouse)
+		inventory.GET("/shops/:id/warehouses", shopH.ListWarehouses)
+		inventory.PATCH("/warehouses/:id", shopH.UpdateWarehouse)
+		inventory.DELETE("/warehouses/:id", shopH.DeleteWarehouse)
+		inventory.GET("/warehouses/:id/stock", shopH.ListWarehouseStock)
+		inventory.PUT("/warehouses/:id/stock", shopH.SetWarehouseStock)
+
+		// Shop staff
+		staff := v2Merchant.Group("", middleware.RequirePermission(rbac.PermStaffManage))
+		staff.GET("/shops/:id/staff", shopH.ListShopStaff)
+		staff.PUT("/shops/:id/staff/:user_id", shopH.SetShopStaff)
+		staff.DELETE("/shops/:id/staff/:user_id", shopH.RemoveShopStaff)
+
+		// Shop API keys
+		apiKeys := v2Merchant.Group("", middleware.RequirePermission(rbac.PermShopWrite))
+		apiKeys.GET("/shops/:id/api-keys", shopH.ListAPIKeys)
+		apiKeys.POST("/shops/:id/api-keys", shopH.CreateAPIKey)
+		apiKeys.DELETE("/shops/:id/api-keys/:key_id", shopH.RevokeAPIKey)
+
+		// Trash: soft-deleted shops & products
+		trash := v2Merchant.Group("", middleware.RequirePermission(rbac.PermShopWrite))
+		trash.GET("/trash/shops", shopH.ListDeletedShops)
+		trash.GET("/trash/products", shopH.ListDeletedProducts)
+		trash.POST("/trash/shops/:id/restore", shopH.RestoreShop)
+		trash.POST("/trash/products/:id/restore", shopH.RestoreProduct)
+		trash.DELETE("/trash/shops/:id", shopH.PurgeShop)
+		trash.DELETE("/trash/products/:id", shopH.PurgeProduct)
+	}
+
+	v3 := app.Group("api/v3")
+	{
+		v3.GET("/shops/:id/comments", commentH.ListCommentsByShop)
+		v3.POST("/shops/:id/comments", middleware.JWTAuthMiddleware(), commentH.CreateComment)
+		v3.DELETE("/shops/:id/comments", middleware.JWTAuthMiddleware(), commentH.DeleteComments)
+	}
+
+	admin := app.Group("/api/admin")
+	admin.Use(middleware.JWTAuthMiddleware())
+	{
+		roles := admin.Group("", middleware.RequirePermission(rbac.PermRoleManage))
+		roles.GET("/permissions", rbacH.ListPermissions)
+		roles.GET("/roles", rbacH.ListRoles)
+		roles.POST("/roles", rbacH.CreateRole)
+		roles.GET("/roles/:id", rbacH.GetRole)
+		roles.PATCH("/roles/:id", rbacH.UpdateRole)
+		roles.PUT("/roles/:id/permissions", rbacH.SetRolePermissions)
+		roles.DELETE("/roles/:id", rbacH.DeleteRole)
+
+		users := admin.Group("", middleware.RequirePermission(rbac.PermUserManage))
+		users.GET("/users", userH.AdminListUsers)
+		users.GET("/users/:id", userH.AdminGetUser)
+		users.GET("/users/:id/audit", userH.ListUserAuditLogs)
+		users.POST("/users/:id/suspend", userH.SuspendUser)
+		users.POST("/users/:id/ban", userH.BanUser)
+		users.POST("/users/:id/reinstate", userH.ReinstateUser)
+		users.PUT("/users/:id/role", userH.ChangeUserRole)
+		users.POST("/users/:id/logout", userH.ForceLogout)
+		users.POST("/users/:id/unlock", authH.UnlockUser)
+
+		review := admin.Group("", middleware.RequirePermission(rbac.PermMerchantReview))
+		review.GET("/merchant-applications", merchantH.ListApplications)
+		review.GET("/merchant-applications/:id", merchantH.GetApplication)
+		review.GET("/merchant-applications/:id/documents/:index", merchantH.GetDocument)
+		review.POST("/merchant-applications/:id/approve", merchantH.ApproveApplication)
+		review.POST("/merchant-applications/:id/reject", merchantH.RejectApplication)
+		review.GET("/shops/reviews", shopH.ListShopReviews)
+		review.POST("/shops/:id/approve", shopH.ApproveShop)
+		review.POST("/shops/:id/reject", shopH.RejectShop)
+
+		audits := admin.Group("", middleware.RequirePermission(rbac.PermAuditRead))
+		audits.GET("/audit-logs", auditH.ListLogs)
+		audits.GET("/audit-logs/:id", auditH.GetLog)
+	}
+
+	return app
+}
+
+func (app *Application) run() error {
+	err := app.Run(app.config.Server.RunAddr)
+	if err != nil {
+		return err
+	}
+	return nil
+}
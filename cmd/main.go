@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/myproject/shop/cmd/validator"
+	auth "github.com/myproject/shop/internal/Auth"
+	privacy "github.com/myproject/shop/internal/Privacy"
 	config "github.com/myproject/shop/internal/config"
 	"github.com/myproject/shop/pkg/logger"
 	"github.com/myproject/shop/pkg/middleware"
+	"github.com/myproject/shop/pkg/scheduler"
+	"github.com/myproject/shop/pkg/utils"
 )
 
 func main() {
@@ -22,13 +28,26 @@ func main() {
 		_ = logger.Close()
 	}()
 
-	middleware.InitJWT(cfg.JWT.Secret)
+	if err := middleware.InitJWT(cfg.JWT.ActiveKeyID, cfg.JWT.Keys); err != nil {
+		log.Fatalf("cannot load jwt keys: %v", err)
+	}
+	utils.SetPasswordParams(cfg.Password.MemoryKB, cfg.Password.Iterations, cfg.Password.Parallelism)
+	if err := auth.ConfigureTwoFactor(cfg.TwoFactor.Issuer, cfg.TwoFactor.SecretKey); err != nil {
+		log.Fatalf("invalid two_factor config: %v", err)
+	}
+	auth.ConfigureEmailLinks(cfg.Mail.VerifyURL, cfg.Mail.ResetURL)
+	auth.ConfigureLoginLimits(cfg.Login.MaxFailures, cfg.Login.IPMaxFailures, time.Duration(cfg.Login.LockoutMinutes)*time.Minute)
+	privacy.ConfigureCoolingOff(cfg.Privacy.DeletionCoolingOff())
 	validator.RegisterPhoneValidator()
 	app, err := InitializeApp(cfg)
 	if err != nil {
 		log.Fatalf("cannot initialize app: %v", err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheduler.Start(ctx, app.jobs)
+
 	if err := app.Run(); err != nil {
 		log.Fatal(err)
 	}
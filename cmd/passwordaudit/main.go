@@ -0,0 +1,33 @@
+// passwordaudit 一次性命令：把从未登录过、密码仍是旧格式（"hashed_" + 明文）的账号标记为必须重置密码。
+// 登录过的账号在登录时已自动升级为 argon2id，不受影响。
+//
+//	go run ./cmd/passwordaudit
+package main
+
+import (
+	"log"
+
+	user "github.com/myproject/shop/internal/User"
+	config "github.com/myproject/shop/internal/config"
+	"github.com/myproject/shop/pkg/database"
+	"github.com/myproject/shop/pkg/utils"
+)
+
+func main() {
+	cfg, err := config.LoadConfig(".")
+	if err != nil {
+		log.Fatalf("cannot load config: %v", err)
+	}
+	db, err := database.NewDB(cfg.Database.BuildPostgresDSN("disable"))
+	if err != nil {
+		log.Fatalf("cannot connect database: %v", err)
+	}
+	if err := db.AutoMigrate(&user.User{}); err != nil {
+		log.Fatalf("cannot migrate users: %v", err)
+	}
+	n, err := user.NewRepository(db).FlagLegacyPasswordResets(utils.LegacyPasswordPrefix)
+	if err != nil {
+		log.Fatalf("flag accounts: %v", err)
+	}
+	log.Printf("flagged %d accounts with legacy passwords for reset", n)
+}
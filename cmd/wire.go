@@ -1,75 +1,158 @@
-//go:build wireinject
-// +build wireinject
-
-package main
-
-import (
-	"log"
-
-	"github.com/google/wire"
-	auth "github.com/myproject/shop/internal/Auth"
-	cart "github.com/myproject/shop/internal/Cart"
-	comment "github.com/myproject/shop/internal/Comment"
-	"github.com/myproject/shop/internal/Coordinator"
-	"github.com/myproject/shop/internal/Order"
-	shop "github.com/myproject/shop/internal/Shop"
-	user "github.com/myproject/shop/internal/User"
-	config "github.com/myproject/shop/internal/config"
-	"github.com/myproject/shop/internal/search"
-	"github.com/myproject/shop/pkg/database"
-	"github.com/myproject/shop/pkg/middleware"
-	"gorm.io/gorm"
-)
-
-func provideRedisStore(cfg *config.Config) *middleware.RedisStore {
-	store := middleware.NewRedisStore(
-		cfg.Redis.Addr,
-		cfg.Redis.Password,
-		cfg.Redis.DB,
-	)
-	middleware.InitRedis(store.Client)
-	return store
-}
-
-func provideDB(cfg *config.Config) (*database.Database, error) {
-	db, err := database.NewDB(cfg.Database.BuildPostgresDSN("disable"))
-	if err != nil {
-		log.Fatal(err)
-		return db, err
-	}
-	if err := db.AutoMigrate(&Order.Order{}, &Order.OrderItem{},
-		&shop.Shop{}, &shop.Product{},
-		&shop.Category{}, &user.User{}, &comment.Comment{},
-		&cart.CartItem{},
-	); err != nil {
-		log.Fatal(err)
-		return db, err
-	}
-	return db, err
-
-}
-
-func provideGormDB(db *database.Database) *gorm.DB {
-	return db.DB
-}
-
-// InitializeApp 是我们要生成的“总构造函数”
-func InitializeApp(cfg *config.Config) (*Application, error) {
-	wire.Build(
-		// 1. 基础设施
-		provideDB,
-		provideRedisStore,
-		provideGormDB,
-		user.ProviderSet,
-		auth.ProviderSet,
-		cart.ProviderSet,
-		Order.ProviderSet,
-		shop.ProviderSet,
-		search.ProviderSet,
-		comment.ProviderSet,
-		Coordinator.NewCheckoutService,
-		Coordinator.NewTradeHandler,
-		NewApplication,
-	)
-	return &Application{}, nil
-}
+//go:build wireinject
+// +build wireinject
+
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/wire"
+	audit "github.com/myproject/shop/internal/Audit"
+	auth "github.com/myproject/shop/internal/Auth"
+	cart "github.com/myproject/shop/internal/Cart"
+	chat "github.com/myproject/shop/internal/Chat"
+	comment "github.com/myproject/shop/internal/Comment"
+	"github.com/myproject/shop/internal/Coordinator"
+	merchant "github.com/myproject/shop/internal/Merchant"
+	notification "github.com/myproject/shop/internal/Notification"
+	"github.com/myproject/shop/internal/Order"
+	privacy "github.com/myproject/shop/internal/Privacy"
+	rbac "github.com/myproject/shop/internal/Rbac"
+	shop "github.com/myproject/shop/internal/Shop"
+	user "github.com/myproject/shop/internal/User"
+	config "github.com/myproject/shop/internal/config"
+	"github.com/myproject/shop/internal/search"
+	"github.com/myproject/shop/pkg/database"
+	"github.com/myproject/shop/pkg/mailer"
+	"github.com/myproject/shop/pkg/middleware"
+	"github.com/myproject/shop/pkg/oidc"
+	"github.com/myproject/shop/pkg/scheduler"
+	"github.com/myproject/shop/pkg/storage"
+	"gorm.io/gorm"
+)
+
+func provideRedisStore(cfg *config.Config) *middleware.RedisStore {
+	store := middleware.NewRedisStore(
+		cfg.Redis.Addr,
+		cfg.Redis.Password,
+		cfg.Redis.DB,
+	)
+	middleware.InitRedis(store.Client)
+	return store
+}
+
+// provideMailer 按配置选择邮件发送方式
+func provideMailer(cfg *config.Config) (mailer.Mailer, error) {
+	return mailer.New(cfg.Mail.Config)
+}
+
+// provideOIDCProviders 第三方身份登录的提供方，未配置时为空
+func provideOIDCProviders(cfg *config.Config) (oidc.Providers, error) {
+	return oidc.NewProviders(cfg.OIDC.Providers)
+}
+
+// provideStorage 上传文件的存储方式
+func provideStorage(cfg *config.Config) (storage.Storage, error) {
+	return storage.New(cfg.Storage)
+}
+
+func provideDB(cfg *config.Config) (*database.Database, error) {
+	db, err := database.NewDB(cfg.Database.BuildPostgresDSN("disable"))
+	if err != nil {
+		log.Fatal(err)
+		return db, err
+	}
+	if err := db.AutoMigrate(&Order.Order{}, &Order.OrderItem{},
+		&shop.Shop{}, &shop.Product{},
+		&shop.Category{}, &user.User{}, &comment.Comment{},
+		&cart.CartItem{},
+		&shop.ProductPriceHistory{}, &shop.PriceAlert{}, &shop.LowStockAlert{},
+		&shop.InventoryMovement{},
+		&shop.Warehouse{},
+		&shop.WarehouseStock{},
+		&shop.ProductFavorite{},
+		&shop.ShopFollow{},
+		&shop.RestockEvent{},
+		&shop.ProductView{},
+		&shop.ProductRecommendation{},
+		&shop.APIKey{},
+		&notification.Notification{},
+		&rbac.Permission{},
+		&rbac.Role{},
+		&rbac.ShopStaff{},
+		&auth.TwoFactor{},
+		&auth.RecoveryCode{},
+		&auth.Identity{},
+		&chat.Message{},
+		&chat.Conversation{},
+		&privacy.DeletionRequest{},
+		&merchant.Application{},
+		&audit.Log{},
+	); err != nil {
+		log.Fatal(err)
+		return db, err
+	}
+	if err := audit.EnsureAppendOnly(db.DB); err != nil {
+		log.Fatal(err)
+		return db, err
+	}
+	if err := rbac.SeedDefaults(db.DB); err != nil {
+		log.Fatal(err)
+		return db, err
+	}
+	return db, err
+
+}
+
+func provideGormDB(db *database.Database) *gorm.DB {
+	return db.DB
+}
+
+// provideJobs 汇总所有需要周期执行的后台任务
+func provideJobs(cfg *config.Config, shopS *shop.ShopService, privacyS *privacy.PrivacyService) scheduler.Jobs {
+	return scheduler.Jobs{
+		{Name: "product_schedule", Interval: time.Minute, Run: shopS.ApplyProductSchedules},
+		{Name: "trash_purge", Interval: time.Hour, Run: func(ctx context.Context) error {
+			return shopS.PurgeTrash(ctx, cfg.Trash.Retention())
+		}},
+		{Name: "low_stock_digest", Interval: 24 * time.Hour, Run: shopS.SendLowStockDigest},
+		{Name: "inventory_consistency", Interval: 24 * time.Hour, Run: shopS.RunStockConsistencyCheck},
+		{Name: "favorites_flush", Interval: 30 * time.Second, Run: shopS.FlushFavorites},
+		{Name: "back_in_stock", Interval: time.Minute, Run: shopS.NotifyBackInStock},
+		{Name: "history_archive", Interval: 5 * time.Minute, Run: shopS.ArchiveHistory},
+		{Name: "recommendations", Interval: 6 * time.Hour, Run: shopS.RebuildRecommendations},
+		{Name: "account_erasure", Interval: time.Hour, Run: privacyS.RunDueDeletions},
+	}
+}
+
+// InitializeApp 是我们要生成的“总构造函数”
+func InitializeApp(cfg *config.Config) (*Application, error) {
+	wire.Build(
+		// 1. 基础设施
+		provideDB,
+		provideRedisStore,
+		provideGormDB,
+		provideMailer,
+		provideOIDCProviders,
+		provideStorage,
+		provideJobs,
+		audit.ProviderSet,
+		user.ProviderSet,
+		auth.ProviderSet,
+		cart.ProviderSet,
+		Order.ProviderSet,
+		shop.ProviderSet,
+		search.ProviderSet,
+		comment.ProviderSet,
+		notification.ProviderSet,
+		rbac.ProviderSet,
+		privacy.ProviderSet,
+		merchant.ProviderSet,
+		Coordinator.NewCheckoutService,
+		Coordinator.NewTradeHandler,
+		NewApplication,
+	)
+	return &Application{}, nil
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AuditHandler struct {
+	service *AuditService
+}
+
+func NewAuditHandler(service *AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// ListLogs GET /api/admin/audit-logs，按操作人、操作、资源、请求ID、IP 和时间范围过滤
+func (h *AuditHandler) ListLogs(c *gin.Context) {
+	var q Query
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logs, total, q, err := h.service.List(q)
+	if err != nil {
+		if errors.Is(err, ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if logs == nil {
+		logs = []Log{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":     logs,
+		"page":      q.Page,
+		"page_size": q.PageSize,
+		"total":     total,
+		"has_more":  int64(q.Offset()+len(logs)) < total,
+	})
+}
+
+// GetLog GET /api/admin/audit-logs/:id
+func (h *AuditHandler) GetLog(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid audit log id"})
+		return
+	}
+	log, err := h.service.Get(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "audit log not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"log": log})
+}
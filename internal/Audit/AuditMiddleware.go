@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/myproject/shop/pkg/middleware"
+)
+
+// HeaderRequestID 客户端或网关可以传入请求ID，没有时由服务端生成，并在响应中返回
+const HeaderRequestID = "X-Request-ID"
+
+const maxRequestIDLen = 64
+
+type metaKey struct{}
+
+// meta 一次请求中审计需要的信息。操作人在 JWT / API key 校验之后才确定，因此在记录时再读取
+type meta struct {
+	requestID string
+	ip        string
+	userAgent string
+	actor     func() (userID, apiKeyID uint)
+}
+
+// Middleware 为请求分配请求ID，并把客户端信息放进 request context，供各业务服务记录审计日志。
+// 需要注册在所有路由之前
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Header(HeaderRequestID, id)
+		m := &meta{
+			requestID: id,
+			ip:        c.ClientIP(),
+			userAgent: c.Request.UserAgent(),
+			actor: func() (uint, uint) {
+				return c.GetUint(middleware.CtxUserIDKey), c.GetUint(middleware.CtxAPIKeyIDKey)
+			},
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), metaKey{}, m))
+		c.Next()
+	}
+}
+
+// validRequestID 只接受较短的字母、数字、'-'、'_'、'.'，避免把任意内容写进日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func metaFrom(ctx context.Context) *meta {
+	if ctx == nil {
+		return nil
+	}
+	// handler 直接传 *gin.Context 时，默认不会回退到 request context
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		ctx = c.Request.Context()
+	}
+	m, _ := ctx.Value(metaKey{}).(*meta)
+	return m
+}
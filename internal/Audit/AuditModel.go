@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 资源类型
+const (
+	ResourceShop    = "shop"
+	ResourceProduct = "product"
+	ResourceAPIKey  = "api_key"
+	ResourceOrder   = "order"
+	ResourceUser    = "user"
+	ResourceSession = "session"
+)
+
+// 操作类型；同一个操作作用于不同资源时共用，查询时配合资源类型过滤
+const (
+	ActionCreate         = "create"
+	ActionUpdate         = "update"
+	ActionDelete         = "delete"
+	ActionRestore        = "restore"
+	ActionPurge          = "purge"
+	ActionApprove        = "approve"
+	ActionReject         = "reject"
+	ActionRevoke         = "revoke"
+	ActionStatusChange   = "status_change"
+	ActionLogin          = "login"
+	ActionLogout         = "logout"
+	ActionPasswordReset  = "password_reset"
+	ActionTwoFactorOn    = "2fa_enable"
+	ActionTwoFactorOff   = "2fa_disable"
+	ActionRecoveryCodes  = "recovery_codes"
+	ActionIdentityLink   = "identity_link"
+	ActionIdentityUnlink = "identity_unlink"
+	ActionSuspend        = "suspend"
+	ActionBan            = "ban"
+	ActionReinstate      = "reinstate"
+	ActionRoleChange     = "role_change"
+	ActionForceLogout    = "force_logout"
+	ActionUnlock         = "unlock"
+)
+
+// Log 敏感操作的审计记录，只追加；数据库触发器拒绝修改和删除
+type Log struct {
+	ID           uint                   `gorm:"primarykey" json:"id"`
+	ActorID      uint                   `gorm:"index" json:"actor_id"`                // 操作人，0 表示匿名或后台任务
+	APIKeyID     uint                   `gorm:"index" json:"api_key_id,omitempty"`    // 通过店铺 API key 调用时的 key
+	Action       string                 `gorm:"size:50;not null;index" json:"action"` // 操作类型
+	ResourceType string                 `gorm:"size:50;not null;index:idx_audit_resource" json:"resource_type"`
+	ResourceID   string                 `gorm:"size:64;index:idx_audit_resource" json:"resource_id,omitempty"`
+	Before       map[string]interface{} `gorm:"serializer:json" json:"before,omitempty"` // 修改前，只包含变化的字段
+	After        map[string]interface{} `gorm:"serializer:json" json:"after,omitempty"`  // 修改后，只包含变化的字段
+	Detail       map[string]interface{} `gorm:"serializer:json" json:"detail,omitempty"` // 其他说明，例如原因、批量操作的数量
+	IP           string                 `gorm:"size:64" json:"ip,omitempty"`
+	UserAgent    string                 `gorm:"size:255" json:"user_agent,omitempty"`
+	RequestID    string                 `gorm:"size:64;index" json:"request_id,omitempty"`
+	CreatedAt    time.Time              `gorm:"index" json:"created_at"`
+}
+
+func (Log) TableName() string {
+	return "audit_logs"
+}
+
+// EnsureAppendOnly 在审计表上创建触发器，拒绝 UPDATE、DELETE 和 TRUNCATE，需在建表之后调用
+func EnsureAppendOnly(db *gorm.DB) error {
+	stmts := []string{
+		`CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS audit_logs_no_modify ON audit_logs`,
+		`CREATE TRIGGER audit_logs_no_modify BEFORE UPDATE OR DELETE ON audit_logs
+	FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`,
+		`DROP TRIGGER IF EXISTS audit_logs_no_truncate ON audit_logs`,
+		`CREATE TRIGGER audit_logs_no_truncate BEFORE TRUNCATE ON audit_logs
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_append_only()`,
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/myproject/shop/pkg/database"
+)
+
+type AuditRepository struct {
+	Database *database.Database
+}
+
+func NewRepository(db *database.Database) *AuditRepository {
+	return &AuditRepository{Database: db}
+}
+
+func (r *AuditRepository) Create(ctx context.Context, log *Log) error {
+	return r.Database.DB.WithContext(ctx).Create(log).Error
+}
+
+func (r *AuditRepository) Get(id uint) (*Log, error) {
+	var log Log
+	if err := r.Database.DB.First(&log, id).Error; err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+func (r *AuditRepository) List(q Query) ([]Log, int64, error) {
+	db := r.Database.DB.Model(&Log{})
+	if q.ActorID != 0 {
+		db = db.Where("actor_id = ?", q.ActorID)
+	}
+	if q.APIKeyID != 0 {
+		db = db.Where("api_key_id = ?", q.APIKeyID)
+	}
+	if q.Action != "" {
+		db = db.Where("action = ?", q.Action)
+	}
+	if q.ResourceType != "" {
+		db = db.Where("resource_type = ?", q.ResourceType)
+	}
+	if q.ResourceID != "" {
+		db = db.Where("resource_id = ?", q.ResourceID)
+	}
+	if q.RequestID != "" {
+		db = db.Where("request_id = ?", q.RequestID)
+	}
+	if q.IP != "" {
+		db = db.Where("ip = ?", q.IP)
+	}
+	if q.From != nil {
+		db = db.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("created_at < ?", *q.To)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []Log
+	if err := db.Order("id DESC").Limit(q.PageSize).Offset(q.Offset()).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
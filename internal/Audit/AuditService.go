@@ -0,0 +1,218 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/myproject/shop/pkg/logger"
+)
+
+var ErrInvalidQuery = errors.New("invalid audit query")
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+
+	// writeTimeout 审计写入不跟随请求取消，但也不能无限阻塞业务请求
+	writeTimeout = 3 * time.Second
+)
+
+// Entry 一条待记录的审计事件
+type Entry struct {
+	ActorID      uint   // 操作人，为 0 时取当前请求的登录用户
+	Action       string // 操作类型
+	ResourceType string
+	ResourceID   string
+	// Before / After 为资源修改前后的状态，可以是结构体或 map；两者都有时只保存变化的字段。
+	// 调用方应只传需要审计的字段，不要包含密码等敏感信息
+	Before interface{}
+	After  interface{}
+	Detail map[string]interface{}
+}
+
+type AuditService struct {
+	repo *AuditRepository
+}
+
+func NewAuditService(repo *AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// ID 把数字ID转换为 ResourceID
+func ID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// Record 记录审计事件。应在业务操作成功之后、请求返回之前调用；
+// 写入失败只记日志，不影响业务操作。s 为 nil 时不做任何事
+func (s *AuditService) Record(ctx context.Context, e Entry) {
+	if s == nil {
+		return
+	}
+	entry := &Log{
+		ActorID:      e.ActorID,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceID:   e.ResourceID,
+		Detail:       e.Detail,
+	}
+	if m := metaFrom(ctx); m != nil {
+		entry.RequestID = m.requestID
+		entry.IP = m.ip
+		entry.UserAgent = truncate(m.userAgent, 255)
+		userID, keyID := m.actor()
+		if entry.ActorID == 0 {
+			entry.ActorID = userID
+		}
+		entry.APIKeyID = keyID
+	}
+	var err error
+	if entry.Before, entry.After, err = Diff(e.Before, e.After); err != nil {
+		// 状态无法序列化时仍然记录操作本身
+		logger.Warn("audit_diff_failed", map[string]interface{}{"action": e.Action, "resource_type": e.ResourceType, "error": err.Error()})
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	wctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+	if err := s.repo.Create(wctx, entry); err != nil {
+		logger.Error("audit_write_failed", map[string]interface{}{
+			"action":        entry.Action,
+			"resource_type": entry.ResourceType,
+			"resource_id":   entry.ResourceID,
+			"actor_id":      entry.ActorID,
+			"request_id":    entry.RequestID,
+			"error":         err.Error(),
+		})
+	}
+}
+
+// Diff 比较修改前后的状态，只返回发生变化的字段；只有一方时返回其完整内容
+func Diff(before, after interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	b, err := toMap(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := toMap(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b == nil || a == nil {
+		return b, a, nil
+	}
+	changedBefore := make(map[string]interface{})
+	changedAfter := make(map[string]interface{})
+	for k, bv := range b {
+		av, ok := a[k]
+		if !ok || !reflect.DeepEqual(bv, av) {
+			changedBefore[k] = bv
+			if ok {
+				changedAfter[k] = av
+			}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changedAfter[k] = av
+		}
+	}
+	if len(changedBefore) == 0 {
+		changedBefore = nil
+	}
+	if len(changedAfter) == 0 {
+		changedAfter = nil
+	}
+	return changedBefore, changedAfter, nil
+}
+
+// toMap 通过 JSON 统一转换，数字、时间等与最终保存的格式一致，便于比较
+func toMap(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if rv := reflect.ValueOf(v); (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Map) && rv.IsNil() {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"value": value}, nil
+	}
+	return m, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// Query 审计日志查询条件，从 query string 绑定；from / to 为 RFC3339 时间，to 不包含
+type Query struct {
+	Page         int        `form:"page"`
+	PageSize     int        `form:"page_size"`
+	ActorID      uint       `form:"actor_id"`
+	APIKeyID     uint       `form:"api_key_id"`
+	Action       string     `form:"action"`
+	ResourceType string     `form:"resource_type"`
+	ResourceID   string     `form:"resource_id"`
+	RequestID    string     `form:"request_id"`
+	IP           string     `form:"ip"`
+	From         *time.Time `form:"from"`
+	To           *time.Time `form:"to"`
+}
+
+func (q *Query) normalize() error {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+	q.Action = strings.TrimSpace(q.Action)
+	q.ResourceType = strings.TrimSpace(q.ResourceType)
+	q.ResourceID = strings.TrimSpace(q.ResourceID)
+	q.RequestID = strings.TrimSpace(q.RequestID)
+	q.IP = strings.TrimSpace(q.IP)
+	if q.ResourceID != "" && q.ResourceType == "" {
+		return fmt.Errorf("%w: resource_id requires resource_type", ErrInvalidQuery)
+	}
+	if q.From != nil && q.To != nil && q.From.After(*q.To) {
+		return fmt.Errorf("%w: from must not be after to", ErrInvalidQuery)
+	}
+	return nil
+}
+
+func (q Query) Offset() int {
+	return (q.Page - 1) * q.PageSize
+}
+
+func (s *AuditService) List(q Query) ([]Log, int64, Query, error) {
+	if err := q.normalize(); err != nil {
+		return nil, 0, q, err
+	}
+	logs, total, err := s.repo.List(q)
+	return logs, total, q, err
+}
+
+func (s *AuditService) Get(id uint) (*Log, error) {
+	return s.repo.Get(id)
+}
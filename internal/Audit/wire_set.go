@@ -0,0 +1,9 @@
+package audit
+
+import "github.com/google/wire"
+
+var ProviderSet = wire.NewSet(
+	NewRepository,
+	NewAuditService,
+	NewAuditHandler,
+)
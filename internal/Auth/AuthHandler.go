@@ -2,19 +2,45 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/myproject/shop/pkg/middleware"
+	"github.com/myproject/shop/pkg/utils"
+	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	svc *AuthService
+	svc  *AuthService
+	oidc *OIDCService
 }
 
-func NewAuthHandler(svc *AuthService) *AuthHandler {
-	return &AuthHandler{svc: svc}
+func NewAuthHandler(svc *AuthService, oidcS *OIDCService) *AuthHandler {
+	return &AuthHandler{svc: svc, oidc: oidcS}
+}
+
+func getUserID(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(middleware.CtxUserIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(uint)
+	return id, ok
+}
+
+func getUserRole(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(middleware.CtxUserRoleKey)
+	if !ok {
+		return 0, false
+	}
+	role, ok := v.(uint)
+	return role, ok
+}
+
+func clientInfo(c *gin.Context) ClientInfo {
+	return ClientInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
 }
 
 type loginReq struct {
@@ -28,12 +54,42 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	access, refresh, userID, role, err := h.svc.Login(context.Background(), req.Username, req.Password)
+	res, err := h.svc.Login(context.Background(), req.Username, req.Password, clientInfo(c))
+	var throttled *LoginThrottledError
+	if errors.As(err, &throttled) {
+		c.Header("Retry-After", strconv.Itoa(throttled.retrySeconds()))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrPasswordResetRequired) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if writeAccountBlocked(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"access_token": access, "refresh_token": refresh, "user_id": userID, "role": role})
+	c.JSON(http.StatusOK, res)
+}
+
+// writeAccountBlocked 账号被停用或封禁时返回 403 和原因
+func writeAccountBlocked(c *gin.Context, err error) bool {
+	var blocked *AccountBlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+	body := gin.H{"error": err.Error(), "status": blocked.Status}
+	if blocked.Reason != "" {
+		body["reason"] = blocked.Reason
+	}
+	if blocked.Until != nil {
+		body["until"] = blocked.Until
+	}
+	c.JSON(http.StatusForbidden, body)
+	return true
 }
 
 type refreshReq struct {
@@ -46,7 +102,7 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	access, refresh, _, _, err := h.svc.Refresh(context.Background(), req.RefreshToken)
+	access, refresh, _, _, err := h.svc.Refresh(context.Background(), req.RefreshToken, clientInfo(c))
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
@@ -77,6 +133,81 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 			jti = s
 		}
 	}
-	_ = h.svc.Logout(context.Background(), userID, jti)
+	family := c.GetString(middleware.CtxTokenFamKey)
+	_ = h.svc.Logout(context.Background(), userID, jti, family)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// JWKS GET /.well-known/jwks.json，公开当前有效的签名公钥
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": utils.JWKS()})
+}
+
+// ListSessions GET /auth/sessions，列出当前用户登录的设备
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	sessions, err := h.svc.ListSessions(c.Request.Context(), userID, c.GetString(middleware.CtxTokenFamKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession DELETE /auth/sessions/:id
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	err := h.svc.RevokeSession(c.Request.Context(), userID, c.Param("id"))
+	if errors.Is(err, ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// RevokeAllSessions DELETE /auth/sessions，退出所有设备（包括当前设备）
+func (h *AuthHandler) RevokeAllSessions(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if err := h.svc.RevokeAllSessions(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// UnlockUser POST /api/admin/users/:id/unlock，解除用户因多次登录失败造成的锁定
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	operatorID, _ := getUserID(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	err = h.svc.UnlockUser(c.Request.Context(), uint(id), operatorID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
@@ -3,94 +3,255 @@ package auth
 import (
 	"context"
 	"errors"
+	"sync"
+	"time"
 
+	audit "github.com/myproject/shop/internal/Audit"
+	rbac "github.com/myproject/shop/internal/Rbac"
 	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/mailer"
 	"github.com/myproject/shop/pkg/middleware"
 	"github.com/myproject/shop/pkg/utils"
 )
 
+var (
+	ErrInvalidCredentials    = errors.New("invalid credentials")
+	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrRefreshTokenRevoked   = errors.New("refresh token invalid or revoked")
+	ErrRefreshTokenReused    = errors.New("refresh token reuse detected, session revoked")
+)
+
+// dummyPasswordHash 用户不存在时也做一次完整的哈希比较，避免通过响应时间探测用户名
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := utils.HashPassword("dummy-password")
+	return hash
+})
+
+// AccountBlockedError 账号被停用或封禁，Until 为空表示永久
+type AccountBlockedError struct {
+	Status string
+	Reason string
+	Until  *time.Time
+}
+
+func (e *AccountBlockedError) Error() string {
+	return "account is " + e.Status
+}
+
 type AuthService struct {
-	userRepo *user.UserRepository
-	redis    *middleware.RedisStore
+	users     *user.UserService
+	userRepo  *user.UserRepository
+	twoFactor *TwoFactorRepository
+	rbac      *rbac.RbacService
+	redis     *middleware.RedisStore
+	mailer    mailer.Mailer
+	audit     *audit.AuditService
+}
+
+func NewAuthService(userS *user.UserService, tfRepo *TwoFactorRepository, rbacS *rbac.RbacService, redisStore *middleware.RedisStore, m mailer.Mailer, auditor *audit.AuditService) *AuthService {
+	s := &AuthService{users: userS, userRepo: userS.Repo, twoFactor: tfRepo, rbac: rbacS, redis: redisStore, mailer: m, audit: auditor}
+	userS.OnRegistered(s.sendVerification)
+	// 修改邮箱后需要重新验证；删除账号后所有会话立即失效
+	userS.OnEmailChanged(s.sendVerification)
+	userS.OnDeleted(s.revokeDeletedUser)
+	userS.SetSessionRevoker(s.RevokeAllSessions)
+	// 用户角色由 RBAC 模块管理，管理员创建的角色同样可以分配
+	userS.SetRoleValidator(rbacS.AssignableToUser)
+	return s
 }
 
-func NewAuthService(uRepo *user.UserRepository, redisStore *middleware.RedisStore) *AuthService {
-	return &AuthService{userRepo: uRepo, redis: redisStore}
+// LoginResult 登录结果。需要两步验证时不签发 token，而是返回 ChallengeToken，
+// 客户端用它和验证码调用 /auth/login/2fa（或先完成绑定）换取 token
+type LoginResult struct {
+	AccessToken        string   `json:"access_token,omitempty"`
+	RefreshToken       string   `json:"refresh_token,omitempty"`
+	UserID             uint     `json:"user_id"`
+	Role               uint     `json:"role"`
+	TwoFactorRequired  bool     `json:"two_factor_required,omitempty"`
+	EnrollmentRequired bool     `json:"two_factor_enrollment_required,omitempty"`
+	ChallengeToken     string   `json:"challenge_token,omitempty"`
+	RecoveryCodes      []string `json:"recovery_codes,omitempty"`
 }
 
-func (s *AuthService) Login(ctx context.Context, username, password string) (access, refresh string, userID uint, role uint, err error) {
+func (s *AuthService) Login(ctx context.Context, username, password string, client ClientInfo) (*LoginResult, error) {
+	if err := s.checkLoginAllowed(ctx, username, client); err != nil {
+		return nil, err
+	}
 	u, err := s.userRepo.GetUserByName(username)
 	if err != nil {
-		return "", "", 0, 0, errors.New("invalid credentials")
+		utils.VerifyPassword(dummyPasswordHash(), password)
+		s.recordLoginFailure(ctx, username, client)
+		return nil, ErrInvalidCredentials
+	}
+	ok, needsRehash := utils.VerifyPassword(u.Password, password)
+	if !ok {
+		s.recordLoginFailure(ctx, username, client)
+		return nil, ErrInvalidCredentials
+	}
+	s.clearLoginFailures(ctx, username)
+	if u.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
 	}
-	// existing project uses utils.HashPassword as placeholder
-	if utils.HashPassword(password) != u.Password {
-		return "", "", 0, 0, errors.New("invalid credentials")
+	// 旧格式或参数过时的哈希在登录成功时顺带升级，失败不影响本次登录
+	var newHash string
+	if needsRehash {
+		if newHash, err = utils.HashPassword(password); err != nil {
+			newHash = ""
+		}
 	}
-	access, refresh, _, err = utils.GenerateTokens(u.ID, u.Role)
+	return s.loginUser(ctx, u, newHash, client)
+}
+
+// loginUser 第一因素（密码或外部身份）验证通过之后的流程：记录登录，按需要进入两步验证，否则签发 token
+func (s *AuthService) loginUser(ctx context.Context, u *user.User, newHash string, client ClientInfo) (*LoginResult, error) {
+	if status := u.EffectiveStatus(time.Now()); status != user.StatusActive {
+		securityEvent("blocked_login", map[string]interface{}{"user_id": u.ID, "status": status, "ip": client.IP})
+		return nil, &AccountBlockedError{Status: status, Reason: u.StatusReason, Until: u.StatusUntil}
+	}
+	if err := s.userRepo.RecordLogin(u.ID, time.Now(), newHash); err != nil {
+		logger.Warn("record_login_failed", map[string]interface{}{"user_id": u.ID, "error": err.Error()})
+	}
+	required, enroll, err := s.secondFactor(u.ID, u.Role)
 	if err != nil {
-		return "", "", 0, 0, err
+		return nil, err
+	}
+	if required {
+		token, err := s.newChallenge(ctx, u.ID, u.Role, enroll)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{
+			UserID:             u.ID,
+			Role:               u.Role,
+			TwoFactorRequired:  !enroll,
+			EnrollmentRequired: enroll,
+			ChallengeToken:     token,
+		}, nil
 	}
-	// parse refresh token to get jti
-	claims, err := utils.ParseToken(refresh)
+	return s.finishLogin(ctx, u.ID, u.Role, client)
+}
+
+func (s *AuthService) finishLogin(ctx context.Context, userID, role uint, client ClientInfo) (*LoginResult, error) {
+	pair, err := s.issueTokens(ctx, userID, role, client)
 	if err != nil {
-		return "", "", 0, 0, err
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.Entry{ActorID: userID, Action: audit.ActionLogin, ResourceType: audit.ResourceSession, ResourceID: pair.Family})
+	return &LoginResult{AccessToken: pair.Access, RefreshToken: pair.Refresh, UserID: userID, Role: role}, nil
+}
+
+// issueTokens 为一次新的登录签发 token 并创建新的 refresh token 族（会话）
+func (s *AuthService) issueTokens(ctx context.Context, userID, role uint, client ClientInfo) (*utils.TokenPair, error) {
+	pair, err := utils.GenerateTokens(userID, role, "")
+	if err != nil {
+		return nil, err
 	}
-	jti, _ := claims["jti"].(string)
-	// save refresh into redis
 	if s.redis != nil {
-		_ = s.redis.SaveJwtRefreshToken(ctx, jti, refresh, u.ID, utils.RefreshTTL)
+		fam := middleware.RefreshFamily{
+			ID:         pair.Family,
+			UserID:     userID,
+			RefreshJTI: pair.RefreshJTI,
+			AccessJTI:  pair.AccessJTI,
+			UserAgent:  client.UserAgent,
+			IP:         client.IP,
+		}
+		if err := s.redis.SaveRefreshFamily(ctx, fam, utils.RefreshTTL); err != nil {
+			return nil, err
+		}
 	}
-	return access, refresh, u.ID, u.Role, nil
+	return pair, nil
 }
 
-func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (newAccess, newRefresh string, userID uint, role uint, err error) {
+// Refresh 轮换 refresh token：旧 token 作废，新 token 留在同一个族里。
+// 已经轮换掉的 token 再次出现说明 token 泄露，整个族（包括攻击者或用户手里较新的 token）都会被吊销
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client ClientInfo) (newAccess, newRefresh string, userID uint, role uint, err error) {
 	claims, err := utils.ParseToken(refreshToken)
 	if err != nil {
 		return "", "", 0, 0, errors.New("invalid refresh token")
 	}
 	// 确保是 refresh token
-	if typ, ok := claims["type"].(string); ok && typ != "refresh" {
+	if typ, ok := claims["type"].(string); !ok || typ != "refresh" {
 		return "", "", 0, 0, errors.New("not a refresh token")
 	}
-	// get user id and jti
-	subFloat := claims["sub"]
-	var uid uint
-
-	switch v := subFloat.(type) {
-	case float64:
-		uid = uint(v)
-	case int:
-		uid = uint(v)
+	uid, ok := claimUint(claims["sub"])
+	if !ok {
+		return "", "", 0, 0, errors.New("invalid refresh token")
 	}
-
+	role, _ = claimUint(claims["role"])
 	jti, _ := claims["jti"].(string)
-	exists, err := s.redis.IsJwtRefreshTokenExists(ctx, jti, uid)
-	if err != nil || !exists {
-		return "", "", 0, 0, errors.New("refresh token invalid or revoked")
+	family, _ := claims["fam"].(string)
+
+	if family == "" {
+		// 升级前签发的 token 没有族信息：按原来的方式校验一次，然后迁移到新的族
+		exists, err := s.redis.IsJwtRefreshTokenExists(ctx, jti, uid)
+		if err != nil || !exists {
+			return "", "", 0, 0, ErrRefreshTokenRevoked
+		}
+		_ = s.redis.DeleteJwtRefreshToken(ctx, jti, uid)
+		pair, err := s.issueTokens(ctx, uid, role, client)
+		if err != nil {
+			return "", "", 0, 0, err
+		}
+		return pair.Access, pair.Refresh, uid, role, nil
 	}
 
-	// delete old refresh
-	_ = s.redis.DeleteJwtRefreshToken(ctx, jti, uid)
-	// issue new tokens
-	newAccess, newRefresh, _, err = utils.GenerateTokens(uid, uint(claims["role"].(float64)))
+	pair, err := utils.GenerateTokens(uid, role, family)
+	if err != nil {
+		return "", "", 0, 0, err
+	}
+	next := middleware.RefreshFamily{ID: family, UserID: uid, RefreshJTI: pair.RefreshJTI, AccessJTI: pair.AccessJTI, IP: client.IP}
+	result, err := s.redis.RotateRefreshFamily(ctx, jti, next, utils.RefreshTTL)
 	if err != nil {
 		return "", "", 0, 0, err
 	}
-	// parse new refresh jti and save
-	newClaims, err := utils.ParseToken(newRefresh)
-	if err == nil {
-		newJti, _ := newClaims["jti"].(string)
-		_ = s.redis.SaveJwtRefreshToken(ctx, newJti, newRefresh, uid, utils.RefreshTTL)
+	switch result {
+	case middleware.RotateOK:
+		return pair.Access, pair.Refresh, uid, role, nil
+	case middleware.RotateReused:
+		if err := s.revokeFamily(ctx, family); err != nil {
+			logger.Error("revoke_refresh_family_failed", map[string]interface{}{"family": family, "error": err.Error()})
+		}
+		securityEvent("refresh_token_reuse", map[string]interface{}{"user_id": uid, "family": family, "jti": jti, "ip": client.IP})
+		s.audit.Record(ctx, audit.Entry{Action: audit.ActionRevoke, ResourceType: audit.ResourceSession, ResourceID: family,
+			Detail: map[string]interface{}{"user_id": uid, "reason": "refresh_token_reuse"}})
+		return "", "", 0, 0, ErrRefreshTokenReused
+	default:
+		return "", "", 0, 0, ErrRefreshTokenRevoked
 	}
-	return newAccess, newRefresh, uid, uint(claims["role"].(float64)), nil
 }
 
-func (s *AuthService) Logout(ctx context.Context, userID uint, accessJti string) error {
-	// delete all refresh tokens for user is safer; here we assume caller knows jti if needed
-	// we will blacklist the access token jti
-	if s.redis != nil {
+// revokeFamily 吊销 refresh token 族，该族签发的 access token 同时失效
+func (s *AuthService) revokeFamily(ctx context.Context, family string) error {
+	_, err := s.redis.RevokeRefreshFamily(ctx, family, utils.RefreshTTL)
+	return err
+}
+
+// Logout 吊销当前 access token 以及它所属的整个 refresh token 族
+func (s *AuthService) Logout(ctx context.Context, userID uint, accessJti, family string) error {
+	if s.redis == nil {
+		return nil
+	}
+	if accessJti != "" {
 		_ = s.redis.BlacklistAccessToken(ctx, accessJti, utils.AcessTTL)
 	}
+	if family != "" {
+		if err := s.revokeFamily(ctx, family); err != nil {
+			return err
+		}
+	}
+	s.audit.Record(ctx, audit.Entry{ActorID: userID, Action: audit.ActionLogout, ResourceType: audit.ResourceSession, ResourceID: family})
 	return nil
 }
+
+func claimUint(v interface{}) (uint, bool) {
+	switch n := v.(type) {
+	case float64:
+		return uint(n), true
+	case int:
+		return uint(n), true
+	case uint:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/myproject/shop/pkg/utils"
+)
+
+type emailTokenReq struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type forgotPasswordReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordReq struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+func writeEmailError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, utils.ErrInvalidEmailToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrEmailAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrEmailRateLimited):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// SendVerificationEmail POST /auth/email/verification，重新发送验证邮件
+func (h *AuthHandler) SendVerificationEmail(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if err := h.svc.SendVerificationEmail(c.Request.Context(), userID); err != nil {
+		writeEmailError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "verification email sent"})
+}
+
+// VerifyEmail POST /auth/email/verify
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req emailTokenReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.svc.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		writeEmailError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+// ForgotPassword POST /auth/password/forgot，无论邮箱是否存在都返回 202
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RequestPasswordReset(c.Request.Context(), req.Email, clientInfo(c))
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the email is registered, a reset link has been sent"})
+}
+
+// ResetPassword POST /auth/password/reset
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req resetPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.svc.ResetPassword(c.Request.Context(), req.Token, req.NewPassword, clientInfo(c)); err != nil {
+		writeEmailError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset, please log in again"})
+}
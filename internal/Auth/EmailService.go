@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	audit "github.com/myproject/shop/internal/Audit"
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/mailer"
+	"github.com/myproject/shop/pkg/utils"
+)
+
+// 邮件 token 的用途，同时作为 token 的 type 声明
+const (
+	purposeVerifyEmail     = "email_verify"
+	purposePasswordReset   = "password_reset"
+	purposeAccountDeletion = "account_deletion"
+)
+
+const (
+	verifyEmailTTL     = 24 * time.Hour
+	passwordResetTTL   = 30 * time.Minute
+	deletionConfirmTTL = 30 * time.Minute
+	emailCooldown      = time.Minute // 同一用户同一用途两次发信的最小间隔
+	mailSendTimeout    = 30 * time.Second
+)
+
+var (
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	ErrEmailRateLimited     = errors.New("email was sent recently, please try again later")
+)
+
+// 邮件中链接指向的前端页面，token 以 ?token= 附加；未配置时邮件中直接给出 token
+var emailLinks struct {
+	verifyURL string
+	resetURL  string
+}
+
+// ConfigureEmailLinks 设置验证邮箱和重置密码页面的地址
+func ConfigureEmailLinks(verifyURL, resetURL string) {
+	emailLinks.verifyURL = verifyURL
+	emailLinks.resetURL = resetURL
+}
+
+func emailLink(base, token string) string {
+	if base == "" {
+		return "Token: " + token
+	}
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
+
+// issueEmailToken 签发 token 并记为该用户该用途的当前 token，之前发出的同用途 token 随之失效
+func (s *AuthService) issueEmailToken(ctx context.Context, u *user.User, purpose string, ttl time.Duration) (string, error) {
+	token, jti, err := utils.GenerateEmailToken(u.ID, purpose, u.Email, ttl)
+	if err != nil {
+		return "", err
+	}
+	if err := s.redis.SaveEmailToken(ctx, purpose, u.ID, jti, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeEmailToken 校验 token 并将其作废，返回 token 对应的用户；签发后修改过邮箱的 token 无效
+func (s *AuthService) consumeEmailToken(ctx context.Context, token, purpose string) (*user.User, error) {
+	userID, email, jti, err := utils.ParseEmailToken(token, purpose)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.redis.ConsumeEmailToken(ctx, purpose, userID, jti)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, utils.ErrInvalidEmailToken
+	}
+	u, err := s.userRepo.GetUserByID(userID)
+	if err != nil || u.Email != email {
+		return nil, utils.ErrInvalidEmailToken
+	}
+	return u, nil
+}
+
+// sendVerification 注册成功后异步发送验证邮件，发送失败只记录日志，用户可以重新发送
+func (s *AuthService) sendVerification(u *user.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.SendVerificationEmail(ctx, u.ID); err != nil {
+			logger.Error("send_verification_email_failed", map[string]interface{}{"user_id": u.ID, "error": err.Error()})
+		}
+	}()
+}
+
+// SendVerificationEmail 向用户当前邮箱发送验证邮件
+func (s *AuthService) SendVerificationEmail(ctx context.Context, userID uint) error {
+	u, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if u.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	allowed, err := s.redis.AllowEmailSend(ctx, purposeVerifyEmail, u.ID, emailCooldown)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrEmailRateLimited
+	}
+	token, err := s.issueEmailToken(ctx, u, purposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address within %d hours:\n\n%s\n\nIf you did not create an account, you can ignore this email.\n",
+			u.Username, int(verifyEmailTTL.Hours()), emailLink(emailLinks.verifyURL, token)),
+	})
+}
+
+// VerifyEmail 使用验证邮件中的 token 完成邮箱验证
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	u, err := s.consumeEmailToken(ctx, token, purposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+	ok, err := s.userRepo.MarkEmailVerified(u.ID, u.Email, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return utils.ErrInvalidEmailToken
+	}
+	return nil
+}
+
+// RequestPasswordReset 向该邮箱发送重置密码邮件。
+// 邮箱不存在、冷却中或发送失败都不返回错误，避免通过接口探测哪些邮箱已注册
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string, client ClientInfo) {
+	u, err := s.userRepo.GetUserByEmail(email)
+	if err != nil {
+		return
+	}
+	allowed, err := s.redis.AllowEmailSend(ctx, purposePasswordReset, u.ID, emailCooldown)
+	if err != nil || !allowed {
+		return
+	}
+	token, err := s.issueEmailToken(ctx, u, purposePasswordReset, passwordResetTTL)
+	if err == nil {
+		err = s.mailer.Send(ctx, mailer.Message{
+			To:      u.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. The link is valid for %d minutes and can be used once:\n\n%s\n\nIf you did not request this, you can ignore this email; your password will not change.\n",
+				u.Username, int(passwordResetTTL.Minutes()), emailLink(emailLinks.resetURL, token)),
+		})
+	}
+	if err != nil {
+		logger.Error("send_password_reset_email_failed", map[string]interface{}{"user_id": u.ID, "error": err.Error()})
+		return
+	}
+	securityEvent("password_reset_requested", map[string]interface{}{"user_id": u.ID, "ip": client.IP})
+}
+
+// SendDeletionConfirmation 发送注销账号确认邮件。通过 OIDC 注册的账号没有可用的密码，
+// 可以用邮件中的 token 代替密码申请注销
+func (s *AuthService) SendDeletionConfirmation(ctx context.Context, userID uint) error {
+	u, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	allowed, err := s.redis.AllowEmailSend(ctx, purposeAccountDeletion, u.ID, emailCooldown)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrEmailRateLimited
+	}
+	token, err := s.issueEmailToken(ctx, u, purposeAccountDeletion, deletionConfirmTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      u.Email,
+		Subject: "Confirm your account deletion",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this token within %d minutes to confirm that you want to delete your account:\n\n%s\n\nIf you did not request this, you can ignore this email; your account will not change.\n",
+			u.Username, int(deletionConfirmTTL.Minutes()), emailLink("", token)),
+	})
+}
+
+// ConfirmDeletion 使用注销确认邮件中的 token 确认身份，token 只能使用一次，且必须属于当前用户
+func (s *AuthService) ConfirmDeletion(ctx context.Context, userID uint, token string) error {
+	u, err := s.consumeEmailToken(ctx, token, purposeAccountDeletion)
+	if err != nil {
+		return err
+	}
+	if u.ID != userID {
+		return utils.ErrInvalidEmailToken
+	}
+	return nil
+}
+
+// ResetPassword 使用重置邮件中的 token 设置新密码。
+// 同时清除必须重置密码的标记和登录锁定、把邮箱标记为已验证（能收到邮件即证明拥有该邮箱），并退出所有设备
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string, client ClientInfo) error {
+	u, err := s.consumeEmailToken(ctx, token, purposePasswordReset)
+	if err != nil {
+		return err
+	}
+	hash, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.userRepo.ResetPassword(u.ID, hash, &now); err != nil {
+		return err
+	}
+	if err := s.RevokeAllSessions(ctx, u.ID); err != nil {
+		logger.Error("revoke_sessions_after_reset_failed", map[string]interface{}{"user_id": u.ID, "error": err.Error()})
+	}
+	s.clearLoginFailures(ctx, u.Username)
+	securityEvent("password_reset", map[string]interface{}{"user_id": u.ID, "ip": client.IP})
+	s.audit.Record(ctx, audit.Entry{ActorID: u.ID, Action: audit.ActionPasswordReset, ResourceType: audit.ResourceUser, ResourceID: audit.ID(u.ID)})
+	return nil
+}
@@ -0,0 +1,14 @@
+package auth
+
+import "time"
+
+// Identity 关联到本地用户的外部身份，同一提供方的同一 subject 只能关联一个用户
+type Identity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"size:64;not null;uniqueIndex:idx_identity_subject" json:"provider"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"subject"`
+	Email     string    `gorm:"size:100" json:"email"` // 最近一次登录时提供方返回的邮箱，仅供展示
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/database"
+	"gorm.io/gorm"
+)
+
+type IdentityRepository struct {
+	Database *database.Database
+}
+
+func NewIdentityRepository(db *database.Database) *IdentityRepository {
+	return &IdentityRepository{Database: db}
+}
+
+func (r *IdentityRepository) Find(provider, subject string) (*Identity, error) {
+	var id Identity
+	if err := r.Database.DB.Where("provider = ? AND subject = ?", provider, subject).First(&id).Error; err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (r *IdentityRepository) Create(id *Identity) error {
+	return r.Database.DB.Create(id).Error
+}
+
+// CreateWithUser 首次使用外部身份登录时，在同一事务中创建用户和外部身份
+func (r *IdentityRepository) CreateWithUser(u *user.User, id *Identity) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		id.UserID = u.ID
+		return tx.Create(id).Error
+	})
+}
+
+// UpdateEmail 记录提供方最新返回的邮箱
+func (r *IdentityRepository) UpdateEmail(id uint, email string) error {
+	return r.Database.DB.Model(&Identity{}).Where("id = ?", id).Update("email", email).Error
+}
+
+func (r *IdentityRepository) ListByUser(userID uint) ([]Identity, error) {
+	var ids []Identity
+	if err := r.Database.DB.Where("user_id = ?", userID).Order("id").Find(&ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Delete 删除用户自己的外部身份，返回是否删除了记录
+func (r *IdentityRepository) Delete(userID, id uint) (bool, error) {
+	res := r.Database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&Identity{})
+	return res.RowsAffected > 0, res.Error
+}
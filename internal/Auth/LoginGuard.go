@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/middleware"
+)
+
+// 登录失败限制：同一用户名和同一 IP 分别计数。用户名的阈值较低，防止针对单个账号猜密码；
+// IP 的阈值较高，防止同一来源撞库
+var loginLimits = struct {
+	user middleware.LoginLimits
+	ip   middleware.LoginLimits
+}{
+	user: middleware.LoginLimits{BackoffAfter: 3, MaxFailures: 10, MaxBackoff: 5 * time.Minute, Lockout: 30 * time.Minute},
+	ip:   middleware.LoginLimits{BackoffAfter: 20, MaxFailures: 100, MaxBackoff: 5 * time.Minute, Lockout: time.Hour},
+}
+
+// ConfigureLoginLimits 设置锁定阈值和锁定时长，小于等于 0 的参数保留默认值
+func ConfigureLoginLimits(maxFailures, ipMaxFailures int, lockout time.Duration) {
+	if maxFailures > 0 {
+		loginLimits.user.MaxFailures = maxFailures
+	}
+	if ipMaxFailures > 0 {
+		loginLimits.ip.MaxFailures = ipMaxFailures
+	}
+	if lockout > 0 {
+		loginLimits.user.Lockout = lockout
+	}
+}
+
+// LoginThrottledError 用户名或 IP 处于退避或锁定期间
+type LoginThrottledError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "too many failed login attempts, account temporarily locked; try again later or reset your password"
+	}
+	return fmt.Sprintf("too many failed login attempts, retry in %d seconds", e.retrySeconds())
+}
+
+func (e *LoginThrottledError) retrySeconds() int {
+	return int((e.RetryAfter + time.Second - 1) / time.Second)
+}
+
+func userSubject(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLoginAllowed 在校验密码之前调用；Redis 不可用时放行，只记录日志
+func (s *AuthService) checkLoginAllowed(ctx context.Context, username string, client ClientInfo) error {
+	if s.redis == nil {
+		return nil
+	}
+	block, err := s.redis.LoginBlocked(ctx, userSubject(username), ipSubject(client.IP))
+	if err != nil {
+		logger.Error("login_guard_check_failed", map[string]interface{}{"username": username, "error": err.Error()})
+		return nil
+	}
+	if block == nil {
+		return nil
+	}
+	securityEvent("login_throttled", map[string]interface{}{
+		"username":    username,
+		"ip":          client.IP,
+		"subject":     block.Subject,
+		"locked":      block.Locked,
+		"retry_after": block.RetryAfter.Seconds(),
+	})
+	return &LoginThrottledError{Locked: block.Locked, RetryAfter: block.RetryAfter}
+}
+
+// recordLoginFailure 用户名不存在时同样计数，避免通过是否锁定探测用户名
+func (s *AuthService) recordLoginFailure(ctx context.Context, username string, client ClientInfo) {
+	if s.redis == nil {
+		return
+	}
+	fields := map[string]interface{}{"username": username, "ip": client.IP, "user_agent": client.UserAgent}
+	userFailures, userLocked, err := s.redis.RecordLoginFailure(ctx, userSubject(username), loginLimits.user)
+	if err != nil {
+		logger.Error("login_guard_record_failed", map[string]interface{}{"username": username, "error": err.Error()})
+		return
+	}
+	ipFailures, ipLocked, err := s.redis.RecordLoginFailure(ctx, ipSubject(client.IP), loginLimits.ip)
+	if err != nil {
+		logger.Error("login_guard_record_failed", map[string]interface{}{"ip": client.IP, "error": err.Error()})
+		return
+	}
+	fields["user_failures"] = userFailures
+	fields["ip_failures"] = ipFailures
+	securityEvent("login_failed", fields)
+	if userLocked {
+		securityEvent("account_locked", map[string]interface{}{"username": username, "ip": client.IP, "failures": userFailures, "lockout": loginLimits.user.Lockout.String()})
+	}
+	if ipLocked {
+		securityEvent("ip_blocked", map[string]interface{}{"ip": client.IP, "failures": ipFailures, "lockout": loginLimits.ip.Lockout.String()})
+	}
+}
+
+// clearLoginFailures 登录成功后清除该用户名的计数；IP 的计数保留，避免用一个有效账号重置撞库计数
+func (s *AuthService) clearLoginFailures(ctx context.Context, username string) {
+	if s.redis == nil {
+		return
+	}
+	if err := s.redis.ClearLoginFailures(ctx, userSubject(username)); err != nil {
+		logger.Error("login_guard_clear_failed", map[string]interface{}{"username": username, "error": err.Error()})
+	}
+}
+
+// UnlockUser 管理员解除用户的登录锁定
+func (s *AuthService) UnlockUser(ctx context.Context, userID, operatorID uint) error {
+	u, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.redis.ClearLoginFailures(ctx, userSubject(u.Username)); err != nil {
+		return err
+	}
+	securityEvent("account_unlocked", map[string]interface{}{"user_id": u.ID, "username": u.Username, "by": operatorID})
+	s.users.RecordAudit(ctx, u.ID, operatorID, user.AuditUnlock, "", nil)
+	return nil
+}
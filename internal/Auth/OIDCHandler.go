@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/myproject/shop/pkg/oidc"
+)
+
+func writeOIDCError(c *gin.Context, err error) {
+	if writeAccountBlocked(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, oidc.ErrUnknownProvider), errors.Is(err, ErrIdentityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrOIDCStateInvalid), errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, ErrIdentityNoEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrIdentityLinked), errors.Is(err, ErrIdentityEmailInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+}
+
+// setOIDCStateCookie 写入或清除（maxAge < 0）state 绑定 cookie。路径限定为 /auth/oidc/:provider，
+// 只在回调时发送；SameSite=Lax 保证从提供方跳转回来的顶层 GET 请求会带上
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     OIDCStateCookie,
+		Value:    value,
+		Path:     path.Dir(c.Request.URL.Path),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ListOIDCProviders GET /auth/oidc/providers
+func (h *AuthHandler) ListOIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.oidc.ProviderNames()})
+}
+
+// OIDCLogin GET /auth/oidc/:provider/login，重定向到身份提供方
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	authURL, binding, err := h.oidc.Begin(c.Request.Context(), c.Param("provider"), 0)
+	if err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+	setOIDCStateCookie(c, binding, int(oidcFlowTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCLink POST /auth/oidc/:provider/link，返回授权地址，由前端跳转；完成后身份关联到当前用户
+func (h *AuthHandler) OIDCLink(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	authURL, binding, err := h.oidc.Begin(c.Request.Context(), c.Param("provider"), userID)
+	if err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+	setOIDCStateCookie(c, binding, int(oidcFlowTTL.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// OIDCCallback GET /auth/oidc/:provider/callback
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": e, "error_description": c.Query("error_description")})
+		return
+	}
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state and code are required"})
+		return
+	}
+	binding, _ := c.Cookie(OIDCStateCookie)
+	res, err := h.oidc.Callback(c.Request.Context(), c.Param("provider"), state, code, binding, clientInfo(c))
+	// state 无效时保留 cookie，伪造的回调不影响用户正在进行的授权
+	if !errors.Is(err, ErrOIDCStateInvalid) {
+		setOIDCStateCookie(c, "", -1)
+	}
+	if err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// ListIdentities GET /auth/identities
+func (h *AuthHandler) ListIdentities(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	identities, err := h.oidc.ListIdentities(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// UnlinkIdentity DELETE /auth/identities/:id
+func (h *AuthHandler) UnlinkIdentity(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid identity id"})
+		return
+	}
+	if err := h.oidc.Unlink(c.Request.Context(), userID, uint(id)); err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	audit "github.com/myproject/shop/internal/Audit"
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/oidc"
+	"github.com/myproject/shop/pkg/utils"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const oidcFlowTTL = 10 * time.Minute
+
+// OIDCStateCookie 发起授权时写入浏览器的 cookie，值为 state 的哈希；回调时必须带上匹配的 cookie，
+// 防止攻击者把自己的授权结果注入受害者的浏览器（登录 / 关联 CSRF）
+const OIDCStateCookie = "oidc_state"
+
+var (
+	ErrOIDCStateInvalid   = errors.New("invalid or expired login state")
+	ErrIdentityLinked     = errors.New("this identity is already linked to another account")
+	ErrIdentityEmailInUse = errors.New("an account with this email already exists, log in and link the identity from your account instead")
+	ErrIdentityNoEmail    = errors.New("identity provider did not return an email address")
+	ErrIdentityNotFound   = errors.New("identity not found")
+)
+
+// OIDCService 第三方身份登录：授权码 + PKCE 流程、外部身份与本地用户的关联，以及首次登录时创建用户
+type OIDCService struct {
+	auth       *AuthService
+	identities *IdentityRepository
+	providers  oidc.Providers
+}
+
+func NewOIDCService(authS *AuthService, repo *IdentityRepository, providers oidc.Providers) *OIDCService {
+	return &OIDCService{auth: authS, identities: repo, providers: providers}
+}
+
+// oidcFlow 发起授权时保存的状态，以 state 为 key，回调时取出并删除，只能使用一次
+type oidcFlow struct {
+	Provider   string `json:"provider"`
+	Verifier   string `json:"verifier"`
+	Nonce      string `json:"nonce"`
+	LinkUserID uint   `json:"link_user_id,omitempty"` // 不为 0 表示为已登录用户关联身份，而不是登录
+}
+
+func oidcFlowKey(state string) string {
+	return "oidc:state:" + state
+}
+
+func oidcStateBinding(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// OIDCResult 回调的结果：登录时为 Login，关联身份时为 Linked
+type OIDCResult struct {
+	Login  *LoginResult `json:"login,omitempty"`
+	Linked *Identity    `json:"linked,omitempty"`
+}
+
+// ProviderNames 已配置的身份提供方
+func (s *OIDCService) ProviderNames() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Begin 生成跳转到提供方的授权地址，以及需要写入 OIDCStateCookie 的值；
+// linkUserID 不为 0 时回调会把身份关联到该用户
+func (s *OIDCService) Begin(ctx context.Context, providerName string, linkUserID uint) (authURL, binding string, err error) {
+	provider, err := s.providers.Get(providerName)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err = provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+	flow := oidcFlow{Provider: providerName, Verifier: verifier, Nonce: nonce, LinkUserID: linkUserID}
+	if err := s.auth.redis.SetObjectWithTTL(ctx, oidcFlowKey(state), flow, oidcFlowTTL); err != nil {
+		return "", "", err
+	}
+	return authURL, oidcStateBinding(state), nil
+}
+
+// Callback 处理提供方的回调：校验 state 及其与浏览器的绑定，用授权码换取并校验 ID token，然后登录或关联身份。
+// binding 为请求携带的 OIDCStateCookie
+func (s *OIDCService) Callback(ctx context.Context, providerName, state, code, binding string, client ClientInfo) (*OIDCResult, error) {
+	provider, err := s.providers.Get(providerName)
+	if err != nil {
+		return nil, err
+	}
+	// 不匹配时不消费 state，避免伪造的回调让用户自己的登录失败
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(oidcStateBinding(state))) != 1 {
+		securityEvent("oidc_state_mismatch", map[string]interface{}{"provider": providerName, "ip": client.IP})
+		return nil, ErrOIDCStateInvalid
+	}
+	data, err := s.auth.redis.Client.GetDel(ctx, oidcFlowKey(state)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal(data, &flow); err != nil || flow.Provider != providerName {
+		return nil, ErrOIDCStateInvalid
+	}
+	claims, err := provider.Exchange(ctx, code, flow.Verifier, flow.Nonce)
+	if err != nil {
+		securityEvent("oidc_exchange_failed", map[string]interface{}{"provider": providerName, "ip": client.IP, "error": err.Error()})
+		return nil, err
+	}
+	if flow.LinkUserID != 0 {
+		identity, err := s.link(ctx, flow.LinkUserID, providerName, claims)
+		if err != nil {
+			return nil, err
+		}
+		return &OIDCResult{Linked: identity}, nil
+	}
+	login, err := s.login(ctx, providerName, claims, client)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCResult{Login: login}, nil
+}
+
+func (s *OIDCService) login(ctx context.Context, providerName string, claims *oidc.Claims, client ClientInfo) (*LoginResult, error) {
+	identity, err := s.identities.Find(providerName, claims.Subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		u, err := s.provision(providerName, claims)
+		if err != nil {
+			return nil, err
+		}
+		securityEvent("oidc_user_provisioned", map[string]interface{}{"provider": providerName, "subject": claims.Subject, "user_id": u.ID, "ip": client.IP})
+		s.auth.audit.Record(ctx, audit.Entry{ActorID: u.ID, Action: audit.ActionCreate, ResourceType: audit.ResourceUser, ResourceID: audit.ID(u.ID),
+			Detail: map[string]interface{}{"provider": providerName}})
+		return s.auth.loginUser(ctx, u, "", client)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.auth.userRepo.GetUserByID(identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Email != "" && claims.Email != identity.Email {
+		_ = s.identities.UpdateEmail(identity.ID, claims.Email)
+	}
+	securityEvent("oidc_login", map[string]interface{}{"provider": providerName, "subject": claims.Subject, "user_id": u.ID, "ip": client.IP})
+	return s.auth.loginUser(ctx, u, "", client)
+}
+
+// provision 首次登录时创建用户。邮箱已被本地账号使用时不自动关联（提供方未必可信），
+// 用户需要先用原账号登录再关联
+func (s *OIDCService) provision(providerName string, claims *oidc.Claims) (*user.User, error) {
+	if claims.Email == "" {
+		return nil, ErrIdentityNoEmail
+	}
+	if taken, err := s.auth.userRepo.EmailTaken(claims.Email, 0); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrIdentityEmailInUse
+	}
+	username, err := s.availableUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+	// 外部身份创建的账号没有可用的密码，需要密码登录时通过重置密码设置
+	random, err := oidc.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.HashPassword(random)
+	if err != nil {
+		return nil, err
+	}
+	u := &user.User{Username: username, Email: claims.Email, Password: hash, Role: user.RoleCustomer}
+	if claims.EmailVerified {
+		now := time.Now()
+		u.EmailVerifiedAt = &now
+	}
+	identity := &Identity{Provider: providerName, Subject: claims.Subject, Email: claims.Email}
+	if err := s.identities.CreateWithUser(u, identity); err != nil {
+		return nil, err
+	}
+	if u.EmailVerifiedAt == nil {
+		s.auth.sendVerification(u)
+	}
+	return u, nil
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// availableUsername 依次尝试 preferred_username、邮箱前缀，重名时追加随机后缀
+func (s *OIDCService) availableUsername(claims *oidc.Claims) (string, error) {
+	base := usernameInvalidChars.ReplaceAllString(claims.PreferredUsername, "")
+	if base == "" {
+		base = usernameInvalidChars.ReplaceAllString(strings.SplitN(claims.Email, "@", 2)[0], "")
+	}
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 80 {
+		base = base[:80]
+	}
+	candidate := base
+	for i := 0; i < 5; i++ {
+		if taken, err := s.auth.userRepo.UsernameTaken(candidate, 0); err != nil {
+			return "", err
+		} else if !taken {
+			return candidate, nil
+		}
+		suffix, err := oidc.RandomString(4)
+		if err != nil {
+			return "", err
+		}
+		candidate = base + "_" + strings.ToLower(usernameInvalidChars.ReplaceAllString(suffix, ""))
+	}
+	return "", errors.New("could not allocate a unique username")
+}
+
+// link 把外部身份关联到已登录的用户；已关联到本人时直接返回
+func (s *OIDCService) link(ctx context.Context, userID uint, providerName string, claims *oidc.Claims) (*Identity, error) {
+	existing, err := s.identities.Find(providerName, claims.Subject)
+	if err == nil {
+		if existing.UserID != userID {
+			securityEvent("identity_link_conflict", map[string]interface{}{"provider": providerName, "subject": claims.Subject, "user_id": userID, "owner_id": existing.UserID})
+			return nil, ErrIdentityLinked
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	identity := &Identity{UserID: userID, Provider: providerName, Subject: claims.Subject, Email: claims.Email}
+	if err := s.identities.Create(identity); err != nil {
+		return nil, err
+	}
+	securityEvent("identity_linked", map[string]interface{}{"provider": providerName, "subject": claims.Subject, "user_id": userID})
+	s.auth.audit.Record(ctx, audit.Entry{ActorID: userID, Action: audit.ActionIdentityLink, ResourceType: audit.ResourceUser, ResourceID: audit.ID(userID),
+		Detail: map[string]interface{}{"provider": providerName, "identity_id": identity.ID}})
+	return identity, nil
+}
+
+// ListIdentities 用户已关联的外部身份
+func (s *OIDCService) ListIdentities(userID uint) ([]Identity, error) {
+	return s.identities.ListByUser(userID)
+}
+
+// Unlink 解除关联。通过外部身份创建的账号解除最后一个身份后只能通过重置密码登录
+func (s *OIDCService) Unlink(ctx context.Context, userID, identityID uint) error {
+	ok, err := s.identities.Delete(userID, identityID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrIdentityNotFound
+	}
+	securityEvent("identity_unlinked", map[string]interface{}{"identity_id": identityID, "user_id": userID})
+	s.auth.audit.Record(ctx, audit.Entry{ActorID: userID, Action: audit.ActionIdentityUnlink, ResourceType: audit.ResourceUser, ResourceID: audit.ID(userID),
+		Detail: map[string]interface{}{"identity_id": identityID}})
+	return nil
+}
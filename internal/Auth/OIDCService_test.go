@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	rbac "github.com/myproject/shop/internal/Rbac"
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/database"
+	"github.com/myproject/shop/pkg/mailer"
+	"github.com/myproject/shop/pkg/middleware"
+	"github.com/myproject/shop/pkg/oidc"
+	"github.com/myproject/shop/pkg/oidc/oidctest"
+	"github.com/myproject/shop/pkg/utils"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testProvider = "mock"
+
+type oidcEnv struct {
+	svc      *OIDCService
+	users    *user.UserRepository
+	provider *oidctest.Provider
+	redis    *redis.Client
+}
+
+// newOIDCEnv 用 oidctest 提供方、内存 Redis 和 SQLite 组装 OIDCService
+func newOIDCEnv(t *testing.T) *oidcEnv {
+	t.Helper()
+	if _, err := utils.UseEphemeralSigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	store := &middleware.RedisStore{Client: client}
+
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &database.Database{DB: gdb}
+	if err := db.AutoMigrate(&user.User{}, &Identity{}, &TwoFactor{}, &rbac.Permission{}, &rbac.Role{}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := oidctest.Start("shop-client", "shop-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	providers, err := oidc.NewProviders([]oidc.ProviderConfig{p.Config(testProvider, "http://shop.test/auth/oidc/mock/callback")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userRepo := user.NewRepository(db)
+	authS := NewAuthService(user.NewService(userRepo, nil), NewTwoFactorRepository(db),
+		rbac.NewRbacService(rbac.NewRepository(db), store), store, &mailer.LogMailer{}, nil)
+	return &oidcEnv{
+		svc:      NewOIDCService(authS, NewIdentityRepository(db), providers),
+		users:    userRepo,
+		provider: p,
+		redis:    client,
+	}
+}
+
+// authorize 模拟浏览器访问授权地址，返回提供方重定向回来的 state 和 code
+func (e *oidcEnv) authorize(t *testing.T, authURL string) (state, code string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d", resp.StatusCode)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query().Get("state"), loc.Query().Get("code")
+}
+
+// begin 发起授权并走完提供方一侧，返回回调需要的参数
+func (e *oidcEnv) begin(t *testing.T, linkUserID uint) (state, code, binding string) {
+	t.Helper()
+	authURL, binding, err := e.svc.Begin(context.Background(), testProvider, linkUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code = e.authorize(t, authURL)
+	return state, code, binding
+}
+
+// tamperFlow 修改 Redis 中保存的授权状态，模拟 nonce / PKCE 不匹配
+func (e *oidcEnv) tamperFlow(t *testing.T, state string, modify func(*oidcFlow)) {
+	t.Helper()
+	ctx := context.Background()
+	data, err := e.redis.Get(ctx, oidcFlowKey(state)).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal(data, &flow); err != nil {
+		t.Fatal(err)
+	}
+	modify(&flow)
+	data, _ = json.Marshal(flow)
+	if err := e.redis.Set(ctx, oidcFlowKey(state), data, oidcFlowTTL).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (e *oidcEnv) createUser(t *testing.T, username, email string) *user.User {
+	t.Helper()
+	u := &user.User{Username: username, Email: email, Password: "x", Role: user.RoleCustomer}
+	if err := e.users.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestOIDCFirstLoginProvisionsUser(t *testing.T) {
+	e := newOIDCEnv(t)
+	e.provider.SetUser(oidc.Claims{Subject: "sub-1", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "alice"})
+
+	state, code, binding := e.begin(t, 0)
+	res, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{})
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	if res.Login == nil || res.Login.AccessToken == "" || res.Login.RefreshToken == "" {
+		t.Fatalf("expected tokens, got %+v", res)
+	}
+	u, err := e.users.GetUserByID(res.Login.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alice" || u.Email != "alice@example.com" || u.EmailVerifiedAt == nil {
+		t.Fatalf("unexpected provisioned user %+v", u)
+	}
+
+	// 再次登录使用已关联的账号，不重复创建
+	state, code, binding = e.begin(t, 0)
+	again, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{})
+	if err != nil {
+		t.Fatalf("second callback: %v", err)
+	}
+	if again.Login == nil || again.Login.UserID != u.ID {
+		t.Fatalf("expected login as user %d, got %+v", u.ID, again.Login)
+	}
+}
+
+func TestOIDCFirstLoginEmailInUse(t *testing.T) {
+	e := newOIDCEnv(t)
+	e.createUser(t, "bob", "bob@example.com")
+	e.provider.SetUser(oidc.Claims{Subject: "sub-bob", Email: "bob@example.com", EmailVerified: true})
+
+	state, code, binding := e.begin(t, 0)
+	_, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{})
+	if !errors.Is(err, ErrIdentityEmailInUse) {
+		t.Fatalf("expected ErrIdentityEmailInUse, got %v", err)
+	}
+}
+
+func TestOIDCLinkIdentity(t *testing.T) {
+	e := newOIDCEnv(t)
+	owner := e.createUser(t, "carol", "carol@example.com")
+	other := e.createUser(t, "dave", "dave@example.com")
+	e.provider.SetUser(oidc.Claims{Subject: "sub-carol", Email: "carol@idp.example.com", EmailVerified: true})
+
+	state, code, binding := e.begin(t, owner.ID)
+	res, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{})
+	if err != nil {
+		t.Fatalf("link callback: %v", err)
+	}
+	if res.Linked == nil || res.Linked.UserID != owner.ID || res.Linked.Subject != "sub-carol" {
+		t.Fatalf("unexpected link result %+v", res)
+	}
+
+	// 同一个外部身份不能再关联到其他用户
+	state, code, binding = e.begin(t, other.ID)
+	if _, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{}); !errors.Is(err, ErrIdentityLinked) {
+		t.Fatalf("expected ErrIdentityLinked, got %v", err)
+	}
+
+	// 关联后可以用该身份登录原账号
+	state, code, binding = e.begin(t, 0)
+	login, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{})
+	if err != nil {
+		t.Fatalf("login callback: %v", err)
+	}
+	if login.Login == nil || login.Login.UserID != owner.ID {
+		t.Fatalf("expected login as user %d, got %+v", owner.ID, login.Login)
+	}
+}
+
+func TestOIDCStateBinding(t *testing.T) {
+	e := newOIDCEnv(t)
+	state, code, binding := e.begin(t, 0)
+
+	for _, wrong := range []string{"", oidcStateBinding("other-state")} {
+		if _, err := e.svc.Callback(context.Background(), testProvider, state, code, wrong, ClientInfo{}); !errors.Is(err, ErrOIDCStateInvalid) {
+			t.Fatalf("binding %q: expected ErrOIDCStateInvalid, got %v", wrong, err)
+		}
+	}
+	// 伪造的回调不消费 state，带正确 cookie 的回调仍然成功
+	if _, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{}); err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	// state 只能使用一次
+	if _, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{}); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Fatalf("expected ErrOIDCStateInvalid on replay, got %v", err)
+	}
+}
+
+func TestOIDCNonceMismatch(t *testing.T) {
+	e := newOIDCEnv(t)
+	state, code, binding := e.begin(t, 0)
+	e.tamperFlow(t, state, func(f *oidcFlow) { f.Nonce = "another-nonce" })
+
+	_, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{})
+	if !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+	}
+}
+
+func TestOIDCPKCEMismatch(t *testing.T) {
+	e := newOIDCEnv(t)
+	state, code, binding := e.begin(t, 0)
+	e.tamperFlow(t, state, func(f *oidcFlow) { f.Verifier = "wrong-verifier-wrong-verifier-wrong-verifier" })
+
+	_, err := e.svc.Callback(context.Background(), testProvider, state, code, binding, ClientInfo{})
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("expected invalid_grant, got %v", err)
+	}
+}
@@ -0,0 +1,12 @@
+package auth
+
+import "github.com/myproject/shop/pkg/logger"
+
+// securityEvent 记录安全相关事件，统一使用 security_event 消息便于检索和告警
+func securityEvent(event string, fields map[string]interface{}) {
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["event"] = event
+	logger.Warn("security_event", fields)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	audit "github.com/myproject/shop/internal/Audit"
+	"github.com/myproject/shop/pkg/logger"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// ClientInfo 发起登录或刷新的客户端
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// Session 一次登录会话，对应一个 refresh token 族。
+// LastUsedAt 在登录和刷新 token 时更新，精度约为 access token 的有效期
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// ListSessions 返回用户所有有效的会话，按最近使用时间倒序；current 为发起请求的会话
+func (s *AuthService) ListSessions(ctx context.Context, userID uint, current string) ([]Session, error) {
+	families, err := s.redis.ListRefreshFamilies(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, 0, len(families))
+	for _, f := range families {
+		sessions = append(sessions, Session{
+			ID:         f.ID,
+			UserAgent:  f.UserAgent,
+			IP:         f.IP,
+			CreatedAt:  f.CreatedAt,
+			LastUsedAt: f.LastUsedAt,
+			Current:    f.ID == current,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+// RevokeSession 吊销用户的某个会话，该会话的 refresh token 和 access token 立即失效
+func (s *AuthService) RevokeSession(ctx context.Context, userID uint, sessionID string) error {
+	fam, err := s.redis.GetRefreshFamily(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if fam == nil || fam.UserID != userID {
+		return ErrSessionNotFound
+	}
+	if err := s.revokeFamily(ctx, sessionID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionRevoke, ResourceType: audit.ResourceSession, ResourceID: sessionID, Detail: map[string]interface{}{"user_id": userID}})
+	return nil
+}
+
+// RevokeAllSessions 退出所有设备：吊销用户全部会话，并清理没有族信息的旧 refresh token
+func (s *AuthService) RevokeAllSessions(ctx context.Context, userID uint) error {
+	families, err := s.redis.ListRefreshFamilies(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, f := range families {
+		if err := s.revokeFamily(ctx, f.ID); err != nil {
+			return err
+		}
+	}
+	if err := s.redis.DeleteUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionRevoke, ResourceType: audit.ResourceSession,
+		Detail: map[string]interface{}{"user_id": userID, "all": true, "sessions": len(families)}})
+	return nil
+}
+
+func (s *AuthService) revokeDeletedUser(userID uint) {
+	if err := s.RevokeAllSessions(context.Background(), userID); err != nil {
+		logger.Error("revoke_sessions_after_delete_failed", map[string]interface{}{"user_id": userID, "error": err.Error()})
+	}
+}
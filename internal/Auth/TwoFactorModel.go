@@ -0,0 +1,23 @@
+package auth
+
+import "time"
+
+// TwoFactor 用户的 TOTP 两步验证。开始绑定时写入 Enabled=false 的记录，验证通过后才启用
+type TwoFactor struct {
+	UserID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Secret    string `gorm:"size:255;not null"` // base32 密钥，配置了 two_factor.secret_key 时加密保存
+	Enabled   bool   `gorm:"default:false"`
+	EnabledAt *time.Time
+	LastStep  int64 // 最近一次通过验证的时间步，同一个验证码不能使用两次
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RecoveryCode 一次性恢复码，只保存哈希
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"size:64;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
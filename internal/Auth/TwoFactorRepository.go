@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/myproject/shop/pkg/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TwoFactorRepository struct {
+	Database *database.Database
+}
+
+func NewTwoFactorRepository(db *database.Database) *TwoFactorRepository {
+	return &TwoFactorRepository{Database: db}
+}
+
+func (r *TwoFactorRepository) Get(userID uint) (*TwoFactor, error) {
+	var tf TwoFactor
+	if err := r.Database.DB.First(&tf, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// SavePending 保存待验证的密钥，覆盖之前未完成的绑定
+func (r *TwoFactorRepository) SavePending(userID uint, secret string) error {
+	tf := TwoFactor{UserID: userID, Secret: secret}
+	return r.Database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"secret": secret, "enabled": false, "enabled_at": nil, "last_step": 0, "updated_at": time.Now()}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Table: "two_factors", Name: "enabled"}, Value: false}}},
+	}).Create(&tf).Error
+}
+
+// Enable 启用两步验证并替换恢复码
+func (r *TwoFactorRepository) Enable(userID uint, step int64, codeHashes []string, at time.Time) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&TwoFactor{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"enabled": true, "enabled_at": at, "last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodesTx(tx, userID, codeHashes)
+	})
+}
+
+// AdvanceStep 记录通过验证的时间步，时间步不大于上次记录时返回 false（验证码被重放）
+func (r *TwoFactorRepository) AdvanceStep(userID uint, step int64) (bool, error) {
+	res := r.Database.DB.Model(&TwoFactor{}).
+		Where("user_id = ? AND enabled = ? AND last_step < ?", userID, true, step).
+		Update("last_step", step)
+	return res.RowsAffected > 0, res.Error
+}
+
+// UseRecoveryCode 核销一个未使用的恢复码
+func (r *TwoFactorRepository) UseRecoveryCode(userID uint, codeHash string, at time.Time) (bool, error) {
+	res := r.Database.DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *TwoFactorRepository) CountUnusedRecoveryCodes(userID uint) (int64, error) {
+	var n int64
+	err := r.Database.DB.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&n).Error
+	return n, err
+}
+
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodesTx(tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodesTx(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]RecoveryCode, len(codeHashes))
+	for i, h := range codeHashes {
+		codes[i] = RecoveryCode{UserID: userID, CodeHash: h}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// Delete 关闭两步验证，同时删除恢复码
+func (r *TwoFactorRepository) Delete(userID uint) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&TwoFactor{}).Error
+	})
+}
@@ -0,0 +1,486 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	audit "github.com/myproject/shop/internal/Audit"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/utils"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolling   = errors.New("two-factor enrollment has not been started")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is required for this role")
+	ErrInvalidTwoFactorCode    = errors.New("invalid verification code")
+	ErrChallengeInvalid        = errors.New("login challenge invalid or expired")
+)
+
+const (
+	challengeTTL         = 5 * time.Minute
+	challengeMaxAttempts = 5
+	recoveryCodeCount    = 10
+	sealedSecretPrefix   = "v1:"
+)
+
+var (
+	totpIssuer = "Shop"
+	secretKey  []byte // AES-256 密钥，为空时 TOTP 密钥明文保存
+)
+
+// ConfigureTwoFactor 设置验证器 App 中显示的发行方，以及用于加密 TOTP 密钥的 base64 编码 32 字节密钥
+func ConfigureTwoFactor(issuer, key string) error {
+	if issuer != "" {
+		totpIssuer = issuer
+	}
+	if key == "" {
+		logger.Warn("two_factor_secret_key_missing", map[string]interface{}{"hint": "set two_factor.secret_key to encrypt TOTP secrets at rest"})
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return errors.New("two_factor.secret_key must be 32 bytes encoded in base64")
+	}
+	secretKey = raw
+	return nil
+}
+
+func sealSecret(secret string) (string, error) {
+	if secretKey == nil {
+		return secret, nil
+	}
+	gcm, err := newSecretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return sealedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openSecret(stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedSecretPrefix) {
+		return stored, nil
+	}
+	if secretKey == nil {
+		return "", errors.New("two_factor.secret_key is required to decrypt TOTP secrets")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedSecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newSecretCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("sealed secret too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newSecretCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Enrollment 绑定验证器 App 所需的信息
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TwoFactorStatus 当前用户的两步验证状态
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// loginChallenge 密码校验通过、等待第二步验证的登录，保存在 Redis 的 2fa:challenge:{token}；
+// 已用的验证次数单独保存在 2fa:challenge:{token}:attempts
+type loginChallenge struct {
+	UserID uint
+	Role   uint
+	Enroll bool // 角色要求两步验证但用户尚未绑定，只能用于完成绑定
+}
+
+func challengeKey(token string) string {
+	return "2fa:challenge:" + token
+}
+
+func challengeAttemptsKey(token string) string {
+	return challengeKey(token) + ":attempts"
+}
+
+// attemptScript 校验验证码之前原子地占用一次机会，返回已用次数；challenge 不存在或次数已用完时返回 0 并作废 challenge。
+// 并发的猜测各自占用一次机会，总数不会超过上限
+// keys: [challengeKey, attemptsKey], args: [maxAttempts]
+var attemptScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local n = redis.call('INCR', KEYS[2])
+if n == 1 then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[2], ttl)
+	end
+end
+if n > tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return 0
+end
+return n
+`)
+
+// newChallenge 创建登录 challenge，返回给客户端的 token
+func (s *AuthService) newChallenge(ctx context.Context, userID, role uint, enroll bool) (string, error) {
+	if s.redis == nil {
+		return "", errors.New("two-factor login requires redis")
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	ch := loginChallenge{UserID: userID, Role: role, Enroll: enroll}
+	if err := s.redis.SetObjectWithTTL(ctx, challengeKey(token), ch, challengeTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *AuthService) loadChallenge(ctx context.Context, token string) (*loginChallenge, error) {
+	if s.redis == nil || token == "" {
+		return nil, ErrChallengeInvalid
+	}
+	var ch loginChallenge
+	ok, err := s.redis.GetObject(ctx, challengeKey(token), &ch)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrChallengeInvalid
+	}
+	return &ch, nil
+}
+
+// takeAttempt 校验验证码之前占用一次机会，返回本次是第几次；次数用完时 challenge 作废，需要重新输入密码
+func (s *AuthService) takeAttempt(ctx context.Context, token string, ch *loginChallenge) (int, error) {
+	n, err := attemptScript.Run(ctx, s.redis.Client, []string{challengeKey(token), challengeAttemptsKey(token)}, challengeMaxAttempts).Int()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		securityEvent("two_factor_challenge_exhausted", map[string]interface{}{"user_id": ch.UserID})
+		return 0, ErrChallengeInvalid
+	}
+	return n, nil
+}
+
+// failChallenge 验证失败且已用完最后一次机会时立即作废 challenge
+func (s *AuthService) failChallenge(ctx context.Context, token string, ch *loginChallenge, attempt int) {
+	if attempt < challengeMaxAttempts {
+		return
+	}
+	s.dropChallenge(ctx, token)
+	securityEvent("two_factor_challenge_exhausted", map[string]interface{}{"user_id": ch.UserID})
+}
+
+func (s *AuthService) dropChallenge(ctx context.Context, token string) {
+	_ = s.redis.Client.Del(ctx, challengeKey(token), challengeAttemptsKey(token)).Err()
+}
+
+// secondFactor 判断登录是否需要第二步：已启用两步验证，或角色要求但尚未绑定
+func (s *AuthService) secondFactor(userID, role uint) (required, enroll bool, err error) {
+	tf, err := s.twoFactor.Get(userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, false, err
+	}
+	if tf != nil && tf.Enabled {
+		return true, false, nil
+	}
+	mustEnroll, err := s.rbac.RoleRequiresTwoFactor(role)
+	if err != nil {
+		return false, false, err
+	}
+	return mustEnroll, mustEnroll, nil
+}
+
+// CompleteLogin 登录第二步：用 TOTP 验证码或恢复码换取 token
+func (s *AuthService) CompleteLogin(ctx context.Context, challenge, code, recoveryCode string, client ClientInfo) (*LoginResult, error) {
+	ch, err := s.loadChallenge(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	if ch.Enroll {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	attempt, err := s.takeAttempt(ctx, challenge, ch)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifySecondFactor(ch.UserID, code, recoveryCode); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.failChallenge(ctx, challenge, ch, attempt)
+		}
+		return nil, err
+	}
+	s.dropChallenge(ctx, challenge)
+	return s.finishLogin(ctx, ch.UserID, ch.Role, client)
+}
+
+// ChallengeEnroll 角色强制两步验证的用户在登录过程中开始绑定
+func (s *AuthService) ChallengeEnroll(ctx context.Context, challenge string) (*Enrollment, error) {
+	ch, err := s.loadChallenge(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	if !ch.Enroll {
+		return nil, ErrChallengeInvalid
+	}
+	return s.BeginEnrollment(ch.UserID)
+}
+
+// ChallengeActivate 登录过程中完成绑定，返回 token 和恢复码
+func (s *AuthService) ChallengeActivate(ctx context.Context, challenge, code string, client ClientInfo) (*LoginResult, error) {
+	ch, err := s.loadChallenge(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	if !ch.Enroll {
+		return nil, ErrChallengeInvalid
+	}
+	attempt, err := s.takeAttempt(ctx, challenge, ch)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := s.ActivateTwoFactor(ctx, ch.UserID, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.failChallenge(ctx, challenge, ch, attempt)
+		}
+		return nil, err
+	}
+	s.dropChallenge(ctx, challenge)
+	res, err := s.finishLogin(ctx, ch.UserID, ch.Role, client)
+	if err != nil {
+		return nil, err
+	}
+	res.RecoveryCodes = codes
+	return res, nil
+}
+
+// BeginEnrollment 生成新的 TOTP 密钥，验证通过前不会生效
+func (s *AuthService) BeginEnrollment(userID uint) (*Enrollment, error) {
+	u, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	tf, err := s.twoFactor.Get(userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if tf != nil && tf.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactor.SavePending(userID, sealed); err != nil {
+		return nil, err
+	}
+	return &Enrollment{Secret: secret, URI: utils.TOTPURI(totpIssuer, u.Username, secret)}, nil
+}
+
+// ActivateTwoFactor 用验证器 App 上的验证码确认绑定，返回一次性恢复码（只展示这一次）
+func (s *AuthService) ActivateTwoFactor(ctx context.Context, userID uint, code string) ([]string, error) {
+	tf, err := s.twoFactor.Get(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTwoFactorNotEnrolling
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tf.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := openSecret(tf.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactor.Enable(userID, step, hashes, time.Now()); err != nil {
+		return nil, err
+	}
+	securityEvent("two_factor_enabled", map[string]interface{}{"user_id": userID})
+	s.audit.Record(ctx, audit.Entry{ActorID: userID, Action: audit.ActionTwoFactorOn, ResourceType: audit.ResourceUser, ResourceID: audit.ID(userID)})
+	return codes, nil
+}
+
+// DisableTwoFactor 关闭两步验证，需要当前验证码或恢复码；角色强制要求时不能关闭
+func (s *AuthService) DisableTwoFactor(ctx context.Context, userID, role uint, code, recoveryCode string) error {
+	required, err := s.rbac.RoleRequiresTwoFactor(role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+	if err := s.verifySecondFactor(userID, code, recoveryCode); err != nil {
+		return err
+	}
+	if err := s.twoFactor.Delete(userID); err != nil {
+		return err
+	}
+	securityEvent("two_factor_disabled", map[string]interface{}{"user_id": userID})
+	s.audit.Record(ctx, audit.Entry{ActorID: userID, Action: audit.ActionTwoFactorOff, ResourceType: audit.ResourceUser, ResourceID: audit.ID(userID)})
+	return nil
+}
+
+// RegenerateRecoveryCodes 作废旧的恢复码并生成新的一组
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	if err := s.verifySecondFactor(userID, code, ""); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactor.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.Entry{ActorID: userID, Action: audit.ActionRecoveryCodes, ResourceType: audit.ResourceUser, ResourceID: audit.ID(userID)})
+	return codes, nil
+}
+
+func (s *AuthService) TwoFactorStatus(userID, role uint) (*TwoFactorStatus, error) {
+	status := &TwoFactorStatus{}
+	var err error
+	if status.Required, err = s.rbac.RoleRequiresTwoFactor(role); err != nil {
+		return nil, err
+	}
+	tf, err := s.twoFactor.Get(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Enabled = tf.Enabled
+	if tf.Enabled {
+		if status.RecoveryCodesRemaining, err = s.twoFactor.CountUnusedRecoveryCodes(userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// VerifyTwoFactorCode 敏感操作（例如注销账号）前用两步验证码确认身份
+func (s *AuthService) VerifyTwoFactorCode(userID uint, code string) error {
+	if code == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	return s.verifySecondFactor(userID, code, "")
+}
+
+// verifySecondFactor 校验 TOTP 验证码（拒绝重放）或核销一个恢复码
+func (s *AuthService) verifySecondFactor(userID uint, code, recoveryCode string) error {
+	tf, err := s.twoFactor.Get(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !tf.Enabled) {
+		return ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if code != "" {
+		secret, err := openSecret(tf.Secret)
+		if err != nil {
+			return err
+		}
+		step, ok := utils.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		fresh, err := s.twoFactor.AdvanceStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+	if recoveryCode != "" {
+		used, err := s.twoFactor.UseRecoveryCode(userID, hashRecoveryCode(recoveryCode), time.Now())
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		securityEvent("recovery_code_used", map[string]interface{}{"user_id": userID})
+		return nil
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes 生成形如 abcde-fghij 的恢复码及其哈希
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(buf))[:10]
+		codes = append(codes, fmt.Sprintf("%s-%s", raw[:5], raw[5:]))
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 恢复码是高熵随机串，直接用 SHA-256；输入时忽略大小写、空格和连字符
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
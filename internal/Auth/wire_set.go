@@ -3,6 +3,9 @@ package auth
 import "github.com/google/wire"
 
 var ProviderSet = wire.NewSet(
+	NewTwoFactorRepository,
+	NewIdentityRepository,
 	NewAuthService,
+	NewOIDCService,
 	NewAuthHandler,
 )
@@ -6,15 +6,18 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	rbac "github.com/myproject/shop/internal/Rbac"
+	shop "github.com/myproject/shop/internal/Shop"
 	"github.com/myproject/shop/pkg/middleware"
 )
 
 type CommentHandler struct {
 	service *CommentService
+	shops   *shop.ShopAuthorizer
 }
 
-func NewCommentHandler(srv *CommentService) *CommentHandler {
-	return &CommentHandler{service: srv}
+func NewCommentHandler(srv *CommentService, shops *shop.ShopAuthorizer) *CommentHandler {
+	return &CommentHandler{service: srv, shops: shops}
 }
 
 type createCommentReq struct {
@@ -92,19 +95,29 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 }
 
 // DeleteComments DELETE /shops/:id/comments
-// Query param: cascade=true|false
+// Query param: cascade=true|false, user_id=删除该用户的评论（默认自己，删除他人评论需要在该店铺拥有 comment:moderate 权限）
 func (h *CommentHandler) DeleteComments(c *gin.Context) {
 	shopIDInt, _ := strconv.Atoi(c.Param("id"))
 	shopID := uint(shopIDInt)
 
-	// 从中间件获取 user id（string 存储），尝试解析
-	var userID uint
-	if v, ok := c.Get(middleware.CtxUserIDKey); ok {
-		if s, ok := v.(string); ok {
-			if uid, err := strconv.ParseUint(s, 10, 64); err == nil {
-				userID = uint(uid)
-			}
+	userID, _ := c.Get(middleware.CtxUserIDKey)
+	currentID, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	targetID := currentID
+	if v := c.Query("user_id"); v != "" {
+		uid, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
 		}
+		targetID = uint(uid)
+	}
+	if targetID != currentID && !h.shops.CanManageShop(c, shopID, rbac.PermCommentModerate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
 	}
 
 	cascade := false
@@ -112,7 +125,7 @@ func (h *CommentHandler) DeleteComments(c *gin.Context) {
 		cascade = true
 	}
 
-	if err := h.service.DeleteComment(context.Background(), userID, shopID, cascade); err != nil {
+	if err := h.service.DeleteComment(context.Background(), targetID, shopID, cascade); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -2,12 +2,17 @@ package Coordinator
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"time"
 
 	"github.com/myproject/shop/internal/Order"
 	shop "github.com/myproject/shop/internal/Shop"
 	"gorm.io/gorm"
 )
 
+var ErrOrderForbidden = errors.New("order does not belong to current user")
+
 type CheckoutService struct {
 	db           *gorm.DB
 	orderService *Order.OrderService
@@ -22,13 +27,21 @@ func NewCheckoutService(db *gorm.DB, orderS *Order.OrderService, shopS *shop.Sho
 	}
 }
 
-func (s *CheckoutService) PlaceOrder(ctx context.Context, order *Order.Order) error {
+// PlaceOrder 扣减库存并创建订单；shipTo 不为空时从离收货位置最近的仓库发货
+func (s *CheckoutService) PlaceOrder(ctx context.Context, order *Order.Order, shipTo *shop.GeoPoint) error {
+	if order.OrderID == "" {
+		order.OrderID = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	change := shop.StockChange{Reason: shop.MovementCheckout, Reference: order.OrderID, ActorID: order.UserID, Near: shipTo}
 	return s.db.Transaction(func(tx *gorm.DB) error {
-		//扣除库存
-		for _, item := range order.OrderItems {
-			if err := s.shopService.DecreaseStockWithTx(ctx, tx, item.ProductID, item.Quantity); err != nil {
+		//扣除库存，并记录每个订单项的发货仓库
+		for i := range order.OrderItems {
+			item := &order.OrderItems[i]
+			warehouseID, err := s.shopService.DecreaseStockWithTx(ctx, tx, item.ProductID, item.Quantity, change)
+			if err != nil {
 				return err
 			}
+			item.WarehouseID = warehouseID
 		}
 		//创建订单
 		if err := s.orderService.CreateOrderWithTx(ctx, tx, order); err != nil {
@@ -37,3 +50,68 @@ func (s *CheckoutService) PlaceOrder(ctx context.Context, order *Order.Order) er
 		return nil
 	})
 }
+
+// CancelOrder 取消未发货的订单并返还库存；非管理员只能取消自己的订单
+func (s *CheckoutService) CancelOrder(ctx context.Context, id uint, actorID uint, isAdmin bool) (*Order.Order, error) {
+	return s.restock(ctx, id, actorID, !isAdmin, shop.MovementCancellation, Order.OrderStatusCancelled,
+		Order.OrderStatusPending, Order.OrderStatusPaid)
+}
+
+// ReturnOrder 已签收的订单退货入库，订单标记为已退款
+func (s *CheckoutService) ReturnOrder(ctx context.Context, id uint, actorID uint) (*Order.Order, error) {
+	return s.restock(ctx, id, actorID, false, shop.MovementReturn, Order.OrderStatusRefunded,
+		Order.OrderStatusDelivered, Order.OrderStatusCompleted)
+}
+
+// restock 在一个事务内校验订单状态、返还下单时实际扣减且尚未返还的库存并更新订单状态；
+// 没有经过下单扣减的订单不返还库存
+func (s *CheckoutService) restock(ctx context.Context, id, actorID uint, ownerOnly bool, reason shop.MovementReason, to Order.OrderStatus, from ...Order.OrderStatus) (*Order.Order, error) {
+	var order *Order.Order
+	var previous Order.OrderStatus
+	var restocked []uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = s.orderService.GetForUpdateWithTx(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if ownerOnly && order.UserID != actorID {
+			return ErrOrderForbidden
+		}
+		allowed := false
+		for _, st := range from {
+			if order.Status == st {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.New("order status " + string(order.Status) + " cannot change to " + string(to))
+		}
+		holds, err := s.shopService.OutstandingCheckoutWithTx(ctx, tx, order.OrderID)
+		if err != nil {
+			return err
+		}
+		change := shop.StockChange{Reason: reason, Reference: order.OrderID, ActorID: actorID}
+		for _, h := range holds {
+			// 库存放回原发货仓库
+			change.WarehouseID = h.WarehouseID
+			if err := s.shopService.IncreaseStockWithTx(ctx, tx, h.ProductID, h.Quantity, change); err != nil {
+				return err
+			}
+			restocked = append(restocked, h.ProductID)
+		}
+		if err := s.orderService.UpdateStatusWithTx(ctx, tx, order.ID, to); err != nil {
+			return err
+		}
+		previous = order.Status
+		order.Status = to
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.shopService.RefreshStockCache(restocked...)
+	s.orderService.RecordStatusChange(ctx, order, actorID, previous, map[string]interface{}{"reason": reason})
+	return order, nil
+}
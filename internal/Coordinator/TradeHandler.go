@@ -2,19 +2,27 @@ package Coordinator
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/myproject/shop/internal/Order"
+	rbac "github.com/myproject/shop/internal/Rbac"
+	shop "github.com/myproject/shop/internal/Shop"
+	"github.com/myproject/shop/pkg/middleware"
+	"gorm.io/gorm"
 )
 
 type TradeHandler struct {
 	service *CheckoutService
+	shops   *shop.ShopAuthorizer
 }
 
 type createOrderRequest struct {
 	UserID uint              `json:"user_id" binding:"required"`
 	Items  []createOrderItem `json:"items" binding:"required,dive"`
+	ShipTo *shop.GeoPoint    `json:"ship_to"` // 收货位置，用于选择最近的发货仓库
 }
 
 type createOrderItem struct {
@@ -25,8 +33,38 @@ type createOrderItem struct {
 	Quantity    int     `json:"quantity" binding:"required,min=1"`
 }
 
-func NewTradeHandler(srv *CheckoutService) *TradeHandler {
-	return &TradeHandler{service: srv}
+func NewTradeHandler(srv *CheckoutService, shops *shop.ShopAuthorizer) *TradeHandler {
+	return &TradeHandler{service: srv, shops: shops}
+}
+
+// RequireOrderShops 要求当前用户在订单涉及的每个店铺内都拥有 perm，用在商家处理订单的路由上
+func (h *TradeHandler) RequireOrderShops(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		o, err := h.service.orderService.GetOrderById(uint(id))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "order not found"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ids := make([]uint, len(o.OrderItems))
+		for i, item := range o.OrderItems {
+			ids[i] = item.ProductID
+		}
+		ok, err := h.shops.CanManageProducts(c, perm, ids...)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			return
+		}
+		c.Next()
+	}
 }
 
 func (h *TradeHandler) CreateOrder(c *gin.Context) {
@@ -50,8 +88,65 @@ func (h *TradeHandler) CreateOrder(c *gin.Context) {
 			Subtotal:    request.Items[i].Price * float64(request.Items[i].Quantity),
 		}
 	}
-	if err := h.service.PlaceOrder(context.Background(), &o); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.PlaceOrder(context.Background(), &o, request.ShipTo); err != nil {
+		switch {
+		case errors.Is(err, shop.ErrProductUnavailable), errors.Is(err, shop.ErrInsufficientStock):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+func getUserID(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(middleware.CtxUserIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(uint)
+	return id, ok
+}
+
+func writeRestockError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+	case errors.Is(err, ErrOrderForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// CancelOrder POST /orders/:id/cancel
+func (h *TradeHandler) CancelOrder(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	o, err := h.service.CancelOrder(c.Request.Context(), uint(id), userID, middleware.HasPermission(c, rbac.PermOrderAny))
+	if err != nil {
+		writeRestockError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// ReturnOrder POST /orders/:id/return，需要 order:return 权限
+func (h *TradeHandler) ReturnOrder(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	o, err := h.service.ReturnOrder(c.Request.Context(), uint(id), userID)
+	if err != nil {
+		writeRestockError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, o)
@@ -0,0 +1,204 @@
+package merchant
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/myproject/shop/pkg/middleware"
+	"gorm.io/gorm"
+)
+
+// maxUploadSize 整个申请表单（包括全部材料）的大小上限
+const maxUploadSize = maxDocuments*maxDocumentSize + 1<<20
+
+type MerchantHandler struct {
+	service *MerchantService
+}
+
+func NewMerchantHandler(service *MerchantService) *MerchantHandler {
+	return &MerchantHandler{service: service}
+}
+
+type submitApplicationReq struct {
+	BusinessName    string `form:"business_name" binding:"required,max=200"`
+	LicenseNumber   string `form:"license_number" binding:"required,max=100"`
+	ContactName     string `form:"contact_name" binding:"max=100"`
+	ContactPhone    string `form:"contact_phone" binding:"omitempty,phone"`
+	Address         string `form:"address" binding:"max=255"`
+	ShopName        string `form:"shop_name" binding:"required,max=100"`
+	ShopDescription string `form:"shop_description" binding:"max=255"`
+}
+
+type reviewReq struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+func getUserID(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(middleware.CtxUserIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(uint)
+	return id, ok
+}
+
+func writeMerchantError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+	case errors.Is(err, ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidDocument):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrApplicationPending), errors.Is(err, ErrAlreadyMerchant), errors.Is(err, ErrApplicationNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// SubmitApplication POST /api/v1/merchant/applications，multipart 表单，材料放在 documents 字段
+func (h *MerchantHandler) SubmitApplication(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+	var req submitApplicationReq
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	info := ApplicationInfo{
+		BusinessName:    req.BusinessName,
+		LicenseNumber:   req.LicenseNumber,
+		ContactName:     req.ContactName,
+		ContactPhone:    req.ContactPhone,
+		Address:         req.Address,
+		ShopName:        req.ShopName,
+		ShopDescription: req.ShopDescription,
+	}
+	app, err := h.service.Submit(c.Request.Context(), userID, info, form.File["documents"])
+	if err != nil {
+		writeMerchantError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"application": app})
+}
+
+// CurrentApplication GET /api/v1/merchant/applications/current，最近一次提交的申请
+func (h *MerchantHandler) CurrentApplication(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	app, err := h.service.Current(userID)
+	if err != nil {
+		writeMerchantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"application": app})
+}
+
+// ListApplications GET /api/admin/merchant-applications?status=pending&page=&page_size=
+func (h *MerchantHandler) ListApplications(c *gin.Context) {
+	status := ApplicationStatus(c.DefaultQuery("status", string(ApplicationPending)))
+	switch status {
+	case ApplicationPending, ApplicationApproved, ApplicationRejected:
+	case "all":
+		status = ""
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	apps, total, err := h.service.List(status, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if apps == nil {
+		apps = []Application{}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": apps, "total": total})
+}
+
+// GetApplication GET /api/admin/merchant-applications/:id
+func (h *MerchantHandler) GetApplication(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	app, err := h.service.Get(uint(id))
+	if err != nil {
+		writeMerchantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"application": app})
+}
+
+// GetDocument GET /api/admin/merchant-applications/:id/documents/:index，下载证明材料
+func (h *MerchantHandler) GetDocument(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document index"})
+		return
+	}
+	doc, rc, err := h.service.OpenDocument(c.Request.Context(), uint(id), index)
+	if err != nil {
+		writeMerchantError(c, err)
+		return
+	}
+	defer rc.Close()
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": doc.Name}))
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, doc.Size, doc.ContentType, rc, nil)
+}
+
+// ApproveApplication POST /api/admin/merchant-applications/:id/approve
+func (h *MerchantHandler) ApproveApplication(c *gin.Context) {
+	h.review(c, true)
+}
+
+// RejectApplication POST /api/admin/merchant-applications/:id/reject，必须说明原因
+func (h *MerchantHandler) RejectApplication(c *gin.Context) {
+	h.review(c, false)
+}
+
+func (h *MerchantHandler) review(c *gin.Context, approve bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req reviewReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	reviewerID, _ := getUserID(c)
+	var app *Application
+	var err error
+	if approve {
+		app, err = h.service.Approve(c.Request.Context(), uint(id), reviewerID, req.Reason)
+	} else {
+		if req.Reason == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required when rejecting"})
+			return
+		}
+		app, err = h.service.Reject(c.Request.Context(), uint(id), reviewerID, req.Reason)
+	}
+	if err != nil {
+		writeMerchantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"application": app})
+}
@@ -0,0 +1,44 @@
+package merchant
+
+import "time"
+
+type ApplicationStatus string
+
+const (
+	ApplicationPending  ApplicationStatus = "pending"  // 等待管理员审核
+	ApplicationApproved ApplicationStatus = "approved" // 已通过，用户成为商家并开出第一家店
+	ApplicationRejected ApplicationStatus = "rejected" // 未通过，可以重新申请
+)
+
+// Document 申请附带的证明材料，文件保存在 storage 中，不对外公开
+type Document struct {
+	Key         string `json:"-"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// Application 商家入驻申请，每个用户同时只能有一个待审核的申请
+type Application struct {
+	ID              uint              `gorm:"primaryKey" json:"id"`
+	UserID          uint              `gorm:"not null;index;uniqueIndex:idx_merchant_application_pending,where:status = 'pending'" json:"user_id"`
+	BusinessName    string            `gorm:"size:200;not null" json:"business_name"`  // 营业主体名称
+	LicenseNumber   string            `gorm:"size:100;not null" json:"license_number"` // 营业执照号
+	ContactName     string            `gorm:"size:100" json:"contact_name"`
+	ContactPhone    string            `gorm:"size:30" json:"contact_phone"`
+	Address         string            `gorm:"size:255" json:"address"`
+	ShopName        string            `gorm:"size:100;not null" json:"shop_name"` // 审核通过后创建的店铺
+	ShopDescription string            `gorm:"size:255" json:"shop_description"`
+	Documents       []Document        `gorm:"serializer:json" json:"documents"`
+	Status          ApplicationStatus `gorm:"size:16;not null;index" json:"status"`
+	ReviewReason    string            `gorm:"size:500" json:"review_reason,omitempty"`
+	ReviewedBy      uint              `json:"reviewed_by,omitempty"`
+	ReviewedAt      *time.Time        `json:"reviewed_at,omitempty"`
+	ShopID          uint              `json:"shop_id,omitempty"` // 审核通过时创建的店铺
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+func (Application) TableName() string {
+	return "merchant_applications"
+}
@@ -0,0 +1,86 @@
+package merchant
+
+import (
+	"time"
+
+	"github.com/myproject/shop/pkg/database"
+)
+
+type MerchantRepository struct {
+	Database *database.Database
+}
+
+func NewRepository(db *database.Database) *MerchantRepository {
+	return &MerchantRepository{Database: db}
+}
+
+func (r *MerchantRepository) Create(app *Application) error {
+	return r.Database.DB.Create(app).Error
+}
+
+func (r *MerchantRepository) Get(id uint) (*Application, error) {
+	var app Application
+	if err := r.Database.DB.First(&app, id).Error; err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// GetLatestByUser 用户最近一次提交的申请
+func (r *MerchantRepository) GetLatestByUser(userID uint) (*Application, error) {
+	var app Application
+	if err := r.Database.DB.Where("user_id = ?", userID).Order("id DESC").First(&app).Error; err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func (r *MerchantRepository) HasPending(userID uint) (bool, error) {
+	var n int64
+	err := r.Database.DB.Model(&Application{}).Where("user_id = ? AND status = ?", userID, ApplicationPending).Count(&n).Error
+	return n > 0, err
+}
+
+// List 审核队列，最早提交的在前
+func (r *MerchantRepository) List(status ApplicationStatus, limit, offset int) ([]Application, int64, error) {
+	query := r.Database.DB.Model(&Application{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var apps []Application
+	if err := query.Order("id").Limit(limit).Offset(offset).Find(&apps).Error; err != nil {
+		return nil, 0, err
+	}
+	return apps, total, nil
+}
+
+// Review 只能审核待审核的申请，返回是否更新成功；并发审核时只有一个管理员能成功
+func (r *MerchantRepository) Review(id uint, status ApplicationStatus, reason string, reviewerID uint, at time.Time) (bool, error) {
+	res := r.Database.DB.Model(&Application{}).Where("id = ? AND status = ?", id, ApplicationPending).
+		Updates(map[string]interface{}{"status": status, "review_reason": reason, "reviewed_by": reviewerID, "reviewed_at": at})
+	return res.RowsAffected > 0, res.Error
+}
+
+// Reopen 审核通过后开店或升级角色失败时把申请退回待审核，并解除与已删除店铺的关联
+func (r *MerchantRepository) Reopen(id uint) error {
+	return r.Database.DB.Model(&Application{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": ApplicationPending, "review_reason": "", "reviewed_by": 0, "reviewed_at": nil, "shop_id": 0}).Error
+}
+
+func (r *MerchantRepository) SetShopID(id, shopID uint) error {
+	return r.Database.DB.Model(&Application{}).Where("id = ?", id).Update("shop_id", shopID).Error
+}
+
+func (r *MerchantRepository) ListByUser(userID uint) ([]Application, error) {
+	var apps []Application
+	err := r.Database.DB.Where("user_id = ?", userID).Find(&apps).Error
+	return apps, err
+}
+
+func (r *MerchantRepository) DeleteByUser(userID uint) error {
+	return r.Database.DB.Where("user_id = ?", userID).Delete(&Application{}).Error
+}
@@ -0,0 +1,281 @@
+package merchant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	notification "github.com/myproject/shop/internal/Notification"
+	shop "github.com/myproject/shop/internal/Shop"
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/storage"
+)
+
+var (
+	ErrApplicationPending    = errors.New("an application is already pending review")
+	ErrAlreadyMerchant       = errors.New("user is already a merchant")
+	ErrApplicationNotPending = errors.New("application is not pending review")
+	ErrInvalidDocument       = errors.New("invalid document")
+	ErrDocumentNotFound      = errors.New("document not found")
+)
+
+const (
+	maxDocuments    = 5
+	maxDocumentSize = 10 << 20
+)
+
+// 允许上传的材料类型，按文件内容判断，不信任客户端声明的类型
+var documentExtensions = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+// ApplicationInfo 申请表单中的文字信息
+type ApplicationInfo struct {
+	BusinessName    string
+	LicenseNumber   string
+	ContactName     string
+	ContactPhone    string
+	Address         string
+	ShopName        string
+	ShopDescription string
+}
+
+type MerchantService struct {
+	repo     *MerchantRepository
+	users    *user.UserService
+	shops    *shop.ShopService
+	notifier *notification.NotificationService
+	storage  storage.Storage
+}
+
+func NewMerchantService(repo *MerchantRepository, userS *user.UserService, shopS *shop.ShopService, notifier *notification.NotificationService, store storage.Storage) *MerchantService {
+	return &MerchantService{repo: repo, users: userS, shops: shopS, notifier: notifier, storage: store}
+}
+
+// Submit 提交入驻申请。申请期间用户仍是普通顾客，审核通过后才升级为商家
+func (s *MerchantService) Submit(ctx context.Context, userID uint, info ApplicationInfo, files []*multipart.FileHeader) (*Application, error) {
+	u, err := s.users.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Role != user.RoleCustomer {
+		return nil, ErrAlreadyMerchant
+	}
+	pending, err := s.repo.HasPending(userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrApplicationPending
+	}
+	if len(files) == 0 || len(files) > maxDocuments {
+		return nil, fmt.Errorf("%w: between 1 and %d documents are required", ErrInvalidDocument, maxDocuments)
+	}
+	docs := make([]Document, 0, len(files))
+	for _, fh := range files {
+		doc, err := s.storeDocument(ctx, userID, fh)
+		if err != nil {
+			s.deleteDocuments(ctx, docs)
+			return nil, err
+		}
+		docs = append(docs, *doc)
+	}
+	app := &Application{
+		UserID:          userID,
+		BusinessName:    info.BusinessName,
+		LicenseNumber:   info.LicenseNumber,
+		ContactName:     info.ContactName,
+		ContactPhone:    info.ContactPhone,
+		Address:         info.Address,
+		ShopName:        info.ShopName,
+		ShopDescription: info.ShopDescription,
+		Documents:       docs,
+		Status:          ApplicationPending,
+	}
+	if err := s.repo.Create(app); err != nil {
+		s.deleteDocuments(ctx, docs)
+		return nil, err
+	}
+	return app, nil
+}
+
+func (s *MerchantService) storeDocument(ctx context.Context, userID uint, fh *multipart.FileHeader) (*Document, error) {
+	if fh.Size <= 0 || fh.Size > maxDocumentSize {
+		return nil, fmt.Errorf("%w: %s must be between 1 byte and %d MB", ErrInvalidDocument, fh.Filename, maxDocumentSize>>20)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := documentExtensions[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s must be a PDF, JPEG or PNG file", ErrInvalidDocument, fh.Filename)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("merchant/%d/%s%s", userID, uuid.NewString(), ext)
+	if err := s.storage.Put(ctx, key, f); err != nil {
+		return nil, err
+	}
+	return &Document{Key: key, Name: fh.Filename, ContentType: contentType, Size: fh.Size}, nil
+}
+
+func (s *MerchantService) deleteDocuments(ctx context.Context, docs []Document) {
+	for _, d := range docs {
+		if err := s.storage.Delete(ctx, d.Key); err != nil {
+			logger.Warn("merchant_document_delete_failed", map[string]interface{}{"key": d.Key, "error": err.Error()})
+		}
+	}
+}
+
+// Current 用户最近一次提交的申请
+func (s *MerchantService) Current(userID uint) (*Application, error) {
+	return s.repo.GetLatestByUser(userID)
+}
+
+func (s *MerchantService) Get(id uint) (*Application, error) {
+	return s.repo.Get(id)
+}
+
+// List 管理后台的审核队列，status 为空时返回全部
+func (s *MerchantService) List(status ApplicationStatus, page, pageSize int) ([]Application, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	return s.repo.List(status, pageSize, (page-1)*pageSize)
+}
+
+// OpenDocument 读取申请的第 index 份材料，调用方负责关闭
+func (s *MerchantService) OpenDocument(ctx context.Context, id uint, index int) (*Document, io.ReadCloser, error) {
+	app, err := s.repo.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if index < 0 || index >= len(app.Documents) {
+		return nil, nil, ErrDocumentNotFound
+	}
+	doc := app.Documents[index]
+	rc, err := s.storage.Open(ctx, doc.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &doc, rc, nil
+}
+
+// Approve 通过申请：创建已审核的店铺，再把用户升级为商家（同时吊销其会话，重新登录后按商家授权）
+func (s *MerchantService) Approve(ctx context.Context, id, reviewerID uint, reason string) (*Application, error) {
+	app, err := s.claim(id, ApplicationApproved, reviewerID, reason)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	sh := &shop.Shop{
+		Name:        app.ShopName,
+		Description: app.ShopDescription,
+		OwnerID:     app.UserID,
+		Status:      shop.ShopStatusApproved,
+		ReviewedBy:  reviewerID,
+		ReviewedAt:  &now,
+	}
+	if err := s.shops.CreateShop(ctx, sh); err != nil {
+		s.rollbackApproval(ctx, id, 0)
+		return nil, err
+	}
+	if err := s.repo.SetShopID(id, sh.ID); err != nil {
+		logger.Error("merchant_application_shop_link_failed", map[string]interface{}{"application_id": id, "shop_id": sh.ID, "error": err.Error()})
+	}
+	app.ShopID = sh.ID
+	if _, err := s.users.ChangeRole(ctx, reviewerID, app.UserID, user.RoleMerchant, "merchant application approved"); err != nil {
+		logger.Error("merchant_role_change_failed", map[string]interface{}{"application_id": id, "user_id": app.UserID, "error": err.Error()})
+		s.rollbackApproval(ctx, id, sh.ID)
+		return nil, err
+	}
+	s.notify(ctx, app, true)
+	return app, nil
+}
+
+// rollbackApproval 审核通过后开店或升级角色失败时撤销已完成的步骤：删除新建的店铺，把申请退回待审核，管理员可以重新审核
+func (s *MerchantService) rollbackApproval(ctx context.Context, id, shopID uint) {
+	if shopID != 0 {
+		err := s.shops.Delete(ctx, shopID)
+		if err == nil {
+			err = s.shops.PurgeShop(ctx, shopID)
+		}
+		if err != nil {
+			logger.Error("merchant_approval_shop_rollback_failed", map[string]interface{}{"application_id": id, "shop_id": shopID, "error": err.Error()})
+		}
+	}
+	if err := s.repo.Reopen(id); err != nil {
+		logger.Error("merchant_application_reopen_failed", map[string]interface{}{"application_id": id, "error": err.Error()})
+	}
+}
+
+// Reject 驳回申请，用户可以修改后重新申请
+func (s *MerchantService) Reject(ctx context.Context, id, reviewerID uint, reason string) (*Application, error) {
+	app, err := s.claim(id, ApplicationRejected, reviewerID, reason)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(ctx, app, false)
+	return app, nil
+}
+
+func (s *MerchantService) claim(id uint, status ApplicationStatus, reviewerID uint, reason string) (*Application, error) {
+	if _, err := s.repo.Get(id); err != nil {
+		return nil, err
+	}
+	ok, err := s.repo.Review(id, status, reason, reviewerID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrApplicationNotPending
+	}
+	return s.repo.Get(id)
+}
+
+func (s *MerchantService) notify(ctx context.Context, app *Application, approved bool) {
+	title := "商家入驻申请已通过"
+	content := fmt.Sprintf("您的店铺 %s 已开通，请重新登录后进入商家后台", app.ShopName)
+	if !approved {
+		title = "商家入驻申请未通过"
+		content = app.ReviewReason
+	}
+	if err := s.notifier.Notify(ctx, app.UserID, notification.TypeMerchantReview, title, content); err != nil {
+		logger.Warn("merchant_review_notify_failed", map[string]interface{}{"application_id": app.ID, "error": err.Error()})
+	}
+}
+
+// DeleteUserApplications 删除用户的全部申请和材料，注销账号时调用
+func (s *MerchantService) DeleteUserApplications(ctx context.Context, userID uint) error {
+	apps, err := s.repo.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, app := range apps {
+		s.deleteDocuments(ctx, app.Documents)
+	}
+	return s.repo.DeleteByUser(userID)
+}
@@ -0,0 +1,9 @@
+package merchant
+
+import "github.com/google/wire"
+
+var ProviderSet = wire.NewSet(
+	NewRepository,
+	NewMerchantService,
+	NewMerchantHandler,
+)
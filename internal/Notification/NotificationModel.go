@@ -0,0 +1,23 @@
+package notification
+
+import "gorm.io/gorm"
+
+type NotificationType string
+
+const (
+	TypePriceDrop      NotificationType = "price_drop"       // 关注商品降价
+	TypeLowStockDigest NotificationType = "low_stock_digest" // 店铺低库存每日汇总
+	TypeBackInStock    NotificationType = "back_in_stock"    // 收藏商品到货
+	TypeFavoriteOnSale NotificationType = "favorite_on_sale" // 收藏商品降价
+	TypeShopReview     NotificationType = "shop_review"      // 店铺审核结果
+	TypeMerchantReview NotificationType = "merchant_review"  // 商家入驻申请审核结果
+)
+
+type Notification struct {
+	gorm.Model
+	UserID  uint             `gorm:"index;not null"` // 接收者
+	Type    NotificationType `gorm:"size:32;index"`  // 通知类型
+	Title   string           `gorm:"size:255"`       // 标题
+	Content string           `gorm:"type:text"`      // 正文
+	IsRead  bool             `gorm:"default:false"`  // 是否已读
+}
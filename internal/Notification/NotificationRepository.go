@@ -0,0 +1,43 @@
+package notification
+
+import (
+	"context"
+
+	"github.com/myproject/shop/pkg/database"
+)
+
+type NotificationRepository struct {
+	Database *database.Database
+}
+
+func NewRepository(db *database.Database) *NotificationRepository {
+	return &NotificationRepository{Database: db}
+}
+
+func (r *NotificationRepository) Create(ctx context.Context, n *Notification) error {
+	return r.Database.DB.WithContext(ctx).Create(n).Error
+}
+
+func (r *NotificationRepository) ListByUser(ctx context.Context, userID uint, unreadOnly bool, limit, offset int) ([]Notification, error) {
+	var items []Notification
+	query := r.Database.DB.WithContext(ctx).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("is_read = ?", false)
+	}
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID, id uint) error {
+	return r.Database.DB.WithContext(ctx).Model(&Notification{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("is_read", true).Error
+}
+
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, userID uint) error {
+	return r.Database.DB.WithContext(ctx).Model(&Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		Update("is_read", true).Error
+}
@@ -0,0 +1,56 @@
+package notification
+
+import (
+	"context"
+	"errors"
+
+	"github.com/myproject/shop/pkg/logger"
+)
+
+// NotificationService 是站内通知的统一出口，其他模块通过 Notify 发送通知
+type NotificationService struct {
+	repo *NotificationRepository
+}
+
+func NewNotificationService(repo *NotificationRepository) *NotificationService {
+	return &NotificationService{repo: repo}
+}
+
+func (s *NotificationService) Notify(ctx context.Context, userID uint, typ NotificationType, title, content string) error {
+	if userID == 0 {
+		return errors.New("user id is required")
+	}
+	n := &Notification{
+		UserID:  userID,
+		Type:    typ,
+		Title:   title,
+		Content: content,
+	}
+	if err := s.repo.Create(ctx, n); err != nil {
+		logger.Error("notification_failed", map[string]interface{}{
+			"user_id": userID,
+			"type":    typ,
+			"error":   err.Error(),
+		})
+		return err
+	}
+	return nil
+}
+
+func (s *NotificationService) List(ctx context.Context, userID uint, unreadOnly bool, page, pageSize int) ([]Notification, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	return s.repo.ListByUser(ctx, userID, unreadOnly, pageSize, (page-1)*pageSize)
+}
+
+func (s *NotificationService) MarkRead(ctx context.Context, userID, id uint) error {
+	return s.repo.MarkRead(ctx, userID, id)
+}
+
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID uint) error {
+	return s.repo.MarkAllRead(ctx, userID)
+}
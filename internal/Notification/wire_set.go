@@ -0,0 +1,9 @@
+package notification
+
+import "github.com/google/wire"
+
+var ProviderSet = wire.NewSet(
+	NewRepository,
+	NewNotificationService,
+	NewNotificationHandler,
+)
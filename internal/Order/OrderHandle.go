@@ -1,12 +1,14 @@
 package Order
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/myproject/shop/pkg/middleware"
+	"gorm.io/gorm"
 )
 
 type OrderHandler struct {
@@ -31,7 +33,7 @@ type createOrderItem struct {
 }
 
 type updateStatusReq struct {
-	Status OrderStatus `json:"status" binding:"required"`
+	Status OrderStatus `json:"status" binding:"required,oneof=shipped delivered completed"`
 }
 
 type batchDeleteReq struct {
@@ -114,8 +116,15 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.service.UpdateStatus(uint(id), req.Status); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.UpdateStatus(c.Request.Context(), uint(id), req.Status); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		case errors.Is(err, ErrInvalidStatusTransition):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "status updated"})
@@ -123,7 +132,7 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 
 func (h *OrderHandler) DeleteOrder(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := h.service.Delete(uint(id)); err != nil {
+	if err := h.service.Delete(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "order deleted"})
@@ -135,7 +144,7 @@ func (h *OrderHandler) BatchDeleteOrders(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.service.BatchDelete(req.IDs); err != nil {
+	if err := h.service.BatchDelete(c.Request.Context(), req.IDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -18,6 +18,13 @@ const (
 	OrderStatusRefunded  OrderStatus = "refunded"
 )
 
+// fulfilmentFrom 发货流程中每个状态的前一个状态；取消和退款只能通过 CheckoutService 完成，以便返还库存
+var fulfilmentFrom = map[OrderStatus]OrderStatus{
+	OrderStatusShipped:   OrderStatusPaid,
+	OrderStatusDelivered: OrderStatusShipped,
+	OrderStatusCompleted: OrderStatusDelivered,
+}
+
 type Order struct {
 	gorm.Model
 	OrderID        string      `gorm:"uniqueIndex;size:64"`
@@ -47,4 +54,5 @@ type OrderItem struct {
 	Price       float64 `gorm:"type:decimal(10,2)"`
 	Quantity    int
 	Subtotal    float64 `gorm:"type:decimal(10,2)"`
+	WarehouseID uint    `gorm:"index"` // 发货仓库，0 表示店铺未启用多仓
 }
\ No newline at end of file
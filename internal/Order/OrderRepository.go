@@ -6,6 +6,7 @@ import (
 
 	"github.com/myproject/shop/pkg/database"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderRepository struct {
@@ -69,8 +70,34 @@ func (r *OrderRepository) CreateWithTx(ctx context.Context, tx *gorm.DB, o *Orde
 	return nil
 }
 
-func (r *OrderRepository) UpdateStatus(id uint, status OrderStatus) error {
-	return r.Database.DB.Model(&Order{}).Where("id = ?", id).Update("status", status).Error
+// GetForUpdateWithTx 在事务内加锁读取订单及订单项
+func (r *OrderRepository) GetForUpdateWithTx(ctx context.Context, tx *gorm.DB, id uint) (*Order, error) {
+	db := r.Database.DB
+	if tx != nil {
+		db = tx
+	}
+	var o Order
+	if err := db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&o, id).Error; err != nil {
+		return nil, err
+	}
+	if err := db.WithContext(ctx).Where("order_id = ?", o.ID).Find(&o.OrderItems).Error; err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (r *OrderRepository) UpdateStatusWithTx(ctx context.Context, tx *gorm.DB, id uint, status OrderStatus) error {
+	db := r.Database.DB
+	if tx != nil {
+		db = tx
+	}
+	return db.WithContext(ctx).Model(&Order{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// TransitionStatus 只在订单仍处于 from 时改为 to，返回是否更新成功；并发修改时只有一个请求能成功
+func (r *OrderRepository) TransitionStatus(id uint, from, to OrderStatus) (bool, error) {
+	res := r.Database.DB.Model(&Order{}).Where("id = ? AND status = ?", id, from).Update("status", to)
+	return res.RowsAffected > 0, res.Error
 }
 
 func (r *OrderRepository) Delete(id uint) error {
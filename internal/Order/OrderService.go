@@ -4,15 +4,19 @@ import (
 	"context"
 	"errors"
 
+	audit "github.com/myproject/shop/internal/Audit"
 	"gorm.io/gorm"
 )
 
+var ErrInvalidStatusTransition = errors.New("order status cannot change to the requested status")
+
 type OrderService struct {
-	rep *OrderRepository
+	rep   *OrderRepository
+	audit *audit.AuditService
 }
 
-func NewOrderService(rep *OrderRepository) *OrderService {
-	return &OrderService{rep: rep}
+func NewOrderService(rep *OrderRepository, auditor *audit.AuditService) *OrderService {
+	return &OrderService{rep: rep, audit: auditor}
 }
 func (s *OrderService) List(limit, offset int) ([]Order, error) {
 	if limit <= 0 {
@@ -41,14 +45,80 @@ func (s *OrderService) CreateOrderWithTx(ctx context.Context, tx *gorm.DB, o *Or
 	return s.rep.CreateWithTx(ctx, tx, o)
 }
 
-func (s *OrderService) UpdateStatus(id uint, status OrderStatus) error {
-	return s.rep.UpdateStatus(id, status)
+func (s *OrderService) GetForUpdateWithTx(ctx context.Context, tx *gorm.DB, id uint) (*Order, error) {
+	return s.rep.GetForUpdateWithTx(ctx, tx, id)
+}
+
+func (s *OrderService) UpdateStatusWithTx(ctx context.Context, tx *gorm.DB, id uint, status OrderStatus) error {
+	return s.rep.UpdateStatusWithTx(ctx, tx, id, status)
+}
+
+// UpdateStatus 推进发货流程（已支付→已发货→已签收→已完成）；取消和退款走 CheckoutService
+func (s *OrderService) UpdateStatus(ctx context.Context, id uint, status OrderStatus) error {
+	from, ok := fulfilmentFrom[status]
+	if !ok {
+		return ErrInvalidStatusTransition
+	}
+	o, err := s.rep.Get(id)
+	if err != nil {
+		return err
+	}
+	if o.Status != from {
+		return ErrInvalidStatusTransition
+	}
+	updated, err := s.rep.TransitionStatus(id, from, status)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrInvalidStatusTransition
+	}
+	o.Status = status
+	s.RecordStatusChange(ctx, o, 0, from, nil)
+	return nil
+}
+
+// RecordStatusChange 记录订单从 from 变为当前状态。事务内修改状态的调用方应在提交之后调用
+func (s *OrderService) RecordStatusChange(ctx context.Context, o *Order, actorID uint, from OrderStatus, detail map[string]interface{}) {
+	if detail == nil {
+		detail = map[string]interface{}{}
+	}
+	detail["order_no"] = o.OrderID
+	s.audit.Record(ctx, audit.Entry{
+		ActorID: actorID, Action: audit.ActionStatusChange, ResourceType: audit.ResourceOrder, ResourceID: audit.ID(o.ID),
+		Before: map[string]interface{}{"status": from}, After: map[string]interface{}{"status": o.Status},
+		Detail: detail,
+	})
+}
+
+func (s *OrderService) Delete(ctx context.Context, id uint) error {
+	o, _ := s.rep.Get(id)
+	if err := s.rep.Delete(id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionDelete, ResourceType: audit.ResourceOrder, ResourceID: audit.ID(id), Before: orderAuditView(o)})
+	return nil
 }
 
-func (s *OrderService) Delete(id uint) error {
-	return s.rep.Delete(id)
+func (s *OrderService) BatchDelete(ctx context.Context, ids []uint) error {
+	if err := s.rep.BatchDelete(ids); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.audit.Record(ctx, audit.Entry{Action: audit.ActionDelete, ResourceType: audit.ResourceOrder, ResourceID: audit.ID(id), Detail: map[string]interface{}{"batch": len(ids)}})
+	}
+	return nil
 }
 
-func (s *OrderService) BatchDelete(ids []uint) error {
-	return s.rep.BatchDelete(ids)
+// orderAuditView 审计日志中记录的订单字段，不包含收货人信息
+func orderAuditView(o *Order) map[string]interface{} {
+	if o == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"order_no":      o.OrderID,
+		"user_id":       o.UserID,
+		"status":        o.Status,
+		"actual_amount": o.ActualAmount,
+	}
 }
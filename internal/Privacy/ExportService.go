@@ -0,0 +1,75 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	user "github.com/myproject/shop/internal/User"
+)
+
+// Export 打包用户的个人数据：每类数据一个 JSON 文件，放在同一个 ZIP 里
+func (s *PrivacyService) Export(ctx context.Context, userID uint) ([]byte, error) {
+	u, err := s.repo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := s.repo.ListOrders(userID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.ListCartItems(userID)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := s.repo.ListComments(userID)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := s.repo.ListMessages(userID)
+	if err != nil {
+		return nil, err
+	}
+	addresses := []Address{}
+	seen := make(map[Address]bool)
+	for _, o := range orders {
+		a := Address{Name: o.ShippingName, Phone: o.ShippingPhone, Address: o.ShippingAddress, ZipCode: o.ShippingZipCode}
+		if a.Address == "" || seen[a] {
+			continue
+		}
+		seen[a] = true
+		addresses = append(addresses, a)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user.NewUserResponse(u)},
+		{"addresses.json", addresses},
+		{"orders.json", orders},
+		{"cart.json", items},
+		{"comments.json", comments},
+		{"messages.json", msgs},
+	}
+	now := time.Now()
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
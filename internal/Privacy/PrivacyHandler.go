@@ -0,0 +1,138 @@
+package privacy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/myproject/shop/internal/Auth"
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/middleware"
+	"github.com/myproject/shop/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type PrivacyHandler struct {
+	service *PrivacyService
+}
+
+func NewPrivacyHandler(service *PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{service: service}
+}
+
+// deletionReq 提供 password、two_factor_code、token（注销确认邮件）其中一项即可
+type deletionReq struct {
+	Password      string `json:"password"`
+	TwoFactorCode string `json:"two_factor_code"`
+	Token         string `json:"token"`
+}
+
+func getUserID(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(middleware.CtxUserIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(uint)
+	return id, ok
+}
+
+func writePrivacyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, ErrNoDeletionPending):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, user.ErrWrongPassword), errors.Is(err, auth.ErrInvalidTwoFactorCode), errors.Is(err, utils.ErrInvalidEmailToken):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrReauthRequired), errors.Is(err, auth.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrEmailRateLimited):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrDeletionPending), errors.Is(err, ErrOwnsShops):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// Export POST /api/v1/me/export，下载个人数据的 ZIP 包
+func (h *PrivacyHandler) Export(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	data, err := h.service.Export(c.Request.Context(), userID)
+	if err != nil {
+		writePrivacyError(c, err)
+		return
+	}
+	filename := fmt.Sprintf("personal-data-%d-%s.zip", userID, time.Now().Format("20060102"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", data)
+}
+
+// RequestDeletion DELETE /api/v1/me，申请注销账号，冷静期结束后执行
+func (h *PrivacyHandler) RequestDeletion(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var req deletionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	deletion, err := h.service.RequestDeletion(c.Request.Context(), userID, Reauth{Password: req.Password, TwoFactorCode: req.TwoFactorCode, EmailToken: req.Token})
+	if err != nil {
+		writePrivacyError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"deletion": deletion})
+}
+
+// SendDeletionConfirmation POST /api/v1/me/deletion/confirmation，发送注销确认邮件，
+// 邮件中的 token 可以代替密码申请注销
+func (h *PrivacyHandler) SendDeletionConfirmation(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if err := h.service.SendDeletionConfirmation(c.Request.Context(), userID); err != nil {
+		writePrivacyError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "confirmation email sent"})
+}
+
+// GetDeletion GET /api/v1/me/deletion，没有进行中的申请时 deletion 为 null
+func (h *PrivacyHandler) GetDeletion(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	deletion, err := h.service.GetDeletion(userID)
+	if err != nil {
+		writePrivacyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deletion": deletion})
+}
+
+// CancelDeletion DELETE /api/v1/me/deletion，冷静期内撤销注销申请
+func (h *PrivacyHandler) CancelDeletion(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if err := h.service.CancelDeletion(userID); err != nil {
+		writePrivacyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,30 @@
+package privacy
+
+import "time"
+
+// 注销申请状态
+const (
+	DeletionPending   = "pending"   // 冷静期中，到期后执行
+	DeletionCancelled = "cancelled" // 用户在冷静期内撤销
+	DeletionCompleted = "completed" // 个人数据已删除或匿名化
+)
+
+// DeletionRequest 账号注销申请。执行后只保留用户ID和时间，作为已处理的凭证
+type DeletionRequest struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index;uniqueIndex:idx_deletion_pending,where:status = 'pending'" json:"user_id"`
+	Status      string     `gorm:"size:20;not null;index" json:"status"`
+	ScheduledAt time.Time  `gorm:"not null;index" json:"scheduled_at"` // 冷静期结束、开始执行的时间
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Address 从订单收货信息中整理出的地址，系统没有单独的地址簿
+type Address struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Address string `json:"address"`
+	ZipCode string `json:"zip_code"`
+}
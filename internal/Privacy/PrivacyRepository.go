@@ -0,0 +1,156 @@
+package privacy
+
+import (
+	"time"
+
+	auth "github.com/myproject/shop/internal/Auth"
+	cart "github.com/myproject/shop/internal/Cart"
+	chat "github.com/myproject/shop/internal/Chat"
+	comment "github.com/myproject/shop/internal/Comment"
+	notification "github.com/myproject/shop/internal/Notification"
+	"github.com/myproject/shop/internal/Order"
+	rbac "github.com/myproject/shop/internal/Rbac"
+	shop "github.com/myproject/shop/internal/Shop"
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/database"
+	"gorm.io/gorm"
+)
+
+// anonymized 匿名化后写入姓名、地址等文本字段的占位值
+const anonymized = "[deleted]"
+
+type PrivacyRepository struct {
+	Database *database.Database
+}
+
+func NewRepository(db *database.Database) *PrivacyRepository {
+	return &PrivacyRepository{Database: db}
+}
+
+func (r *PrivacyRepository) CreateDeletionRequest(req *DeletionRequest) error {
+	return r.Database.DB.Create(req).Error
+}
+
+// GetPendingDeletion 用户进行中的注销申请，没有时返回 gorm.ErrRecordNotFound
+func (r *PrivacyRepository) GetPendingDeletion(userID uint) (*DeletionRequest, error) {
+	var req DeletionRequest
+	if err := r.Database.DB.Where("user_id = ? AND status = ?", userID, DeletionPending).First(&req).Error; err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// CancelDeletion 返回是否撤销了一个进行中的申请
+func (r *PrivacyRepository) CancelDeletion(userID uint, at time.Time) (bool, error) {
+	res := r.Database.DB.Model(&DeletionRequest{}).
+		Where("user_id = ? AND status = ?", userID, DeletionPending).
+		Updates(map[string]interface{}{"status": DeletionCancelled, "cancelled_at": at})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ListDueDeletions 冷静期已结束、等待执行的申请
+func (r *PrivacyRepository) ListDueDeletions(now time.Time, limit int) ([]DeletionRequest, error) {
+	var reqs []DeletionRequest
+	err := r.Database.DB.Where("status = ? AND scheduled_at <= ?", DeletionPending, now).
+		Order("scheduled_at").Limit(limit).Find(&reqs).Error
+	return reqs, err
+}
+
+// OwnsShops 用户名下是否还有店铺
+func (r *PrivacyRepository) OwnsShops(userID uint) (bool, error) {
+	return ownsShopsTx(r.Database.DB, userID)
+}
+
+func ownsShopsTx(tx *gorm.DB, userID uint) (bool, error) {
+	var n int64
+	err := tx.Model(&shop.Shop{}).Where("owner_id = ?", userID).Count(&n).Error
+	return n > 0, err
+}
+
+func (r *PrivacyRepository) GetUser(userID uint) (*user.User, error) {
+	var u user.User
+	if err := r.Database.DB.First(&u, userID).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ListOrders 包括用户已删除的订单
+func (r *PrivacyRepository) ListOrders(userID uint) ([]Order.Order, error) {
+	var orders []Order.Order
+	err := r.Database.DB.Unscoped().Preload("OrderItems").Where("user_id = ?", userID).Order("id").Find(&orders).Error
+	return orders, err
+}
+
+func (r *PrivacyRepository) ListCartItems(userID uint) ([]cart.CartItem, error) {
+	var items []cart.CartItem
+	err := r.Database.DB.Where("user_id = ?", userID).Order("id").Find(&items).Error
+	return items, err
+}
+
+func (r *PrivacyRepository) ListComments(userID uint) ([]comment.Comment, error) {
+	var comments []comment.Comment
+	err := r.Database.DB.Where("user_id = ?", userID).Order("id").Find(&comments).Error
+	return comments, err
+}
+
+// userMessages 用户发出或收到的聊天消息
+func userMessages(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Where("(from_id = ? AND sender_type = ?) OR (to_id = ? AND sender_type = ?)",
+		userID, chat.UserSender, userID, chat.ShopSender)
+}
+
+func (r *PrivacyRepository) ListMessages(userID uint) ([]chat.Message, error) {
+	var msgs []chat.Message
+	err := userMessages(r.Database.DB, userID).Order("id").Find(&msgs).Error
+	return msgs, err
+}
+
+// Erase 在一个事务里删除用户的个人数据并完成注销申请。订单和评论用于对账和店铺评价，
+// 只解除与用户的关联并清除收货信息；其余数据和用户本身直接物理删除
+func (r *PrivacyRepository) Erase(userID, requestID uint, at time.Time) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		// 事务内再确认一次，避免检查之后新建的店铺失去店主
+		if owns, err := ownsShopsTx(tx, userID); err != nil {
+			return err
+		} else if owns {
+			return ErrOwnsShops
+		}
+		if err := tx.Unscoped().Model(&Order.Order{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"user_id":           0,
+			"shipping_name":     anonymized,
+			"shipping_phone":    "",
+			"shipping_address":  anonymized,
+			"shipping_zip_code": "",
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&comment.Comment{}).Where("user_id = ?", userID).Update("user_id", 0).Error; err != nil {
+			return err
+		}
+		if err := userMessages(tx.Unscoped(), userID).Delete(&chat.Message{}).Error; err != nil {
+			return err
+		}
+		deletes := []interface{}{
+			&chat.Conversation{},
+			&cart.CartItem{},
+			&notification.Notification{},
+			&shop.PriceAlert{},
+			&shop.APIKey{},
+			&rbac.ShopStaff{},
+			&auth.Identity{},
+			&auth.TwoFactor{},
+			&auth.RecoveryCode{},
+		}
+		for _, model := range deletes {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Delete(&user.User{}, userID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&DeletionRequest{}).Where("id = ?", requestID).
+			Updates(map[string]interface{}{"status": DeletionCompleted, "completed_at": at}).Error
+	})
+}
@@ -0,0 +1,168 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	auth "github.com/myproject/shop/internal/Auth"
+	merchant "github.com/myproject/shop/internal/Merchant"
+	shop "github.com/myproject/shop/internal/Shop"
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/middleware"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDeletionPending   = errors.New("account deletion is already scheduled")
+	ErrNoDeletionPending = errors.New("no pending account deletion")
+	ErrOwnsShops         = errors.New("close or transfer your shops before deleting the account")
+	ErrReauthRequired    = errors.New("password, two-factor code or confirmation token is required")
+)
+
+// Reauth 注销账号前确认身份，提供其中一项即可。通过 OIDC 注册的账号没有可用的密码，
+// 可以使用两步验证码，或先申请注销确认邮件再提交其中的 token
+type Reauth struct {
+	Password      string
+	TwoFactorCode string
+	EmailToken    string
+}
+
+const erasureBatchSize = 20
+
+var coolingOff = 14 * 24 * time.Hour
+
+// ConfigureCoolingOff 设置注销申请的冷静期
+func ConfigureCoolingOff(d time.Duration) {
+	if d > 0 {
+		coolingOff = d
+	}
+}
+
+type PrivacyService struct {
+	repo      *PrivacyRepository
+	users     *user.UserService
+	auth      *auth.AuthService
+	shops     *shop.ShopService
+	merchants *merchant.MerchantService
+}
+
+func NewPrivacyService(repo *PrivacyRepository, userS *user.UserService, authS *auth.AuthService, shopS *shop.ShopService, merchantS *merchant.MerchantService) *PrivacyService {
+	return &PrivacyService{repo: repo, users: userS, auth: authS, shops: shopS, merchants: merchantS}
+}
+
+// RequestDeletion 申请注销账号，需要先确认身份。冷静期内账号照常可用，用户可以随时撤销
+func (s *PrivacyService) RequestDeletion(ctx context.Context, userID uint, reauth Reauth) (*DeletionRequest, error) {
+	if err := s.reauthenticate(ctx, userID, reauth); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetPendingDeletion(userID); err == nil {
+		return nil, ErrDeletionPending
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	owns, err := s.repo.OwnsShops(userID)
+	if err != nil {
+		return nil, err
+	}
+	if owns {
+		return nil, ErrOwnsShops
+	}
+	req := &DeletionRequest{UserID: userID, Status: DeletionPending, ScheduledAt: time.Now().Add(coolingOff)}
+	if err := s.repo.CreateDeletionRequest(req); err != nil {
+		return nil, err
+	}
+	logger.Info("account_deletion_requested", map[string]interface{}{"user_id": userID, "scheduled_at": req.ScheduledAt})
+	return req, nil
+}
+
+func (s *PrivacyService) reauthenticate(ctx context.Context, userID uint, reauth Reauth) error {
+	switch {
+	case reauth.Password != "":
+		return s.users.CheckPassword(userID, reauth.Password)
+	case reauth.TwoFactorCode != "":
+		return s.auth.VerifyTwoFactorCode(userID, reauth.TwoFactorCode)
+	case reauth.EmailToken != "":
+		return s.auth.ConfirmDeletion(ctx, userID, reauth.EmailToken)
+	default:
+		return ErrReauthRequired
+	}
+}
+
+// SendDeletionConfirmation 发送注销确认邮件，供没有可用密码的账号确认身份
+func (s *PrivacyService) SendDeletionConfirmation(ctx context.Context, userID uint) error {
+	return s.auth.SendDeletionConfirmation(ctx, userID)
+}
+
+// GetDeletion 进行中的注销申请，没有时返回 nil
+func (s *PrivacyService) GetDeletion(userID uint) (*DeletionRequest, error) {
+	req, err := s.repo.GetPendingDeletion(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return req, err
+}
+
+func (s *PrivacyService) CancelDeletion(userID uint) error {
+	ok, err := s.repo.CancelDeletion(userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoDeletionPending
+	}
+	logger.Info("account_deletion_cancelled", map[string]interface{}{"user_id": userID})
+	return nil
+}
+
+// RunDueDeletions 由后台任务调用，执行冷静期已结束的注销申请；单个用户失败不影响其他用户，下一轮重试
+func (s *PrivacyService) RunDueDeletions(ctx context.Context) error {
+	reqs, err := s.repo.ListDueDeletions(time.Now(), erasureBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, req := range reqs {
+		if err := s.erase(ctx, req); errors.Is(err, ErrOwnsShops) {
+			logger.Warn("account_erasure_postponed", map[string]interface{}{"user_id": req.UserID, "request_id": req.ID, "reason": err.Error()})
+			continue
+		} else if err != nil {
+			logger.Error("account_erasure_failed", map[string]interface{}{"user_id": req.UserID, "request_id": req.ID, "error": err.Error()})
+			continue
+		}
+		logger.Info("account_erased", map[string]interface{}{"user_id": req.UserID, "request_id": req.ID})
+	}
+	return nil
+}
+
+func (s *PrivacyService) erase(ctx context.Context, req DeletionRequest) error {
+	// 冷静期内用户可能又开了店或被转让了店铺；保持待执行状态，店铺关闭或转让后下一轮再执行
+	owns, err := s.repo.OwnsShops(req.UserID)
+	if err != nil {
+		return err
+	}
+	if owns {
+		return ErrOwnsShops
+	}
+	// 收藏和浏览记录有 Redis 缓存，通过店铺模块清理，再删除数据库中的其余数据
+	if err := s.shops.ClearUserFavorites(ctx, req.UserID); err != nil {
+		return err
+	}
+	if err := s.shops.ClearHistory(ctx, req.UserID); err != nil {
+		return err
+	}
+	// 入驻申请的证明材料保存在 storage 中
+	if err := s.merchants.DeleteUserApplications(ctx, req.UserID); err != nil {
+		return err
+	}
+	if err := s.repo.Erase(req.UserID, req.ID, time.Now()); err != nil {
+		return err
+	}
+	if err := s.auth.RevokeAllSessions(ctx, req.UserID); err != nil {
+		logger.Error("revoke_sessions_after_erasure_failed", map[string]interface{}{"user_id": req.UserID, "error": err.Error()})
+	}
+	if err := middleware.UnblockAccount(ctx, req.UserID); err != nil {
+		logger.Error("account_unblock_marker_failed", map[string]interface{}{"user_id": req.UserID, "error": err.Error()})
+	}
+	return nil
+}
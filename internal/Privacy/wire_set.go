@@ -0,0 +1,9 @@
+package privacy
+
+import "github.com/google/wire"
+
+var ProviderSet = wire.NewSet(
+	NewRepository,
+	NewPrivacyService,
+	NewPrivacyHandler,
+)
@@ -0,0 +1,135 @@
+package rbac
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RbacHandler struct {
+	svc *RbacService
+}
+
+func NewRbacHandler(svc *RbacService) *RbacHandler {
+	return &RbacHandler{svc: svc}
+}
+
+type createRoleReq struct {
+	Name        string   `json:"name" binding:"required,max=64"`
+	Description string   `json:"description" binding:"max=255"`
+	ShopScoped  bool     `json:"shop_scoped"`
+	Permissions []string `json:"permissions"`
+}
+
+type updateRoleReq struct {
+	Name             string `json:"name" binding:"required,max=64"`
+	Description      string `json:"description" binding:"max=255"`
+	RequireTwoFactor *bool  `json:"require_two_factor"`
+}
+
+type rolePermissionsReq struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+func writeRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrStaffNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrBuiltInRole), errors.Is(err, ErrRoleInUse), errors.Is(err, ErrAdminLockout):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUnknownPermission), errors.Is(err, ErrNotShopRole), errors.Is(err, ErrNotShopPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListPermissions GET /admin/permissions
+func (h *RbacHandler) ListPermissions(c *gin.Context) {
+	perms, err := h.svc.ListPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, perms)
+}
+
+// ListRoles GET /admin/roles
+func (h *RbacHandler) ListRoles(c *gin.Context) {
+	roles, err := h.svc.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRole GET /admin/roles/:id
+func (h *RbacHandler) GetRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	role, err := h.svc.GetRole(uint(id))
+	if err != nil {
+		writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole POST /admin/roles
+func (h *RbacHandler) CreateRole(c *gin.Context) {
+	var req createRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := h.svc.CreateRole(req.Name, req.Description, req.ShopScoped, req.Permissions)
+	if err != nil {
+		writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// UpdateRole PATCH /admin/roles/:id，可同时设置该角色是否强制两步验证
+func (h *RbacHandler) UpdateRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req updateRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := h.svc.UpdateRole(uint(id), req.Name, req.Description, req.RequireTwoFactor)
+	if err != nil {
+		writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// SetRolePermissions PUT /admin/roles/:id/permissions，整体替换角色的权限
+func (h *RbacHandler) SetRolePermissions(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req rolePermissionsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := h.svc.SetRolePermissions(c.Request.Context(), uint(id), req.Permissions)
+	if err != nil {
+		writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole DELETE /admin/roles/:id，内置角色和仍在使用的角色不能删除
+func (h *RbacHandler) DeleteRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.DeleteRole(c.Request.Context(), uint(id)); err != nil {
+		writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "role deleted"})
+}
@@ -0,0 +1,110 @@
+package rbac
+
+import (
+	"time"
+
+	user "github.com/myproject/shop/internal/User"
+)
+
+// 权限码，格式为 资源:动作
+const (
+	PermShopCreate      = "shop:create"      // 开店
+	PermShopWrite       = "shop:write"       // 修改、删除店铺，管理回收站
+	PermShopAny         = "shop:any"         // 不限店主，管理任意店铺
+	PermProductWrite    = "product:write"    // 新建、修改、上下架、删除商品
+	PermInventoryWrite  = "inventory:write"  // 库存、仓库和库存提醒
+	PermOrderShip       = "order:ship"       // 更新订单履约状态
+	PermOrderReturn     = "order:return"     // 确认退货入库
+	PermOrderAny        = "order:any"        // 处理任意用户的订单
+	PermCommentModerate = "comment:moderate" // 删除他人评论
+	PermStaffManage     = "staff:manage"     // 管理店铺员工
+	PermRoleManage      = "role:manage"      // 管理角色和权限
+	PermUserManage      = "user:manage"      // 管理用户账号
+	PermMerchantReview  = "merchant:review"  // 审核商家入驻申请和新开店铺
+	PermAuditRead       = "audit:read"       // 查看审计日志
+)
+
+// Permission 权限定义，由代码中的权限码在启动时同步到数据库
+type Permission struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Code        string `gorm:"size:64;not null;uniqueIndex" json:"code"`
+	Description string `gorm:"size:255" json:"description"`
+}
+
+// Role 角色。内置角色的ID与 user.RoleCustomer/RoleMerchant/RoleAdmin 一致，User.Role 即角色ID；
+// ShopScoped 的角色只能分配给店铺员工，权限只在所属店铺内生效；
+// RequireTwoFactor 的角色的用户必须启用两步验证才能登录
+type Role struct {
+	ID               uint         `gorm:"primaryKey" json:"id"`
+	Name             string       `gorm:"size:64;not null;uniqueIndex" json:"name"`
+	Description      string       `gorm:"size:255" json:"description"`
+	BuiltIn          bool         `gorm:"default:false" json:"built_in"`
+	ShopScoped       bool         `gorm:"default:false" json:"shop_scoped"`
+	RequireTwoFactor bool         `gorm:"default:false" json:"require_two_factor"`
+	Permissions      []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+}
+
+// ShopStaff 店铺员工，按分配的角色在该店铺内拥有有限的权限
+type ShopStaff struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ShopID    uint      `gorm:"not null;uniqueIndex:idx_shop_staff" json:"shop_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_shop_staff;index" json:"user_id"`
+	RoleID    uint      `gorm:"not null" json:"role_id"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RoleShopStaff 内置的店铺员工角色
+const RoleShopStaff = "shop_staff"
+
+var permissionDescriptions = map[string]string{
+	PermShopCreate:      "开店",
+	PermShopWrite:       "修改、删除店铺，管理回收站",
+	PermShopAny:         "管理任意店铺",
+	PermProductWrite:    "管理商品",
+	PermInventoryWrite:  "管理库存和仓库",
+	PermOrderShip:       "更新订单履约状态",
+	PermOrderReturn:     "确认退货入库",
+	PermOrderAny:        "处理任意用户的订单",
+	PermCommentModerate: "删除他人评论",
+	PermStaffManage:     "管理店铺员工",
+	PermRoleManage:      "管理角色和权限",
+	PermUserManage:      "管理用户账号",
+	PermMerchantReview:  "审核商家入驻申请和新开店铺",
+	PermAuditRead:       "查看审计日志",
+}
+
+// shopPermissions 店铺级权限：只有这些权限可以授予店铺员工角色，员工角色的权限也只有这些会生效
+var shopPermissions = map[string]bool{
+	PermShopWrite:       true,
+	PermProductWrite:    true,
+	PermInventoryWrite:  true,
+	PermOrderShip:       true,
+	PermOrderReturn:     true,
+	PermCommentModerate: true,
+	PermStaffManage:     true,
+}
+
+// defaultRole 内置角色及其初始权限；管理员之后对权限的修改不会在重启时被覆盖
+type defaultRole struct {
+	ID          uint // 0 表示自增
+	Name        string
+	Description string
+	ShopScoped  bool
+	Permissions []string
+}
+
+var defaultRoles = []defaultRole{
+	{ID: user.RoleCustomer, Name: "customer", Description: "顾客"},
+	{ID: user.RoleMerchant, Name: "merchant", Description: "商家", Permissions: []string{
+		PermShopCreate, PermShopWrite, PermProductWrite, PermInventoryWrite,
+		PermOrderShip, PermOrderReturn, PermCommentModerate, PermStaffManage,
+	}},
+	{ID: user.RoleAdmin, Name: "admin", Description: "管理员"}, // 拥有全部权限
+	{Name: RoleShopStaff, Description: "店铺员工", ShopScoped: true, Permissions: []string{
+		PermProductWrite, PermInventoryWrite, PermOrderShip,
+	}},
+}
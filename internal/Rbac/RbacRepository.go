@@ -0,0 +1,192 @@
+package rbac
+
+import (
+	"errors"
+	"sort"
+
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RbacRepository struct {
+	Database *database.Database
+}
+
+func NewRepository(db *database.Database) *RbacRepository {
+	return &RbacRepository{Database: db}
+}
+
+// SeedDefaults 同步代码中的权限码和内置角色：新权限码授予管理员以及默认包含它的内置角色，
+// 已存在的角色的权限不会被改动
+func SeedDefaults(db *gorm.DB) error {
+	codes := make([]string, 0, len(permissionDescriptions))
+	for code := range permissionDescriptions {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return db.Transaction(func(tx *gorm.DB) error {
+		added := make(map[string]bool)
+		for _, code := range codes {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Permission{Code: code, Description: permissionDescriptions[code]})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				added[code] = true
+			}
+		}
+		for _, dr := range defaultRoles {
+			var role Role
+			err := tx.Where("name = ?", dr.Name).First(&role).Error
+			created := false
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				role = Role{ID: dr.ID, Name: dr.Name, Description: dr.Description, BuiltIn: true, ShopScoped: dr.ShopScoped}
+				if err := tx.Create(&role).Error; err != nil {
+					return err
+				}
+				// 内置角色使用了显式ID，自增序列需要跳过它们
+				if dr.ID != 0 {
+					if err := tx.Exec("SELECT setval(pg_get_serial_sequence('roles', 'id'), (SELECT MAX(id) FROM roles))").Error; err != nil {
+						return err
+					}
+				}
+				created = true
+			} else if err != nil {
+				return err
+			}
+			wanted := dr.Permissions
+			if dr.ID == user.RoleAdmin {
+				wanted = codes
+			}
+			grant := make([]string, 0, len(wanted))
+			for _, code := range wanted {
+				if created || added[code] {
+					grant = append(grant, code)
+				}
+			}
+			if len(grant) == 0 {
+				continue
+			}
+			var perms []Permission
+			if err := tx.Where("code IN ?", grant).Find(&perms).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&role).Association("Permissions").Append(&perms); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RolePermissionCodes 返回角色拥有的权限码
+func (r *RbacRepository) RolePermissionCodes(roleID uint) ([]string, error) {
+	var codes []string
+	err := r.Database.DB.Table("permissions").
+		Joins("JOIN role_permissions rp ON rp.permission_id = permissions.id").
+		Where("rp.role_id = ?", roleID).
+		Pluck("permissions.code", &codes).Error
+	return codes, err
+}
+
+func (r *RbacRepository) ListPermissions() ([]Permission, error) {
+	var perms []Permission
+	if err := r.Database.DB.Order("code").Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
+
+func (r *RbacRepository) FindPermissions(codes []string) ([]Permission, error) {
+	var perms []Permission
+	if len(codes) == 0 {
+		return perms, nil
+	}
+	if err := r.Database.DB.Where("code IN ?", codes).Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
+
+func (r *RbacRepository) ListRoles() ([]Role, error) {
+	var roles []Role
+	if err := r.Database.DB.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *RbacRepository) GetRole(id uint) (*Role, error) {
+	var role Role
+	if err := r.Database.DB.Preload("Permissions").First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *RbacRepository) CreateRole(role *Role) error {
+	return r.Database.DB.Create(role).Error
+}
+
+func (r *RbacRepository) UpdateRole(role *Role) error {
+	return r.Database.DB.Model(&Role{}).Where("id = ?", role.ID).
+		Updates(map[string]interface{}{"name": role.Name, "description": role.Description, "require_two_factor": role.RequireTwoFactor}).Error
+}
+
+// SetRolePermissions 用 perms 整体替换角色的权限
+func (r *RbacRepository) SetRolePermissions(role *Role, perms []Permission) error {
+	return r.Database.DB.Model(role).Association("Permissions").Replace(perms)
+}
+
+// RoleInUse 角色是否仍分配给用户或店铺员工
+func (r *RbacRepository) RoleInUse(id uint) (bool, error) {
+	var users, staff int64
+	if err := r.Database.DB.Model(&user.User{}).Where("role = ?", id).Count(&users).Error; err != nil {
+		return false, err
+	}
+	if err := r.Database.DB.Model(&ShopStaff{}).Where("role_id = ?", id).Count(&staff).Error; err != nil {
+		return false, err
+	}
+	return users+staff > 0, nil
+}
+
+func (r *RbacRepository) DeleteRole(id uint) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Role{}, id).Error
+	})
+}
+
+func (r *RbacRepository) ListShopStaff(shopID uint) ([]ShopStaff, error) {
+	var staff []ShopStaff
+	if err := r.Database.DB.Where("shop_id = ?", shopID).Order("id").Find(&staff).Error; err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// ListStaffShops 返回用户作为员工所在的店铺及角色
+func (r *RbacRepository) ListStaffShops(userID uint) ([]ShopStaff, error) {
+	var staff []ShopStaff
+	if err := r.Database.DB.Where("user_id = ?", userID).Find(&staff).Error; err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// UpsertShopStaff 添加员工，已存在时更新角色
+func (r *RbacRepository) UpsertShopStaff(s *ShopStaff) error {
+	return r.Database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "shop_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role_id", "updated_at"}),
+	}).Create(s).Error
+}
+
+func (r *RbacRepository) DeleteShopStaff(shopID, userID uint) (bool, error) {
+	res := r.Database.DB.Where("shop_id = ? AND user_id = ?", shopID, userID).Delete(&ShopStaff{})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,370 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	user "github.com/myproject/shop/internal/User"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/middleware"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrBuiltInRole       = errors.New("built-in role cannot be renamed or deleted")
+	ErrRoleInUse         = errors.New("role is still assigned to users or staff")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrNotShopRole       = errors.New("role is not a shop staff role")
+	ErrNotShopPermission = errors.New("permission cannot be granted to a shop staff role")
+	ErrStaffNotFound     = errors.New("staff not found")
+	ErrAdminLockout      = errors.New("admin role must keep " + PermRoleManage)
+)
+
+// 权限缓存：rbac:role:{id} 为角色的权限码，rbac:staff:{uid} 为用户作为员工所在的店铺及角色
+const permissionCacheTTL = 10 * time.Minute
+
+func roleCacheKey(roleID uint) string {
+	return fmt.Sprintf("rbac:role:%d", roleID)
+}
+
+func staffCacheKey(userID uint) string {
+	return fmt.Sprintf("rbac:staff:%d", userID)
+}
+
+type RbacService struct {
+	repo  *RbacRepository
+	cache *middleware.RedisStore
+}
+
+// NewRbacService 同时把自身注册为 middleware.RequirePermission 使用的权限检查器
+func NewRbacService(repo *RbacRepository, cache *middleware.RedisStore) *RbacService {
+	s := &RbacService{repo: repo, cache: cache}
+	middleware.InitPermissions(s)
+	return s
+}
+
+// rolePermissions 返回角色的权限集合，优先读缓存
+func (s *RbacService) rolePermissions(ctx context.Context, roleID uint) (map[string]bool, error) {
+	var codes []string
+	cached := false
+	if s.cache != nil {
+		var err error
+		if cached, err = s.cache.GetObject(ctx, roleCacheKey(roleID), &codes); err != nil {
+			logger.Warn("rbac_cache_read_failed", map[string]interface{}{"role_id": roleID, "error": err.Error()})
+		}
+	}
+	if !cached {
+		var err error
+		if codes, err = s.repo.RolePermissionCodes(roleID); err != nil {
+			return nil, err
+		}
+		if s.cache != nil {
+			_ = s.cache.SetObjectWithTTL(ctx, roleCacheKey(roleID), codes, permissionCacheTTL)
+		}
+	}
+	perms := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		perms[c] = true
+	}
+	return perms, nil
+}
+
+// staffRoles 返回用户作为员工所在的店铺ID到角色ID的映射
+func (s *RbacService) staffRoles(ctx context.Context, userID uint) (map[uint]uint, error) {
+	roles := make(map[uint]uint)
+	if s.cache != nil {
+		if ok, err := s.cache.GetObject(ctx, staffCacheKey(userID), &roles); err == nil && ok {
+			return roles, nil
+		}
+	}
+	staff, err := s.repo.ListStaffShops(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range staff {
+		roles[st.ShopID] = st.RoleID
+	}
+	if s.cache != nil {
+		_ = s.cache.SetObjectWithTTL(ctx, staffCacheKey(userID), roles, permissionCacheTTL)
+	}
+	return roles, nil
+}
+
+// HasPermission 用户的角色拥有该权限，或者用户在某个店铺的员工角色拥有该店铺级权限。
+// 后者只说明用户可能有权操作，具体店铺由 CanManageShop 校验
+func (s *RbacService) HasPermission(ctx context.Context, userID, role uint, perm string) (bool, error) {
+	perms, err := s.rolePermissions(ctx, role)
+	if err != nil {
+		return false, err
+	}
+	if perms[perm] {
+		return true, nil
+	}
+	if !shopPermissions[perm] {
+		return false, nil
+	}
+	staff, err := s.staffRoles(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, roleID := range staff {
+		perms, err := s.rolePermissions(ctx, roleID)
+		if err != nil {
+			return false, err
+		}
+		if perms[perm] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RoleHasPermission 只看用户自身的角色，不含店铺员工权限
+func (s *RbacService) RoleHasPermission(ctx context.Context, role uint, perm string) bool {
+	perms, err := s.rolePermissions(ctx, role)
+	if err != nil {
+		logger.Error("rbac_check_failed", map[string]interface{}{"role": role, "error": err.Error()})
+		return false
+	}
+	return perms[perm]
+}
+
+// CanManageShop 用户能否在店铺内行使 perm：拥有 shop:any 的角色不限店铺，
+// 店主按自身角色的权限，店铺员工按员工角色的权限
+func (s *RbacService) CanManageShop(ctx context.Context, userID, role, shopID, ownerID uint, perm string) bool {
+	perms, err := s.rolePermissions(ctx, role)
+	if err != nil {
+		logger.Error("rbac_check_failed", map[string]interface{}{"user_id": userID, "error": err.Error()})
+		return false
+	}
+	if perms[perm] && (perms[PermShopAny] || ownerID == userID) {
+		return true
+	}
+	staff, err := s.staffRoles(ctx, userID)
+	if err != nil {
+		logger.Error("rbac_check_failed", map[string]interface{}{"user_id": userID, "error": err.Error()})
+		return false
+	}
+	roleID, ok := staff[shopID]
+	if !ok {
+		return false
+	}
+	staffPerms, err := s.rolePermissions(ctx, roleID)
+	return err == nil && shopPermissions[perm] && staffPerms[perm]
+}
+
+func (s *RbacService) ListPermissions() ([]Permission, error) {
+	return s.repo.ListPermissions()
+}
+
+func (s *RbacService) ListRoles() ([]Role, error) {
+	return s.repo.ListRoles()
+}
+
+func (s *RbacService) GetRole(id uint) (*Role, error) {
+	role, err := s.repo.GetRole(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleNotFound
+	}
+	return role, err
+}
+
+// AssignableToUser 角色能否直接分配给用户：角色必须存在，且不是只能分配给店铺员工的店铺角色
+func (s *RbacService) AssignableToUser(id uint) (bool, error) {
+	role, err := s.GetRole(id)
+	if errors.Is(err, ErrRoleNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !role.ShopScoped, nil
+}
+
+// findPermissions 把权限码转换为权限，存在未知权限码时报错
+func (s *RbacService) findPermissions(codes []string) ([]Permission, error) {
+	perms, err := s.repo.FindPermissions(codes)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		found[p.Code] = true
+	}
+	var unknown []string
+	for _, c := range codes {
+		if !found[c] {
+			unknown = append(unknown, c)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, strings.Join(unknown, ", "))
+	}
+	return perms, nil
+}
+
+// checkShopPermissions 店铺员工角色只能包含店铺级权限
+func checkShopPermissions(codes []string) error {
+	var global []string
+	for _, c := range codes {
+		if !shopPermissions[c] {
+			global = append(global, c)
+		}
+	}
+	if len(global) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotShopPermission, strings.Join(global, ", "))
+	}
+	return nil
+}
+
+func (s *RbacService) CreateRole(name, description string, shopScoped bool, codes []string) (*Role, error) {
+	perms, err := s.findPermissions(codes)
+	if err != nil {
+		return nil, err
+	}
+	if shopScoped {
+		if err := checkShopPermissions(codes); err != nil {
+			return nil, err
+		}
+	}
+	role := &Role{Name: name, Description: description, ShopScoped: shopScoped, Permissions: perms}
+	if err := s.repo.CreateRole(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// UpdateRole 修改角色名称、描述，requireTwoFactor 不为空时同时设置是否强制两步验证
+func (s *RbacService) UpdateRole(id uint, name, description string, requireTwoFactor *bool) (*Role, error) {
+	role, err := s.GetRole(id)
+	if err != nil {
+		return nil, err
+	}
+	if role.BuiltIn && name != role.Name {
+		return nil, ErrBuiltInRole
+	}
+	role.Name, role.Description = name, description
+	if requireTwoFactor != nil {
+		role.RequireTwoFactor = *requireTwoFactor
+	}
+	if err := s.repo.UpdateRole(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// RoleRequiresTwoFactor 该角色的用户是否必须启用两步验证
+func (s *RbacService) RoleRequiresTwoFactor(roleID uint) (bool, error) {
+	role, err := s.repo.GetRole(roleID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return role.RequireTwoFactor, nil
+}
+
+// SetRolePermissions 替换角色的权限；管理员角色必须保留 role:manage，避免把自己锁在外面；
+// 店铺员工角色只能包含店铺级权限
+func (s *RbacService) SetRolePermissions(ctx context.Context, id uint, codes []string) (*Role, error) {
+	role, err := s.GetRole(id)
+	if err != nil {
+		return nil, err
+	}
+	perms, err := s.findPermissions(codes)
+	if err != nil {
+		return nil, err
+	}
+	if role.ShopScoped {
+		if err := checkShopPermissions(codes); err != nil {
+			return nil, err
+		}
+	}
+	if id == user.RoleAdmin {
+		keep := false
+		for _, p := range perms {
+			keep = keep || p.Code == PermRoleManage
+		}
+		if !keep {
+			return nil, ErrAdminLockout
+		}
+	}
+	if err := s.repo.SetRolePermissions(role, perms); err != nil {
+		return nil, err
+	}
+	role.Permissions = perms
+	s.invalidateRole(ctx, id)
+	return role, nil
+}
+
+func (s *RbacService) DeleteRole(ctx context.Context, id uint) error {
+	role, err := s.GetRole(id)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return ErrBuiltInRole
+	}
+	inUse, err := s.repo.RoleInUse(id)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrRoleInUse
+	}
+	if err := s.repo.DeleteRole(id); err != nil {
+		return err
+	}
+	s.invalidateRole(ctx, id)
+	return nil
+}
+
+func (s *RbacService) ListShopStaff(shopID uint) ([]ShopStaff, error) {
+	return s.repo.ListShopStaff(shopID)
+}
+
+// SetShopStaff 添加店铺员工或修改其角色，只能使用店铺员工角色
+func (s *RbacService) SetShopStaff(ctx context.Context, shopID, userID, roleID, actorID uint) (*ShopStaff, error) {
+	role, err := s.GetRole(roleID)
+	if err != nil {
+		return nil, err
+	}
+	if !role.ShopScoped {
+		return nil, ErrNotShopRole
+	}
+	st := &ShopStaff{ShopID: shopID, UserID: userID, RoleID: roleID, CreatedBy: actorID}
+	if err := s.repo.UpsertShopStaff(st); err != nil {
+		return nil, err
+	}
+	s.invalidateStaff(ctx, userID)
+	return st, nil
+}
+
+func (s *RbacService) RemoveShopStaff(ctx context.Context, shopID, userID uint) error {
+	ok, err := s.repo.DeleteShopStaff(shopID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrStaffNotFound
+	}
+	s.invalidateStaff(ctx, userID)
+	return nil
+}
+
+func (s *RbacService) invalidateRole(ctx context.Context, roleID uint) {
+	if s.cache != nil {
+		_ = s.cache.DelteKey(ctx, roleCacheKey(roleID))
+	}
+}
+
+func (s *RbacService) invalidateStaff(ctx context.Context, userID uint) {
+	if s.cache != nil {
+		_ = s.cache.DelteKey(ctx, staffCacheKey(userID))
+	}
+}
@@ -0,0 +1,9 @@
+package rbac
+
+import "github.com/google/wire"
+
+var ProviderSet = wire.NewSet(
+	NewRepository,
+	NewRbacService,
+	NewRbacHandler,
+)
@@ -0,0 +1,87 @@
+package shop
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	rbac "github.com/myproject/shop/internal/Rbac"
+)
+
+type createAPIKeyReq struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	RateLimit int        `json:"rate_limit" binding:"omitempty,min=1"` // 每分钟请求数，默认 600
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func writeAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidAPIKeyScope):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListAPIKeys GET /shops/:id/api-keys
+func (h *ShopHandler) ListAPIKeys(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeShops(c, rbac.PermShopWrite, uint(shopID)) {
+		return
+	}
+	keys, err := h.service.ListAPIKeys(uint(shopID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey POST /shops/:id/api-keys，响应中的 key 只返回这一次。
+// 创建者自己必须在该店铺拥有申请的每一个权限
+func (h *ShopHandler) CreateAPIKey(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeShops(c, rbac.PermShopWrite, uint(shopID)) {
+		return
+	}
+	var req createAPIKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if validAPIKeyScope(scope) && !h.authorizeShops(c, scope, uint(shopID)) {
+			return
+		}
+	}
+	userID, _ := getUserID(c)
+	key, plain, err := h.service.CreateAPIKey(c.Request.Context(), uint(shopID), userID, req.Name, req.Scopes, req.RateLimit, req.ExpiresAt)
+	if err != nil {
+		writeAPIKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": plain})
+}
+
+// RevokeAPIKey DELETE /shops/:id/api-keys/:key_id
+func (h *ShopHandler) RevokeAPIKey(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	keyID, _ := strconv.Atoi(c.Param("key_id"))
+	if !h.authorizeShops(c, rbac.PermShopWrite, uint(shopID)) {
+		return
+	}
+	if err := h.service.RevokeAPIKey(c.Request.Context(), uint(shopID), uint(keyID)); err != nil {
+		writeAPIKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,52 @@
+package shop
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r *ShopRepository) CreateAPIKey(key *APIKey) error {
+	return r.Database.DB.Create(key).Error
+}
+
+// ListAPIKeys 店铺的全部 API key，包括已吊销的
+func (r *ShopRepository) ListAPIKeys(shopID uint) ([]APIKey, error) {
+	var keys []APIKey
+	if err := r.Database.DB.Where("shop_id = ?", shopID).Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *ShopRepository) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	var key APIKey
+	if err := r.Database.DB.Where("key_hash = ?", hash).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey 返回是否吊销了一个有效的 key
+func (r *ShopRepository) RevokeAPIKey(shopID, id uint, at time.Time) (bool, error) {
+	res := r.Database.DB.Model(&APIKey{}).
+		Where("id = ? AND shop_id = ? AND revoked_at IS NULL", id, shopID).
+		Update("revoked_at", at)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *ShopRepository) TouchAPIKey(id uint, at time.Time) error {
+	return r.Database.DB.Model(&APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+// UserRole 用户当前的角色；用户不存在或已删除时返回 gorm.ErrRecordNotFound
+func (r *ShopRepository) UserRole(userID uint) (uint, error) {
+	var role []uint
+	if err := r.Database.DB.Table("users").Where("id = ? AND deleted_at IS NULL", userID).Pluck("role", &role).Error; err != nil {
+		return 0, err
+	}
+	if len(role) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return role[0], nil
+}
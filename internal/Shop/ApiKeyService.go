@@ -0,0 +1,150 @@
+package shop
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	audit "github.com/myproject/shop/internal/Audit"
+	rbac "github.com/myproject/shop/internal/Rbac"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/middleware"
+	"gorm.io/gorm"
+)
+
+// APIKeyScopes API key 可以申请的权限，覆盖商品和库存同步
+var APIKeyScopes = []string{rbac.PermProductWrite, rbac.PermInventoryWrite}
+
+const (
+	defaultAPIKeyRateLimit = 600
+	maxAPIKeyRateLimit     = 6000
+	apiKeyTouchInterval    = time.Minute // last_used_at 的更新间隔，避免每个请求都写库
+)
+
+var (
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrInvalidAPIKeyScope = errors.New("invalid api key scope")
+)
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey 创建 API key，返回记录和明文 key；明文不保存，之后无法再次查看
+func (s *ShopService) CreateAPIKey(ctx context.Context, shopID, userID uint, name string, scopes []string, rateLimit int, expiresAt *time.Time) (*APIKey, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeyScope)
+	}
+	for _, scope := range scopes {
+		if !validAPIKeyScope(scope) {
+			return nil, "", fmt.Errorf("%w: %q", ErrInvalidAPIKeyScope, scope)
+		}
+	}
+	if rateLimit <= 0 {
+		rateLimit = defaultAPIKeyRateLimit
+	}
+	if rateLimit > maxAPIKeyRateLimit {
+		rateLimit = maxAPIKeyRateLimit
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	plain := middleware.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	key := &APIKey{
+		ShopID:    shopID,
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:len(middleware.APIKeyPrefix)+6],
+		KeyHash:   hashAPIKey(plain),
+		Scopes:    scopes,
+		RateLimit: rateLimit,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.rep.CreateAPIKey(key); err != nil {
+		return nil, "", err
+	}
+	s.audit.Record(ctx, audit.Entry{
+		ActorID: userID, Action: audit.ActionCreate, ResourceType: audit.ResourceAPIKey, ResourceID: audit.ID(key.ID),
+		After: map[string]interface{}{"shop_id": shopID, "name": name, "prefix": key.Prefix, "scopes": scopes, "rate_limit": rateLimit, "expires_at": expiresAt},
+	})
+	return key, plain, nil
+}
+
+func validAPIKeyScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ShopService) ListAPIKeys(shopID uint) ([]APIKey, error) {
+	return s.rep.ListAPIKeys(shopID)
+}
+
+// RevokeAPIKey 吊销后立即失效
+func (s *ShopService) RevokeAPIKey(ctx context.Context, shopID, id uint) error {
+	ok, err := s.rep.RevokeAPIKey(shopID, id, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionRevoke, ResourceType: audit.ResourceAPIKey, ResourceID: audit.ID(id), Detail: map[string]interface{}{"shop_id": shopID}})
+	return nil
+}
+
+// AuthenticateAPIKey 实现 middleware.APIKeyAuthenticator。角色每次从用户表读取，
+// 创建者被降级或删除后 key 随之失去权限
+func (s *ShopService) AuthenticateAPIKey(ctx context.Context, plain string) (*middleware.APIKeyPrincipal, error) {
+	key, err := s.rep.GetAPIKeyByHash(hashAPIKey(plain))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, nil
+	}
+	role, err := s.rep.UserRole(key.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.touchAPIKey(ctx, key.ID, now)
+	return &middleware.APIKeyPrincipal{
+		KeyID:     key.ID,
+		ShopID:    key.ShopID,
+		UserID:    key.UserID,
+		Role:      role,
+		Scopes:    key.Scopes,
+		RateLimit: key.RateLimit,
+	}, nil
+}
+
+// touchAPIKey 每个 key 每分钟最多更新一次 last_used_at，多个实例通过 Redis 协调
+func (s *ShopService) touchAPIKey(ctx context.Context, id uint, at time.Time) {
+	if s.cache != nil {
+		ok, err := s.cache.Client.SetNX(ctx, "apikey_used:"+strconv.FormatUint(uint64(id), 10), 1, apiKeyTouchInterval).Result()
+		if err != nil || !ok {
+			return
+		}
+	}
+	if err := s.rep.TouchAPIKey(id, at); err != nil {
+		logger.Warn("api_key_touch_failed", map[string]interface{}{"key_id": id, "error": err.Error()})
+	}
+}
@@ -0,0 +1,84 @@
+package shop
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListFavorites GET /favorites
+func (h *ShopHandler) ListFavorites(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	products, err := h.service.ListFavorites(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, products)
+}
+
+// AddFavorite POST /favorites/:id
+func (h *ShopHandler) AddFavorite(c *gin.Context) {
+	h.writeFavorite(c, h.service.AddFavorite, "product favorited")
+}
+
+// RemoveFavorite DELETE /favorites/:id
+func (h *ShopHandler) RemoveFavorite(c *gin.Context) {
+	h.writeFavorite(c, h.service.RemoveFavorite, "product unfavorited")
+}
+
+// ListFollows GET /follows
+func (h *ShopHandler) ListFollows(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	shops, err := h.service.ListFollows(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, shops)
+}
+
+// FollowShop POST /follows/:id
+func (h *ShopHandler) FollowShop(c *gin.Context) {
+	h.writeFavorite(c, h.service.FollowShop, "shop followed")
+}
+
+// UnfollowShop DELETE /follows/:id
+func (h *ShopHandler) UnfollowShop(c *gin.Context) {
+	h.writeFavorite(c, h.service.UnfollowShop, "shop unfollowed")
+}
+
+func (h *ShopHandler) writeFavorite(c *gin.Context, fn func(ctx context.Context, userID, targetID uint) error, message string) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	err = fn(c.Request.Context(), userID, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
@@ -0,0 +1,119 @@
+package shop
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// favoriteRelation 描述一种“用户-目标”关系表：商品收藏或店铺关注
+type favoriteRelation struct {
+	name   string // Redis key 前缀
+	table  string
+	column string // 目标列
+}
+
+var (
+	productFavorites = favoriteRelation{name: "favorites", table: "product_favorites", column: "product_id"}
+	shopFollows      = favoriteRelation{name: "follows", table: "shop_follows", column: "shop_id"}
+)
+
+// favoriteOp 一次待同步的收藏变更，Add 为 false 表示取消
+type favoriteOp struct {
+	UserID   uint
+	TargetID uint
+	Add      bool
+}
+
+// ListFavoriteTargets 返回用户收藏的商品ID或关注的店铺ID
+func (r *ShopRepository) ListFavoriteTargets(rel favoriteRelation, userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.Database.DB.Table(rel.table).Where("user_id = ?", userID).Order("id desc").Pluck(rel.column, &ids).Error
+	return ids, err
+}
+
+// ListFavoriteUsers 返回收藏了商品或关注了店铺的用户ID
+func (r *ShopRepository) ListFavoriteUsers(rel favoriteRelation, targetID uint) ([]uint, error) {
+	var ids []uint
+	err := r.Database.DB.Table(rel.table).Where(rel.column+" = ?", targetID).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+func (r *ShopRepository) CountFavoriteUsers(rel favoriteRelation, targetID uint) (int64, error) {
+	var count int64
+	err := r.Database.DB.Table(rel.table).Where(rel.column+" = ?", targetID).Count(&count).Error
+	return count, err
+}
+
+// ApplyFavoriteOps 在一个事务内把一批收藏变更写入数据库，重复收藏和取消不存在的收藏都是幂等的
+func (r *ShopRepository) ApplyFavoriteOps(rel favoriteRelation, ops []favoriteOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (user_id, %s, created_at) VALUES (?, ?, ?) ON CONFLICT (user_id, %s) DO NOTHING", rel.table, rel.column, rel.column)
+	remove := fmt.Sprintf("DELETE FROM %s WHERE user_id = ? AND %s = ?", rel.table, rel.column)
+	now := time.Now()
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, op := range ops {
+			var err error
+			if op.Add {
+				err = tx.Exec(insert, op.UserID, op.TargetID, now).Error
+			} else {
+				err = tx.Exec(remove, op.UserID, op.TargetID).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListProductsByIDs 按ID批量查询已上架且店铺已通过审核的商品
+func (r *ShopRepository) ListProductsByIDs(ids []uint) ([]Product, error) {
+	var products []Product
+	if len(ids) == 0 {
+		return products, nil
+	}
+	if err := r.Database.DB.Where("id IN ? AND status = ?", ids, ProductStatusPublished).
+		Where(approvedShopSQL, ShopStatusApproved).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *ShopRepository) ListShopsByIDs(ids []uint) ([]Shop, error) {
+	var shops []Shop
+	if len(ids) == 0 {
+		return shops, nil
+	}
+	if err := r.Database.DB.Where("id IN ?", ids).Find(&shops).Error; err != nil {
+		return nil, err
+	}
+	return shops, nil
+}
+
+// ClaimPendingRestockEvents 把最多 limit 条尚未通知的到货记录标记为在 at 通知并返回；
+// 被其他实例锁住的行直接跳过，每条记录只会被一个实例取到
+func (r *ShopRepository) ClaimPendingRestockEvents(limit int, at time.Time) ([]RestockEvent, error) {
+	var events []RestockEvent
+	pending := r.Database.DB.Model(&RestockEvent{}).Select("id").Where("notified_at IS NULL").
+		Order("id").Limit(limit).Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+	if err := r.Database.DB.Model(&events).
+		Clauses(clause.Returning{}).
+		Where("id IN (?)", pending).
+		Update("notified_at", at).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ReleaseRestockEvents 处理失败时撤销 ClaimPendingRestockEvents 的标记，下次任务重试
+func (r *ShopRepository) ReleaseRestockEvents(ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.Database.DB.Model(&RestockEvent{}).Where("id IN ? AND notified_at = ?", ids, at).Update("notified_at", nil).Error
+}
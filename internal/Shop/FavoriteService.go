@@ -0,0 +1,297 @@
+package shop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	notification "github.com/myproject/shop/internal/Notification"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+// 收藏和关注先写 Redis，再由后台任务批量同步到数据库：
+//
+//	{name}:user:{uid}     用户收藏的目标ID集合
+//	{name}:target:{id}    收藏了该目标的用户ID集合，SCARD 即收藏数
+//	{name}:dirty          待同步的变更，field 为 "uid:id"，value 1 为收藏、0 为取消
+//
+// 集合里始终保留一个哨兵成员 "0"，这样取消最后一个收藏后 key 也不会消失，
+// key 存在即表示集合已从数据库加载完整，不会被未同步的变更覆盖。
+const favoriteSentinel = "0"
+
+func (rel favoriteRelation) userKey(userID uint) string {
+	return fmt.Sprintf("%s:user:%d", rel.name, userID)
+}
+
+func (rel favoriteRelation) targetKey(targetID uint) string {
+	return fmt.Sprintf("%s:target:%d", rel.name, targetID)
+}
+
+func (rel favoriteRelation) dirtyKey() string {
+	return rel.name + ":dirty"
+}
+
+// ensureFavoriteSet 集合不存在时从数据库加载
+func (s *ShopService) ensureFavoriteSet(ctx context.Context, key string, load func() ([]uint, error)) error {
+	n, err := s.cache.Client.Exists(ctx, key).Result()
+	if err != nil || n > 0 {
+		return err
+	}
+	ids, err := load()
+	if err != nil {
+		return err
+	}
+	members := make([]interface{}, 0, len(ids)+1)
+	members = append(members, favoriteSentinel)
+	for _, id := range ids {
+		members = append(members, id)
+	}
+	return s.cache.Client.SAdd(ctx, key, members...).Err()
+}
+
+// favoriteMembers 返回集合中的ID（不含哨兵），未启用缓存时直接查数据库
+func (s *ShopService) favoriteMembers(ctx context.Context, key string, load func() ([]uint, error)) ([]uint, error) {
+	if s.cache == nil {
+		return load()
+	}
+	if err := s.ensureFavoriteSet(ctx, key, load); err != nil {
+		return nil, err
+	}
+	members, err := s.cache.Client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseUint(m, 10, 64)
+		if err != nil || id == 0 {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// setFavorite 收藏或取消收藏；Redis 不可用时直接写数据库
+func (s *ShopService) setFavorite(ctx context.Context, rel favoriteRelation, userID, targetID uint, add bool) error {
+	if s.cache == nil {
+		return s.rep.ApplyFavoriteOps(rel, []favoriteOp{{UserID: userID, TargetID: targetID, Add: add}})
+	}
+	userKey, targetKey := rel.userKey(userID), rel.targetKey(targetID)
+	if err := s.ensureFavoriteSet(ctx, userKey, func() ([]uint, error) { return s.rep.ListFavoriteTargets(rel, userID) }); err != nil {
+		return err
+	}
+	if err := s.ensureFavoriteSet(ctx, targetKey, func() ([]uint, error) { return s.rep.ListFavoriteUsers(rel, targetID) }); err != nil {
+		return err
+	}
+	value := "0"
+	if add {
+		value = "1"
+	}
+	_, err := s.cache.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if add {
+			pipe.SAdd(ctx, userKey, targetID)
+			pipe.SAdd(ctx, targetKey, userID)
+		} else {
+			pipe.SRem(ctx, userKey, targetID)
+			pipe.SRem(ctx, targetKey, userID)
+		}
+		pipe.HSet(ctx, rel.dirtyKey(), fmt.Sprintf("%d:%d", userID, targetID), value)
+		return nil
+	})
+	return err
+}
+
+func (s *ShopService) countFavorites(ctx context.Context, rel favoriteRelation, targetID uint) (int64, error) {
+	if s.cache == nil {
+		return s.rep.CountFavoriteUsers(rel, targetID)
+	}
+	key := rel.targetKey(targetID)
+	if err := s.ensureFavoriteSet(ctx, key, func() ([]uint, error) { return s.rep.ListFavoriteUsers(rel, targetID) }); err != nil {
+		return 0, err
+	}
+	n, err := s.cache.Client.SCard(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	return n - 1, nil
+}
+
+func (s *ShopService) AddFavorite(ctx context.Context, userID, productID uint) error {
+	p, err := s.rep.GetProductByCode(productID)
+	if err != nil {
+		return err
+	}
+	if !p.IsPublished() {
+		return errors.New("product is not available")
+	}
+	return s.setFavorite(ctx, productFavorites, userID, productID, true)
+}
+
+func (s *ShopService) RemoveFavorite(ctx context.Context, userID, productID uint) error {
+	return s.setFavorite(ctx, productFavorites, userID, productID, false)
+}
+
+// ClearUserFavorites 取消用户的全部收藏和关注，注销账号时调用
+func (s *ShopService) ClearUserFavorites(ctx context.Context, userID uint) error {
+	for _, rel := range []favoriteRelation{productFavorites, shopFollows} {
+		ids, err := s.favoriteMembers(ctx, rel.userKey(userID), func() ([]uint, error) {
+			return s.rep.ListFavoriteTargets(rel, userID)
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := s.setFavorite(ctx, rel, userID, id, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListFavorites 返回用户收藏的商品，已删除或已下架的商品不返回
+func (s *ShopService) ListFavorites(ctx context.Context, userID uint) ([]Product, error) {
+	ids, err := s.favoriteMembers(ctx, productFavorites.userKey(userID), func() ([]uint, error) {
+		return s.rep.ListFavoriteTargets(productFavorites, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.rep.ListProductsByIDs(ids)
+}
+
+func (s *ShopService) FavoriteCount(ctx context.Context, productID uint) (int64, error) {
+	return s.countFavorites(ctx, productFavorites, productID)
+}
+
+func (s *ShopService) FollowShop(ctx context.Context, userID, shopID uint) error {
+	if _, err := s.rep.Get(shopID); err != nil {
+		return err
+	}
+	return s.setFavorite(ctx, shopFollows, userID, shopID, true)
+}
+
+func (s *ShopService) UnfollowShop(ctx context.Context, userID, shopID uint) error {
+	return s.setFavorite(ctx, shopFollows, userID, shopID, false)
+}
+
+func (s *ShopService) ListFollows(ctx context.Context, userID uint) ([]Shop, error) {
+	ids, err := s.favoriteMembers(ctx, shopFollows.userKey(userID), func() ([]uint, error) {
+		return s.rep.ListFavoriteTargets(shopFollows, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.rep.ListShopsByIDs(ids)
+}
+
+func (s *ShopService) FollowerCount(ctx context.Context, shopID uint) (int64, error) {
+	return s.countFavorites(ctx, shopFollows, shopID)
+}
+
+// FlushFavorites 由后台任务调用，把 Redis 中待同步的收藏和关注变更写入数据库
+func (s *ShopService) FlushFavorites(ctx context.Context) error {
+	if s.cache == nil {
+		return nil
+	}
+	for _, rel := range []favoriteRelation{productFavorites, shopFollows} {
+		if err := s.flushFavorites(ctx, rel); err != nil {
+			return fmt.Errorf("flush %s: %w", rel.name, err)
+		}
+	}
+	return nil
+}
+
+// flushFavorites 先把 dirty 重命名为 flushing 再处理，期间的新变更写入新的 dirty；
+// 上次同步失败留下的 flushing 会先被重新处理
+func (s *ShopService) flushFavorites(ctx context.Context, rel favoriteRelation) error {
+	flushing := rel.dirtyKey() + ":flushing"
+	n, err := s.cache.Client.Exists(ctx, flushing).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		err := s.cache.Client.Rename(ctx, rel.dirtyKey(), flushing).Err()
+		if err != nil && strings.Contains(err.Error(), "no such key") {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fields, err := s.cache.Client.HGetAll(ctx, flushing).Result()
+	if err != nil {
+		return err
+	}
+	ops := make([]favoriteOp, 0, len(fields))
+	for field, value := range fields {
+		var userID, targetID uint
+		if _, err := fmt.Sscanf(field, "%d:%d", &userID, &targetID); err != nil {
+			continue
+		}
+		ops = append(ops, favoriteOp{UserID: userID, TargetID: targetID, Add: value == "1"})
+	}
+	if err := s.rep.ApplyFavoriteOps(rel, ops); err != nil {
+		return err
+	}
+	return s.cache.Client.Del(ctx, flushing).Err()
+}
+
+func (s *ShopService) favoriteUsers(ctx context.Context, productID uint) ([]uint, error) {
+	return s.favoriteMembers(ctx, productFavorites.targetKey(productID), func() ([]uint, error) {
+		return s.rep.ListFavoriteUsers(productFavorites, productID)
+	})
+}
+
+// NotifyBackInStock 由后台任务调用，通知收藏了重新到货商品的用户
+func (s *ShopService) NotifyBackInStock(ctx context.Context) error {
+	if s.notifier == nil {
+		return nil
+	}
+	// 截断到微秒与数据库精度一致，撤销标记时按这个时间匹配
+	now := time.Now().Truncate(time.Microsecond)
+	events, err := s.rep.ClaimPendingRestockEvents(100, now)
+	if err != nil {
+		return fmt.Errorf("claim restock events: %w", err)
+	}
+	var failed []uint
+	for _, e := range events {
+		users, err := s.favoriteUsers(ctx, e.ProductID)
+		if err != nil {
+			logger.Error("back_in_stock_failed", map[string]interface{}{"product_id": e.ProductID, "error": err.Error()})
+			failed = append(failed, e.ID)
+			continue
+		}
+		title := fmt.Sprintf("%s 到货了", e.ProductName)
+		content := fmt.Sprintf("您收藏的商品 %s 已重新到货，当前库存 %d", e.ProductName, e.Stock)
+		for _, uid := range users {
+			_ = s.notifier.Notify(ctx, uid, notification.TypeBackInStock, title, content)
+		}
+	}
+	return s.rep.ReleaseRestockEvents(failed, now)
+}
+
+// notifyFavoritesOnSale 商品降价时通知收藏用户，skip 中的用户已收到降价提醒，不重复通知
+func (s *ShopService) notifyFavoritesOnSale(ctx context.Context, p *Product, oldPrice float64, skip map[uint]bool) {
+	if s.notifier == nil {
+		return
+	}
+	users, err := s.favoriteUsers(ctx, p.ID)
+	if err != nil {
+		logger.Error("favorite_on_sale_failed", map[string]interface{}{"product_id": p.ID, "error": err.Error()})
+		return
+	}
+	title := fmt.Sprintf("%s 降价了", p.Name)
+	content := fmt.Sprintf("您收藏的商品 %s 从 %.2f 降至 %.2f", p.Name, oldPrice, p.Price)
+	for _, uid := range users {
+		if skip[uid] {
+			continue
+		}
+		_ = s.notifier.Notify(ctx, uid, notification.TypeFavoriteOnSale, title, content)
+	}
+}
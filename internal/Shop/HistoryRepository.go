@@ -0,0 +1,35 @@
+package shop
+
+import (
+	"gorm.io/gorm/clause"
+)
+
+// UpsertProductViews 归档浏览记录，已有记录只在浏览时间更晚时更新
+func (r *ShopRepository) UpsertProductViews(views []ProductView) error {
+	if len(views) == 0 {
+		return nil
+	}
+	return r.Database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "product_id"}},
+		DoUpdates: clause.Set{{
+			Column: clause.Column{Name: "viewed_at"},
+			Value:  clause.Expr{SQL: "GREATEST(product_views.viewed_at, excluded.viewed_at)"},
+		}},
+	}).Create(&views).Error
+}
+
+func (r *ShopRepository) ListProductViews(userID uint, limit int) ([]ProductView, error) {
+	var views []ProductView
+	if err := r.Database.DB.Where("user_id = ?", userID).Order("viewed_at desc").Limit(limit).Find(&views).Error; err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
+func (r *ShopRepository) DeleteProductView(userID, productID uint) error {
+	return r.Database.DB.Where("user_id = ? AND product_id = ?", userID, productID).Delete(&ProductView{}).Error
+}
+
+func (r *ShopRepository) ClearProductViews(userID uint) error {
+	return r.Database.DB.Where("user_id = ?", userID).Delete(&ProductView{}).Error
+}
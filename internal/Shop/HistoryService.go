@@ -0,0 +1,180 @@
+package shop
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+// 浏览记录：history:user:{uid} 为有序集合，成员是商品ID、分数是浏览时间（毫秒），只保留最近 historyLimit 条；
+// history:dirty 记录有新浏览、等待归档到数据库的用户
+const (
+	historyLimit    = 100
+	historyDirtyKey = "history:dirty"
+)
+
+func historyKey(userID uint) string {
+	return fmt.Sprintf("history:user:%d", userID)
+}
+
+// ViewedProduct 浏览记录中的一项
+type ViewedProduct struct {
+	Product
+	ViewedAt time.Time
+}
+
+// RecordView 记录一次商品浏览，失败只记录日志
+func (s *ShopService) RecordView(ctx context.Context, userID, productID uint) {
+	if userID == 0 || productID == 0 {
+		return
+	}
+	now := time.Now()
+	if s.cache == nil {
+		if err := s.rep.UpsertProductViews([]ProductView{{UserID: userID, ProductID: productID, ViewedAt: now}}); err != nil {
+			logger.Warn("record_view_failed", map[string]interface{}{"user_id": userID, "error": err.Error()})
+		}
+		return
+	}
+	if err := s.ensureHistory(ctx, userID); err != nil {
+		logger.Warn("record_view_failed", map[string]interface{}{"user_id": userID, "error": err.Error()})
+		return
+	}
+	key := historyKey(userID)
+	_, err := s.cache.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: productID})
+		pipe.ZRemRangeByRank(ctx, key, 0, -historyLimit-1)
+		pipe.SAdd(ctx, historyDirtyKey, userID)
+		return nil
+	})
+	if err != nil {
+		logger.Warn("record_view_failed", map[string]interface{}{"user_id": userID, "error": err.Error()})
+	}
+}
+
+// ensureHistory Redis 中没有该用户的浏览记录时从归档加载
+func (s *ShopService) ensureHistory(ctx context.Context, userID uint) error {
+	key := historyKey(userID)
+	n, err := s.cache.Client.Exists(ctx, key).Result()
+	if err != nil || n > 0 {
+		return err
+	}
+	views, err := s.rep.ListProductViews(userID, historyLimit)
+	if err != nil || len(views) == 0 {
+		return err
+	}
+	members := make([]redis.Z, len(views))
+	for i, v := range views {
+		members[i] = redis.Z{Score: float64(v.ViewedAt.UnixMilli()), Member: v.ProductID}
+	}
+	return s.cache.Client.ZAdd(ctx, key, members...).Err()
+}
+
+// recentViews 返回最近浏览的商品ID及时间，按时间倒序
+func (s *ShopService) recentViews(ctx context.Context, userID uint, limit int) ([]ProductView, error) {
+	if s.cache == nil {
+		return s.rep.ListProductViews(userID, limit)
+	}
+	if err := s.ensureHistory(ctx, userID); err != nil {
+		return nil, err
+	}
+	entries, err := s.cache.Client.ZRevRangeWithScores(ctx, historyKey(userID), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	views := make([]ProductView, 0, len(entries))
+	for _, e := range entries {
+		id, err := strconv.ParseUint(fmt.Sprint(e.Member), 10, 64)
+		if err != nil {
+			continue
+		}
+		views = append(views, ProductView{UserID: userID, ProductID: uint(id), ViewedAt: time.UnixMilli(int64(e.Score))})
+	}
+	return views, nil
+}
+
+// ListHistory 返回用户最近浏览的商品，已删除或已下架的商品不返回
+func (s *ShopService) ListHistory(ctx context.Context, userID uint, limit int) ([]ViewedProduct, error) {
+	if limit <= 0 || limit > historyLimit {
+		limit = historyLimit
+	}
+	views, err := s.recentViews(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(views))
+	for i, v := range views {
+		ids[i] = v.ProductID
+	}
+	products, err := s.rep.ListProductsByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	items := make([]ViewedProduct, 0, len(views))
+	for _, v := range views {
+		if p, ok := byID[v.ProductID]; ok {
+			items = append(items, ViewedProduct{Product: p, ViewedAt: v.ViewedAt})
+		}
+	}
+	return items, nil
+}
+
+func (s *ShopService) DeleteHistoryItem(ctx context.Context, userID, productID uint) error {
+	if s.cache != nil {
+		if err := s.cache.Client.ZRem(ctx, historyKey(userID), productID).Err(); err != nil {
+			return err
+		}
+	}
+	return s.rep.DeleteProductView(userID, productID)
+}
+
+func (s *ShopService) ClearHistory(ctx context.Context, userID uint) error {
+	if s.cache != nil {
+		if err := s.cache.Client.Del(ctx, historyKey(userID)).Err(); err != nil {
+			return err
+		}
+	}
+	return s.rep.ClearProductViews(userID)
+}
+
+// ArchiveHistory 由后台任务调用，把有新浏览的用户的 Redis 浏览记录归档到数据库
+func (s *ShopService) ArchiveHistory(ctx context.Context) error {
+	if s.cache == nil {
+		return nil
+	}
+	for {
+		members, err := s.cache.Client.SPopN(ctx, historyDirtyKey, 100).Result()
+		if err != nil {
+			return fmt.Errorf("pop dirty history: %w", err)
+		}
+		if len(members) == 0 {
+			return nil
+		}
+		for i, m := range members {
+			userID, err := strconv.ParseUint(m, 10, 64)
+			if err != nil {
+				continue
+			}
+			views, err := s.recentViews(ctx, uint(userID), historyLimit)
+			if err == nil {
+				err = s.rep.UpsertProductViews(views)
+			}
+			if err != nil {
+				// 本批中尚未归档的用户（包括当前用户）全部放回去等下次重试
+				rest := make([]interface{}, 0, len(members)-i)
+				for _, r := range members[i:] {
+					rest = append(rest, r)
+				}
+				s.cache.Client.SAdd(ctx, historyDirtyKey, rest...)
+				return fmt.Errorf("archive history of user %d: %w", userID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package shop
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInsufficientStock  = errors.New("insufficient stock")
+	ErrProductUnavailable = errors.New("product is not available for purchase")
+)
+
+// StockMismatch 是库存一致性检查发现的差异
+type StockMismatch struct {
+	ProductID   uint `json:"product_id"`
+	ShopID      uint `json:"shop_id"`
+	Stock       int  `json:"stock"`        // products.stock
+	LedgerStock int  `json:"ledger_stock"` // 库存流水合计
+}
+
+// MovementFilter 库存流水查询条件，零值字段不参与过滤
+type MovementFilter struct {
+	ShopID      uint
+	ProductID   uint
+	WarehouseID uint
+	Reason      MovementReason
+	Reference   string
+	Limit       int
+	Offset      int
+}
+
+// StockHold 是订单下单时扣减、尚未返还的库存
+type StockHold struct {
+	ProductID   uint
+	WarehouseID uint
+	Quantity    int
+}
+
+// stockResult 是一次库存变动的结果
+type stockResult struct {
+	product     *Product       // 变动后的商品（只含 id、shop_id、name、stock、reorder_threshold、deleted_at）
+	alert       *LowStockAlert // 本次扣减新触发的低库存提醒
+	warehouseID uint           // 实际变动的仓库，店铺未启用多仓时为 0
+}
+
+// applyStockDeltaTx 是所有库存变动的唯一入口：原子地修改商品总库存和仓库库存、写入流水，并维护低库存提醒。
+// 扣减导致库存跌破补货阈值时返回新记录的提醒。
+func applyStockDeltaTx(tx *gorm.DB, id uint, delta int, change StockChange) (*stockResult, error) {
+	var updated Product
+	db := tx
+	if change.Reason == MovementCancellation || change.Reason == MovementReturn {
+		// 商品移入回收站后仍要能取消或退货；已永久删除的商品连同流水一起删除，不会再被返还
+		db = tx.Unscoped()
+	}
+	query := db.Model(&updated).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}, {Name: "shop_id"}, {Name: "name"}, {Name: "stock"}, {Name: "reorder_threshold"}, {Name: "deleted_at"}}}).
+		Where("id = ? AND stock + ? >= 0", id, delta)
+	if change.Reason == MovementCheckout {
+		// 下单只能购买已上架、店铺已通过审核的商品；条件和扣减在同一条语句里，避免检查之后商品被下架
+		query = query.Where("status = ?", ProductStatusPublished).Where(approvedShopSQL, ShopStatusApproved)
+	}
+	result := query.Update("stock", gorm.Expr("stock + ?", delta))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if change.Reason == MovementCheckout {
+			return nil, checkoutFailureTx(tx, id)
+		}
+		return nil, ErrInsufficientStock
+	}
+	warehouseID, err := applyWarehouseDeltaTx(tx, updated.ShopID, updated.ID, delta, change)
+	if err != nil {
+		return nil, err
+	}
+	res := &stockResult{product: &updated, warehouseID: warehouseID}
+	if err := tx.Create(&InventoryMovement{
+		ProductID:   updated.ID,
+		ShopID:      updated.ShopID,
+		WarehouseID: warehouseID,
+		Delta:       delta,
+		StockAfter:  updated.Stock,
+		Reason:      change.Reason,
+		Reference:   change.Reference,
+		ActorID:     change.ActorID,
+		Note:        change.Note,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if delta > 0 {
+		// 回收站中的商品不通知收藏用户到货
+		if updated.Stock-delta <= 0 && !updated.DeletedAt.Valid {
+			if err := tx.Create(&RestockEvent{ProductID: updated.ID, ProductName: updated.Name, Stock: updated.Stock}).Error; err != nil {
+				return nil, err
+			}
+		}
+		return res, resolveLowStockTx(tx, updated.ID)
+	}
+	threshold := updated.ReorderThreshold
+	if threshold <= 0 || updated.Stock > threshold || updated.Stock-delta <= threshold {
+		return res, nil
+	}
+	alert := &LowStockAlert{
+		ShopID:      updated.ShopID,
+		ProductID:   updated.ID,
+		ProductName: updated.Name,
+		Threshold:   threshold,
+		Stock:       updated.Stock,
+	}
+	// 已有未恢复的提醒时不再重复记录
+	created := tx.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "product_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "resolved_at IS NULL"}}},
+		DoNothing:   true,
+	}).Create(alert)
+	if created.Error != nil {
+		return nil, created.Error
+	}
+	if created.RowsAffected > 0 {
+		res.alert = alert
+	}
+	return res, nil
+}
+
+// checkoutFailureTx 下单扣减没有命中时，区分商品不可购买和库存不足
+func checkoutFailureTx(tx *gorm.DB, id uint) error {
+	var p Product
+	err := tx.Select("id", "status").Where(approvedShopSQL, ShopStatusApproved).First(&p, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrProductUnavailable
+	}
+	if err != nil {
+		return err
+	}
+	if p.Status != ProductStatusPublished {
+		return ErrProductUnavailable
+	}
+	return ErrInsufficientStock
+}
+
+// recordInitialStockTx 为新建商品写入初始库存流水；店铺已启用多仓时初始库存放入默认仓库
+func recordInitialStockTx(tx *gorm.DB, products []Product, actorID uint) error {
+	defaults := make(map[uint]uint)
+	movements := make([]InventoryMovement, 0, len(products))
+	for _, p := range products {
+		if p.Stock == 0 {
+			continue
+		}
+		warehouseID, ok := defaults[p.ShopID]
+		if !ok {
+			w, err := defaultWarehouseTx(tx, p.ShopID)
+			if err != nil {
+				return err
+			}
+			if w != nil {
+				warehouseID = w.ID
+			}
+			defaults[p.ShopID] = warehouseID
+		}
+		if warehouseID != 0 {
+			if err := addWarehouseStockTx(tx, warehouseID, p.ID, p.Stock); err != nil {
+				return err
+			}
+		}
+		movements = append(movements, InventoryMovement{
+			ProductID:   p.ID,
+			ShopID:      p.ShopID,
+			WarehouseID: warehouseID,
+			Delta:       p.Stock,
+			StockAfter:  p.Stock,
+			Reason:      MovementInitial,
+			ActorID:     actorID,
+		})
+	}
+	if len(movements) == 0 {
+		return nil
+	}
+	return tx.Create(&movements).Error
+}
+
+// IncreaseStockWithTx 增加库存（取消订单、退货等），返回变动后的库存
+func (r *ShopRepository) IncreaseStockWithTx(ctx context.Context, tx *gorm.DB, id uint, quantity int, change StockChange) (int, error) {
+	if quantity <= 0 {
+		return 0, errors.New("quantity must be greater than 0")
+	}
+	db := r.Database.DB
+	if tx != nil {
+		db = tx
+	}
+	res, err := applyStockDeltaTx(db, id, quantity, change)
+	if err != nil {
+		return 0, err
+	}
+	return res.product.Stock, nil
+}
+
+// OutstandingCheckoutWithTx 按商品和仓库汇总订单的下单、取消和退货流水，返回下单扣减后尚未返还的库存；
+// 订单没有经过下单扣减时返回空
+func (r *ShopRepository) OutstandingCheckoutWithTx(ctx context.Context, tx *gorm.DB, reference string) ([]StockHold, error) {
+	if reference == "" {
+		return nil, nil
+	}
+	db := r.Database.DB
+	if tx != nil {
+		db = tx
+	}
+	var holds []StockHold
+	err := db.WithContext(ctx).Model(&InventoryMovement{}).
+		Select("product_id, warehouse_id, -SUM(delta) AS quantity").
+		Where("reference = ? AND reason IN ?", reference, []MovementReason{MovementCheckout, MovementCancellation, MovementReturn}).
+		Group("product_id, warehouse_id").
+		Having("SUM(delta) < 0").
+		Order("product_id, warehouse_id").
+		Scan(&holds).Error
+	return holds, err
+}
+
+// AdjustStock 手工增减库存，返回变动后的商品和可能触发的低库存提醒
+func (r *ShopRepository) AdjustStock(id uint, delta int, change StockChange) (*Product, *LowStockAlert, error) {
+	if delta == 0 {
+		return nil, nil, errors.New("delta must not be 0")
+	}
+	var res *stockResult
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		res, err = applyStockDeltaTx(tx, id, delta, change)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return res.product, res.alert, nil
+}
+
+// SetStock 把库存设置为绝对值（批量导入），按差额写入流水；库存未变化时返回 nil。
+// 指定仓库时设置的是该仓库的库存，否则是商品总库存
+func (r *ShopRepository) SetStock(id uint, stock int, change StockChange) (*Product, *LowStockAlert, error) {
+	if stock < 0 {
+		return nil, nil, errors.New("stock must not be negative")
+	}
+	var res *stockResult
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var old Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&old, id).Error; err != nil {
+			return err
+		}
+		current := old.Stock
+		if change.WarehouseID != 0 {
+			var ws WarehouseStock
+			err := tx.Where("warehouse_id = ? AND product_id = ?", change.WarehouseID, id).First(&ws).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			current = ws.Stock
+		}
+		if current == stock {
+			return nil
+		}
+		var err error
+		res, err = applyStockDeltaTx(tx, id, stock-current, change)
+		return err
+	})
+	if err != nil || res == nil {
+		return nil, nil, err
+	}
+	return res.product, res.alert, nil
+}
+
+func (r *ShopRepository) ListMovements(f MovementFilter) ([]InventoryMovement, error) {
+	var movements []InventoryMovement
+	query := r.Database.DB.Model(&InventoryMovement{})
+	if f.ShopID != 0 {
+		query = query.Where("shop_id = ?", f.ShopID)
+	}
+	if f.ProductID != 0 {
+		query = query.Where("product_id = ?", f.ProductID)
+	}
+	if f.WarehouseID != 0 {
+		query = query.Where("warehouse_id = ?", f.WarehouseID)
+	}
+	if f.Reason != "" {
+		query = query.Where("reason = ?", f.Reason)
+	}
+	if f.Reference != "" {
+		query = query.Where("reference = ?", f.Reference)
+	}
+	if err := query.Order("id desc").Limit(f.Limit).Offset(f.Offset).Find(&movements).Error; err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+// CheckStockConsistency 找出 products.stock 与流水合计不一致的商品，shopID 为 0 时检查全部店铺
+func (r *ShopRepository) CheckStockConsistency(shopID uint) ([]StockMismatch, error) {
+	var mismatches []StockMismatch
+	query := r.Database.DB.Table("products AS p").
+		Select("p.id AS product_id, p.shop_id, p.stock, COALESCE(SUM(m.delta), 0) AS ledger_stock").
+		Joins("LEFT JOIN inventory_movements AS m ON m.product_id = p.id").
+		Where("p.deleted_at IS NULL")
+	if shopID != 0 {
+		query = query.Where("p.shop_id = ?", shopID)
+	}
+	if err := query.Group("p.id, p.shop_id, p.stock").
+		Having("p.stock <> COALESCE(SUM(m.delta), 0)").
+		Scan(&mismatches).Error; err != nil {
+		return nil, err
+	}
+	return mismatches, nil
+}
+
+// BackfillOpeningBalances 为引入流水之前就已存在、还没有任何流水的商品补一条期初记录
+func (r *ShopRepository) BackfillOpeningBalances() (int64, error) {
+	res := r.Database.DB.Exec(`
+INSERT INTO inventory_movements (product_id, shop_id, delta, stock_after, reason, reference, actor_id, note, created_at)
+SELECT p.id, p.shop_id, p.stock, p.stock, ?, '', 0, 'opening balance', ?
+FROM products p
+WHERE p.stock <> 0 AND NOT EXISTS (SELECT 1 FROM inventory_movements m WHERE m.product_id = p.id)`,
+		MovementInitial, time.Now())
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,126 @@
+package shop
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 列表排序方式
+const (
+	SortNewest    = "newest"     // 最新创建
+	SortPriceAsc  = "price_asc"  // 价格从低到高（仅商品）
+	SortPriceDesc = "price_desc" // 价格从高到低（仅商品）
+	SortSales     = "sales"      // 销量从高到低
+	SortName      = "name"       // 名称（仅店铺）
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidListQuery = errors.New("invalid list query")
+
+// 计入销量的订单状态
+var completedOrderStatuses = []string{"delivered", "completed"}
+
+// ListQuery 店铺和商品列表共用的分页、过滤和排序参数，从 query string 绑定。
+// 店铺列表的价格和有货过滤作用于店铺内已上架的商品：店铺至少有一个满足条件的商品才会返回
+type ListQuery struct {
+	Page     int      `form:"page"`
+	PageSize int      `form:"page_size"`
+	Keyword  string   `form:"q"`
+	MinPrice *float64 `form:"min_price"`
+	MaxPrice *float64 `form:"max_price"`
+	InStock  bool     `form:"in_stock"`
+	Sort     string   `form:"sort"`
+}
+
+// ListPage 分页结果
+type ListPage[T any] struct {
+	Items    []T   `json:"items"`
+	Page     int   `json:"page"`
+	PageSize int   `json:"page_size"`
+	Total    int64 `json:"total"`
+	HasMore  bool  `json:"has_more"`
+}
+
+func newListPage[T any](items []T, q ListQuery, total int64) *ListPage[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return &ListPage[T]{
+		Items:    items,
+		Page:     q.Page,
+		PageSize: q.PageSize,
+		Total:    total,
+		HasMore:  int64(q.Offset()+len(items)) < total,
+	}
+}
+
+// normalize 填充默认值并校验排序方式，allowed 为该列表支持的排序
+func (q *ListQuery) normalize(allowed ...string) error {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+	q.Keyword = strings.TrimSpace(q.Keyword)
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MinPrice > *q.MaxPrice {
+		return fmt.Errorf("%w: min_price must not be greater than max_price", errInvalidListQuery)
+	}
+	if q.Sort == "" {
+		q.Sort = SortNewest
+	}
+	for _, s := range allowed {
+		if q.Sort == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unsupported sort %q", errInvalidListQuery, q.Sort)
+}
+
+func (q ListQuery) Offset() int {
+	return (q.Page - 1) * q.PageSize
+}
+
+// cacheKey 把查询参数编码成缓存 key 的一部分
+func (q ListQuery) cacheKey() string {
+	price := func(p *float64) string {
+		if p == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%g", *p)
+	}
+	return fmt.Sprintf("%d:%d:%s:%s:%s:%t:%s", q.Page, q.PageSize, q.Sort, price(q.MinPrice), price(q.MaxPrice), q.InStock, q.Keyword)
+}
+
+// applyProductFilters 在商品表上应用价格和有货过滤
+func (q ListQuery) applyProductFilters(db *gorm.DB, table string) *gorm.DB {
+	if q.MinPrice != nil {
+		db = db.Where(table+".price >= ?", *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		db = db.Where(table+".price <= ?", *q.MaxPrice)
+	}
+	if q.InStock {
+		db = db.Where(table + ".stock > 0")
+	}
+	return db
+}
+
+// productSales 每个商品的销量子查询
+func productSales(db *gorm.DB) *gorm.DB {
+	return db.Table("order_items oi").
+		Select("oi.product_id, SUM(oi.quantity) AS sold").
+		Joins("JOIN orders o ON o.id = oi.order_id").
+		Where("o.status IN ? AND o.deleted_at IS NULL AND oi.deleted_at IS NULL", completedOrderStatuses).
+		Group("oi.product_id")
+}
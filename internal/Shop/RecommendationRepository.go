@@ -0,0 +1,89 @@
+package shop
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RebuildRecommendations 根据已完成订单的共同购买关系重新计算全部商品的相似商品，整表替换，返回写入的行数。
+// 共同购买订单数低于 minOrders 的商品对被视为噪声丢弃
+func (r *ShopRepository) RebuildRecommendations(topN, minOrders int) (int64, error) {
+	var rows int64
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM product_recommendations").Error; err != nil {
+			return err
+		}
+		res := tx.Exec(`
+WITH items AS (
+	SELECT DISTINCT oi.order_id, oi.product_id
+	FROM order_items oi
+	JOIN orders o ON o.id = oi.order_id
+	WHERE o.status IN ? AND o.deleted_at IS NULL AND oi.deleted_at IS NULL
+),
+counts AS (
+	SELECT product_id, COUNT(*) AS n FROM items GROUP BY product_id
+),
+pairs AS (
+	SELECT a.product_id, b.product_id AS related_id, COUNT(*) AS co
+	FROM items a
+	JOIN items b ON a.order_id = b.order_id AND a.product_id <> b.product_id
+	GROUP BY a.product_id, b.product_id
+	HAVING COUNT(*) >= ?
+),
+scored AS (
+	SELECT p.product_id, p.related_id, p.co,
+		p.co / sqrt(ca.n::float8 * cb.n::float8) AS score
+	FROM pairs p
+	JOIN counts ca ON ca.product_id = p.product_id
+	JOIN counts cb ON cb.product_id = p.related_id
+),
+ranked AS (
+	SELECT *, ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY score DESC, co DESC, related_id) AS rank
+	FROM scored
+)
+INSERT INTO product_recommendations (product_id, related_id, score, orders, rank, updated_at)
+SELECT product_id, related_id, score, co, rank, ?
+FROM ranked
+WHERE rank <= ?`, completedOrderStatuses, minOrders, time.Now(), topN)
+		rows = res.RowsAffected
+		return res.Error
+	})
+	return rows, err
+}
+
+// ListRecommendedProducts 按名次返回相似商品中已上架且店铺已通过审核的部分
+func (r *ShopRepository) ListRecommendedProducts(productID uint, limit int) ([]Product, error) {
+	var products []Product
+	err := r.Database.DB.Model(&Product{}).Select("products.*").
+		Joins("JOIN product_recommendations pr ON pr.related_id = products.id").
+		Where("pr.product_id = ? AND products.status = ?", productID, ProductStatusPublished).
+		Where(approvedShopSQL, ShopStatusApproved).
+		Order("pr.rank").Limit(limit).Find(&products).Error
+	return products, err
+}
+
+// ListCategoryBestSellers 返回与该商品同分类的畅销商品，商品没有分类时返回同店铺的畅销商品
+func (r *ShopRepository) ListCategoryBestSellers(productID uint, exclude []uint, limit int) ([]Product, error) {
+	var categoryIDs []uint
+	if err := r.Database.DB.Table("product_categories").Where("product_id = ?", productID).
+		Pluck("category_id", &categoryIDs).Error; err != nil {
+		return nil, err
+	}
+	query := r.Database.DB.Model(&Product{}).
+		Joins("LEFT JOIN (?) s ON s.product_id = products.id", productSales(r.Database.DB)).
+		Where("products.id <> ? AND products.status = ?", productID, ProductStatusPublished).
+		Where(approvedShopSQL, ShopStatusApproved)
+	if len(exclude) > 0 {
+		query = query.Where("products.id NOT IN ?", exclude)
+	}
+	if len(categoryIDs) > 0 {
+		query = query.Where("products.id IN (?)",
+			r.Database.DB.Table("product_categories").Select("product_id").Where("category_id IN ?", categoryIDs))
+	} else {
+		query = query.Where("products.shop_id = (?)", r.Database.DB.Model(&Product{}).Select("shop_id").Where("id = ?", productID))
+	}
+	var products []Product
+	err := query.Select("products.*").Order("COALESCE(s.sold, 0) DESC, products.id DESC").Limit(limit).Find(&products).Error
+	return products, err
+}
@@ -0,0 +1,66 @@
+package shop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/myproject/shop/pkg/logger"
+)
+
+const (
+	recommendationTopN      = 20 // 每个商品保存的相似商品数
+	recommendationMinOrders = 2  // 共同购买至少出现在这么多个订单中才计入
+	recommendationTTL       = 10 * time.Minute
+)
+
+// RebuildRecommendations 由后台任务调用，离线重新计算“买了又买”相似商品
+func (s *ShopService) RebuildRecommendations(ctx context.Context) error {
+	started := time.Now()
+	rows, err := s.rep.RebuildRecommendations(recommendationTopN, recommendationMinOrders)
+	if err != nil {
+		return fmt.Errorf("rebuild recommendations: %w", err)
+	}
+	logger.Info("recommendations_rebuilt", map[string]interface{}{
+		"rows":     rows,
+		"duration": time.Since(started).String(),
+	})
+	return nil
+}
+
+// ListRecommendations 返回相似商品；共同购买数据不足 limit 个时用同分类畅销商品补齐
+func (s *ShopService) ListRecommendations(ctx context.Context, productID uint, limit int) ([]Product, error) {
+	if productID == 0 {
+		return nil, errors.New("invalid product")
+	}
+	if limit <= 0 || limit > recommendationTopN {
+		limit = 10
+	}
+	cacheKey := fmt.Sprintf("product:recs:%d:%d", productID, limit)
+	var products []Product
+	if s.cache != nil {
+		if ok, err := s.cache.GetObject(ctx, cacheKey, &products); err == nil && ok {
+			return products, nil
+		}
+	}
+	products, err := s.rep.ListRecommendedProducts(productID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(products) < limit {
+		exclude := make([]uint, len(products))
+		for i, p := range products {
+			exclude[i] = p.ID
+		}
+		fill, err := s.rep.ListCategoryBestSellers(productID, exclude, limit-len(products))
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, fill...)
+	}
+	if s.cache != nil {
+		_ = s.cache.SetObjectWithTTL(ctx, cacheKey, products, recommendationTTL)
+	}
+	return products, nil
+}
@@ -0,0 +1,79 @@
+package shop
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type reviewShopReq struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+func writeReviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+	case errors.Is(err, ErrShopNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListShopReviews GET /api/admin/shops/reviews?status=pending&page=&page_size=
+func (h *ShopHandler) ListShopReviews(c *gin.Context) {
+	status := ShopStatus(c.DefaultQuery("status", string(ShopStatusPending)))
+	switch status {
+	case ShopStatusPending, ShopStatusApproved, ShopStatusRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	shops, total, err := h.service.ListShopsByStatus(status, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if shops == nil {
+		shops = []Shop{}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": shops, "total": total})
+}
+
+// ApproveShop POST /api/admin/shops/:id/approve
+func (h *ShopHandler) ApproveShop(c *gin.Context) {
+	h.reviewShop(c, true)
+}
+
+// RejectShop POST /api/admin/shops/:id/reject，必须说明原因
+func (h *ShopHandler) RejectShop(c *gin.Context) {
+	h.reviewShop(c, false)
+}
+
+func (h *ShopHandler) reviewShop(c *gin.Context, approve bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req reviewShopReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !approve && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required when rejecting"})
+		return
+	}
+	reviewerID, _ := getUserID(c)
+	sh, err := h.service.ReviewShop(c.Request.Context(), uint(id), reviewerID, approve, req.Reason)
+	if err != nil {
+		writeReviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sh)
+}
@@ -0,0 +1,24 @@
+package shop
+
+import "time"
+
+// ListShopsByStatus 按审核状态分页查询店铺，最早提交的在前
+func (r *ShopRepository) ListShopsByStatus(status ShopStatus, limit, offset int) ([]Shop, int64, error) {
+	query := r.Database.DB.Model(&Shop{}).Where("status = ?", status)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var shops []Shop
+	if err := query.Order("id").Limit(limit).Offset(offset).Find(&shops).Error; err != nil {
+		return nil, 0, err
+	}
+	return shops, total, nil
+}
+
+// ReviewShop 只能审核待审核的店铺，返回是否更新成功
+func (r *ShopRepository) ReviewShop(id uint, status ShopStatus, reason string, reviewerID uint, at time.Time) (bool, error) {
+	res := r.Database.DB.Model(&Shop{}).Where("id = ? AND status = ?", id, ShopStatusPending).
+		Updates(map[string]interface{}{"status": status, "review_reason": reason, "reviewed_by": reviewerID, "reviewed_at": at})
+	return res.RowsAffected > 0, res.Error
+}
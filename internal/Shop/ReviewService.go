@@ -0,0 +1,72 @@
+package shop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	audit "github.com/myproject/shop/internal/Audit"
+	notification "github.com/myproject/shop/internal/Notification"
+	"github.com/myproject/shop/pkg/logger"
+)
+
+var ErrShopNotPending = errors.New("shop is not pending review")
+
+// ListShopsByStatus 管理后台的店铺审核队列
+func (s *ShopService) ListShopsByStatus(status ShopStatus, page, pageSize int) ([]Shop, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return s.rep.ListShopsByStatus(status, pageSize, (page-1)*pageSize)
+}
+
+// ReviewShop 审核店铺，通过后出现在店铺列表中；结果通知店主
+func (s *ShopService) ReviewShop(ctx context.Context, id, reviewerID uint, approve bool, reason string) (*Shop, error) {
+	status := ShopStatusRejected
+	if approve {
+		status = ShopStatusApproved
+	}
+	ok, err := s.rep.ReviewShop(id, status, reason, reviewerID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if _, err := s.rep.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrShopNotPending
+	}
+	if s.cache != nil {
+		_ = s.cache.DelteKey(ctx, "shop_"+strconv.FormatUint(uint64(id), 10))
+		s.invalidateShopList()
+	}
+	action := audit.ActionReject
+	if approve {
+		action = audit.ActionApprove
+	}
+	s.audit.Record(ctx, audit.Entry{
+		ActorID: reviewerID, Action: action, ResourceType: audit.ResourceShop, ResourceID: audit.ID(id),
+		Before: map[string]interface{}{"status": ShopStatusPending}, After: map[string]interface{}{"status": status},
+		Detail: map[string]interface{}{"reason": reason},
+	})
+	sh, err := s.rep.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	title := fmt.Sprintf("店铺 %s 审核通过", sh.Name)
+	if !approve {
+		title = fmt.Sprintf("店铺 %s 审核未通过", sh.Name)
+	}
+	if err := s.notifier.Notify(ctx, sh.OwnerID, notification.TypeShopReview, title, reason); err != nil {
+		logger.Warn("shop_review_notify_failed", map[string]interface{}{"shop_id": id, "error": err.Error()})
+	}
+	return sh, nil
+}
@@ -1,33 +1,85 @@
 package shop
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	rbac "github.com/myproject/shop/internal/Rbac"
+	"github.com/myproject/shop/pkg/middleware"
 	"gorm.io/gorm"
 )
 
 type ShopHandler struct {
 	service *ShopService
+	rbac    *rbac.RbacService
+	auth    *ShopAuthorizer
 }
 
-func NewShopHandler(service *ShopService) *ShopHandler {
-	return &ShopHandler{service: service}
+func NewShopHandler(service *ShopService, rbacS *rbac.RbacService, auth *ShopAuthorizer) *ShopHandler {
+	return &ShopHandler{service: service, rbac: rbacS, auth: auth}
 }
 
 type createProductReq struct {
-	Name        string  `json:"name" binding:"required"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price" binding:"required"`
-	Stock       int     `json:"stock"`
-	ProductImg  string  `json:"product_img"`
+	Name        string        `json:"name" binding:"required"`
+	Description string        `json:"description"`
+	Price       float64       `json:"price" binding:"required"`
+	Stock       int           `json:"stock"`
+	ProductImg  string        `json:"product_img"`
+	Status      ProductStatus `json:"status" binding:"omitempty,oneof=draft published archived"`
+	PublishAt   *time.Time    `json:"publish_at"`
+	UnpublishAt *time.Time    `json:"unpublish_at"`
+
+	ReorderThreshold int `json:"reorder_threshold" binding:"min=0"`
+}
+
+type adjustStockReq struct {
+	Delta       int    `json:"delta" binding:"required"`
+	WarehouseID uint   `json:"warehouse_id"` // 为空时扣减自动选仓，增加放入默认仓库
+	Note        string `json:"note" binding:"max=255"`
+}
+
+type importStockReq struct {
+	Items       []StockImportItem `json:"items" binding:"required,min=1,dive"`
+	WarehouseID uint              `json:"warehouse_id"` // 指定时导入的是该仓库的库存
+	Note        string            `json:"note" binding:"max=255"`
+}
+
+type warehouseReq struct {
+	Name      string  `json:"name" binding:"required,max=100"`
+	Address   string  `json:"address" binding:"max=255"`
+	Latitude  float64 `json:"latitude" binding:"min=-90,max=90"`
+	Longitude float64 `json:"longitude" binding:"min=-180,max=180"`
+	Priority  int     `json:"priority"`
+	IsActive  *bool   `json:"is_active"`
+}
+
+type warehouseStockReq struct {
+	ProductID uint   `json:"product_id" binding:"required"`
+	Stock     *int   `json:"stock" binding:"required,min=0"`
+	Note      string `json:"note" binding:"max=255"`
+}
+
+type reorderThresholdReq struct {
+	Threshold *int `json:"threshold" binding:"required,min=0"`
+}
+
+type priceAlertReq struct {
+	TargetPrice float64 `json:"target_price" binding:"required,gt=0"`
+}
+
+type updateProductStatusReq struct {
+	Status      ProductStatus `json:"status" binding:"required,oneof=draft published archived"`
+	PublishAt   *time.Time    `json:"publish_at"`
+	UnpublishAt *time.Time    `json:"unpublish_at"`
 }
 
 type createShopReq struct {
 	Name        string             `json:"name" binding:"required"`
 	Description string             `json:"description"`
-	OwnerID     uint               `json:"owner_id" binding:"required"`
+	OwnerID     uint               `json:"owner_id"` // 只有可管理任意店铺的角色能为他人开店，其他人固定为自己
 	Products    []createProductReq `json:"products"`
 }
 
@@ -41,13 +93,106 @@ type batchDeleteReq struct {
 	IDs []uint `json:"ids" binding:"required,min=1,dive"`
 }
 
-func (h *ShopHandler) ListShops(c *gin.Context) {
-	shops, err := h.service.List(50, 0)
+func getUserID(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(middleware.CtxUserIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(uint)
+	return id, ok
+}
+
+func getUserRole(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(middleware.CtxUserRoleKey)
+	if !ok {
+		return 0, false
+	}
+	role, ok := v.(uint)
+	return role, ok
+}
+
+// canManageShop 当前用户能否在店铺内行使 perm：店主、拥有该权限的店铺员工，或可管理任意店铺的角色
+func (h *ShopHandler) canManageShop(c *gin.Context, shopID uint, perm string) bool {
+	return h.auth.CanManageShop(c, shopID, perm)
+}
+
+// productVisible 顾客只能看到已通过审核店铺中已上架的商品，店铺管理者可以看到自己店铺的全部商品
+func (h *ShopHandler) productVisible(c *gin.Context, p *Product) bool {
+	if p.IsPublished() {
+		if s, err := h.service.GetShopByID(p.ShopID); err == nil && s != nil && s.IsApproved() {
+			return true
+		}
+	}
+	return h.canManageShop(c, p.ShopID, rbac.PermProductWrite)
+}
+
+// visibleProduct 加载路径中的商品，当前用户看不到时返回 404，避免泄露草稿、下架或未审核店铺商品的存在
+func (h *ShopHandler) visibleProduct(c *gin.Context) (*Product, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	p, err := h.service.GetProductByCode(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !h.productVisible(c, p)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return nil, false
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return p, true
+}
+
+// authorizeShops 校验当前用户能否在这些店铺内行使 perm，失败时已写入响应
+func (h *ShopHandler) authorizeShops(c *gin.Context, perm string, shopIDs ...uint) bool {
+	for _, id := range shopIDs {
+		if !h.canManageShop(c, id, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			return false
+		}
+	}
+	return true
+}
+
+// authorizeProducts 校验当前用户能否在这些商品所属的店铺内行使 perm，失败时已写入响应
+func (h *ShopHandler) authorizeProducts(c *gin.Context, perm string, productIDs ...uint) bool {
+	for _, id := range productIDs {
+		p, err := h.service.GetProductByCode(id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if !h.authorizeShops(c, perm, p.ShopID) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListShops GET /shops?page=&page_size=&q=&min_price=&max_price=&in_stock=&sort=newest|name|sales
+func (h *ShopHandler) ListShops(c *gin.Context) {
+	var q ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, shops)
+	page, err := h.service.List(q)
+	if err != nil {
+		writeListError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// writeListError 参数错误返回 400，其余返回 500
+func writeListError(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidListQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
 
 func (h *ShopHandler) GetShop(c *gin.Context) {
@@ -57,6 +202,12 @@ func (h *ShopHandler) GetShop(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// 未通过审核的店铺只有店主、员工和管理员能看到
+	if !s.IsApproved() && !h.canManageShop(c, s.ID, rbac.PermShopWrite) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
+	s.FollowerCount, _ = h.service.FollowerCount(c.Request.Context(), s.ID)
 	c.JSON(http.StatusOK, s)
 }
 
@@ -66,11 +217,21 @@ func (h *ShopHandler) CreateShop(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	userID, _ := getUserID(c)
+	role, _ := getUserRole(c)
+	if req.OwnerID == 0 || !h.rbac.RoleHasPermission(c.Request.Context(), role, rbac.PermShopAny) {
+		req.OwnerID = userID
+	}
 	sh := Shop{
 		Name:        req.Name,
 		Description: req.Description,
 		OwnerID:     req.OwnerID,
 		Products:    make([]Product, len(req.Products)),
+		Status:      ShopStatusPending,
+	}
+	// 管理员开的店无需审核，商家新开的店审核通过后才对顾客可见
+	if h.rbac.RoleHasPermission(c.Request.Context(), role, rbac.PermMerchantReview) {
+		sh.Status = ShopStatusApproved
 	}
 	for i := range req.Products {
 		sh.Products[i] = Product{
@@ -81,7 +242,7 @@ func (h *ShopHandler) CreateShop(c *gin.Context) {
 			ProductImg:  req.Products[i].ProductImg,
 		}
 	}
-	if err := h.service.CreateShop(&sh); err != nil {
+	if err := h.service.CreateShop(c.Request.Context(), &sh); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -90,6 +251,9 @@ func (h *ShopHandler) CreateShop(c *gin.Context) {
 
 func (h *ShopHandler) UpdateShop(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeShops(c, rbac.PermShopWrite, uint(id)) {
+		return
+	}
 	var req updateShopReq
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -112,7 +276,8 @@ func (h *ShopHandler) UpdateShop(c *gin.Context) {
 			}
 		}
 	}
-	if err := h.service.UpdateShop(&sh); err != nil {
+	actorID, _ := getUserID(c)
+	if err := h.service.UpdateShop(c.Request.Context(), &sh, actorID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -121,7 +286,10 @@ func (h *ShopHandler) UpdateShop(c *gin.Context) {
 
 func (h *ShopHandler) DeleteShop(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := h.service.Delete(uint(id)); err != nil {
+	if !h.authorizeShops(c, rbac.PermShopWrite, uint(id)) {
+		return
+	}
+	if err := h.service.Delete(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -134,7 +302,10 @@ func (h *ShopHandler) BatchDeleteShops(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.service.BatchDelete(req.IDs); err != nil {
+	if !h.authorizeShops(c, rbac.PermShopWrite, req.IDs...) {
+		return
+	}
+	if err := h.service.BatchDelete(c.Request.Context(), req.IDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -144,6 +315,9 @@ func (h *ShopHandler) BatchDeleteShops(c *gin.Context) {
 // Product handlers - avoid redundant shop updates
 func (h *ShopHandler) CreateProduct(c *gin.Context) {
 	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeShops(c, rbac.PermProductWrite, uint(shopID)) {
+		return
+	}
 	var req createProductReq
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -155,8 +329,17 @@ func (h *ShopHandler) CreateProduct(c *gin.Context) {
 		Price:       req.Price,
 		Stock:       req.Stock,
 		ProductImg:  req.ProductImg,
+		Status:      req.Status,
+		PublishAt:   req.PublishAt,
+		UnpublishAt: req.UnpublishAt,
+
+		ReorderThreshold: req.ReorderThreshold,
+	}
+	if p.Status == "" {
+		p.Status = ProductStatusPublished
 	}
-	if err := h.service.CreateProduct(uint(shopID), &p); err != nil {
+	actorID, _ := getUserID(c)
+	if err := h.service.CreateProduct(uint(shopID), &p, actorID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -164,12 +347,14 @@ func (h *ShopHandler) CreateProduct(c *gin.Context) {
 }
 
 func (h *ShopHandler) GetProductByCode(c *gin.Context) {
-	id, _ := strconv.Atoi(c.Param("id"))
-	p, err := h.service.GetProductByCode(uint(id))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	p, ok := h.visibleProduct(c)
+	if !ok {
 		return
 	}
+	p.FavoriteCount, _ = h.service.FavoriteCount(c.Request.Context(), p.ID)
+	if userID, ok := getUserID(c); ok && p.IsPublished() {
+		h.service.RecordView(c.Request.Context(), userID, p.ID)
+	}
 	c.JSON(http.StatusOK, p)
 }
 
@@ -181,25 +366,46 @@ func (h *ShopHandler) GetProductByName(c *gin.Context) {
 		return
 	}
 	p, err := h.service.GetProductByName(uint(shopID), name)
-	if err.Error() == "record not found" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
-		return
-	}
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// 草稿和已下架商品只对店铺管理者可见
+	if !h.productVisible(c, p) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
 	c.JSON(http.StatusOK, p)
 }
 
+// ListProducts GET /shops/:id/products?page=&page_size=&q=&min_price=&max_price=&in_stock=&sort=newest|price_asc|price_desc|sales
 func (h *ShopHandler) ListProducts(c *gin.Context) {
 	shopID, _ := strconv.Atoi(c.Param("id"))
-	products, err := h.service.ListProductsByShop(uint(shopID), 50, 0)
+	var q ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var page *ListPage[Product]
+	var err error
+	if h.canManageShop(c, uint(shopID), rbac.PermProductWrite) {
+		page, err = h.service.ListAllProductsByShop(uint(shopID), q)
+	} else {
+		if s, err := h.service.GetShopByID(uint(shopID)); err == nil && !s.IsApproved() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+			return
+		}
+		page, err = h.service.ListProductsByShop(uint(shopID), q)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeListError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, products)
+	c.JSON(http.StatusOK, page)
 }
 
 type updateProductReq struct {
@@ -212,6 +418,9 @@ type updateProductReq struct {
 
 func (h *ShopHandler) UpdateProduct(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeProducts(c, rbac.PermProductWrite, uint(id)) {
+		return
+	}
 	var req updateProductReq
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -225,16 +434,128 @@ func (h *ShopHandler) UpdateProduct(c *gin.Context) {
 		Stock:       req.Stock,
 		ProductImg:  req.ProductImg,
 	}
-	if err := h.service.UpdateProduct(&p); err != nil {
+	actorID, _ := getUserID(c)
+	if err := h.service.UpdateProduct(c.Request.Context(), &p, actorID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "product updated"})
 }
 
+// UpdateProductStatus PATCH /products/:id/status
+func (h *ShopHandler) UpdateProductStatus(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeProducts(c, rbac.PermProductWrite, uint(id)) {
+		return
+	}
+	var req updateProductStatusReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := h.service.SetProductStatus(uint(id), req.Status, req.PublishAt, req.UnpublishAt)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// GetPriceHistory GET /products/:id/price-history?limit=50
+func (h *ShopHandler) GetPriceHistory(c *gin.Context) {
+	p, ok := h.visibleProduct(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	history, err := h.service.ListPriceHistory(p.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// GetRecommendations GET /products/:id/recommendations?limit=
+func (h *ShopHandler) GetRecommendations(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	products, err := h.service.ListRecommendations(c.Request.Context(), uint(id), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, products)
+}
+
+// SubscribePriceAlert POST /products/:id/price-alerts
+func (h *ShopHandler) SubscribePriceAlert(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	p, ok := h.visibleProduct(c)
+	if !ok {
+		return
+	}
+	var req priceAlertReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	alert, err := h.service.SubscribePriceAlert(userID, p.ID, req.TargetPrice)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, alert)
+}
+
+// UnsubscribePriceAlert DELETE /products/:id/price-alerts
+func (h *ShopHandler) UnsubscribePriceAlert(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.service.UnsubscribePriceAlert(userID, uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "price alert removed"})
+}
+
+// ListPriceAlerts GET /price-alerts
+func (h *ShopHandler) ListPriceAlerts(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	alerts, err := h.service.ListPriceAlerts(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, alerts)
+}
+
 func (h *ShopHandler) DeleteProduct(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := h.service.DeleteProduct(uint(id)); err != nil {
+	if !h.authorizeProducts(c, rbac.PermProductWrite, uint(id)) {
+		return
+	}
+	if err := h.service.DeleteProduct(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -247,7 +568,10 @@ func (h *ShopHandler) BatchDeleteProducts(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.service.BatchDeleteProducts(req.IDs); err != nil {
+	if !h.authorizeProducts(c, rbac.PermProductWrite, req.IDs...) {
+		return
+	}
+	if err := h.service.BatchDeleteProducts(c.Request.Context(), req.IDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -261,3 +585,402 @@ func (h *ShopHandler) BatchDeleteProducts(c *gin.Context) {
 type BuyProudctRequset struct {
 	ProductId uint `json:"product_id"`
 }
+
+//=========================库存提醒==================
+
+// SetReorderThreshold PATCH /products/:id/inventory/threshold
+func (h *ShopHandler) SetReorderThreshold(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeProducts(c, rbac.PermInventoryWrite, uint(id)) {
+		return
+	}
+	var req reorderThresholdReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := h.service.SetReorderThreshold(uint(id), *req.Threshold)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "threshold updated"})
+}
+
+// ListInventoryAlerts GET /shops/:id/inventory/alerts?all=true
+func (h *ShopHandler) ListInventoryAlerts(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.canManageShop(c, uint(shopID), rbac.PermInventoryWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	alerts, err := h.service.ListLowStockAlerts(uint(shopID), c.Query("all") != "true", limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, alerts)
+}
+
+//=========================库存流水==================
+
+// AdjustStock POST /products/:id/inventory/adjust
+func (h *ShopHandler) AdjustStock(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeProducts(c, rbac.PermInventoryWrite, uint(id)) {
+		return
+	}
+	var req adjustStockReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actorID, _ := getUserID(c)
+	p, err := h.service.AdjustStock(uint(id), req.Delta, StockChange{ActorID: actorID, Note: req.Note, WarehouseID: req.WarehouseID})
+	if errors.Is(err, ErrInsufficientStock) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrWarehouseNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"product_id": p.ID, "stock": p.Stock})
+}
+
+// ImportStock POST /shops/:id/inventory/import
+func (h *ShopHandler) ImportStock(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.canManageShop(c, uint(shopID), rbac.PermInventoryWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
+	}
+	var req importStockReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actorID, _ := getUserID(c)
+	results, err := h.service.ImportStock(uint(shopID), req.Items, StockChange{ActorID: actorID, Note: req.Note, WarehouseID: req.WarehouseID})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": results})
+}
+
+// ListMovements GET /shops/:id/inventory/movements?product_id=&warehouse_id=&reason=&reference=
+func (h *ShopHandler) ListMovements(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.canManageShop(c, uint(shopID), rbac.PermInventoryWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
+	}
+	productID, _ := strconv.Atoi(c.Query("product_id"))
+	warehouseID, _ := strconv.Atoi(c.Query("warehouse_id"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	movements, err := h.service.ListMovements(MovementFilter{
+		ShopID:      uint(shopID),
+		ProductID:   uint(productID),
+		WarehouseID: uint(warehouseID),
+		Reason:      MovementReason(c.Query("reason")),
+		Reference:   c.Query("reference"),
+		Limit:       limit,
+		Offset:      offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, movements)
+}
+
+// CheckInventory GET /shops/:id/inventory/check
+func (h *ShopHandler) CheckInventory(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.canManageShop(c, uint(shopID), rbac.PermInventoryWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
+	}
+	mismatches, err := h.service.CheckStockConsistency(uint(shopID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"consistent": len(mismatches) == 0, "mismatches": mismatches})
+}
+
+//=========================回收站==================
+
+// trashScope 可管理任意店铺的角色返回 0 表示不限店主，其他人只能操作自己店铺的回收站
+func (h *ShopHandler) trashScope(c *gin.Context) (uint, bool) {
+	role, ok := getUserRole(c)
+	if !ok {
+		return 0, false
+	}
+	if h.rbac.RoleHasPermission(c.Request.Context(), role, rbac.PermShopAny) {
+		return 0, true
+	}
+	return getUserID(c)
+}
+
+func (h *ShopHandler) ListDeletedShops(c *gin.Context) {
+	ownerID, ok := h.trashScope(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	shops, err := h.service.ListDeletedShops(ownerID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, shops)
+}
+
+func (h *ShopHandler) ListDeletedProducts(c *gin.Context) {
+	ownerID, ok := h.trashScope(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
+	}
+	shopID, _ := strconv.Atoi(c.Query("shop_id"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	products, err := h.service.ListDeletedProducts(ownerID, uint(shopID), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, products)
+}
+
+// authorizeTrash 校验当前用户能否操作属于 ownerOf 返回店主的回收站条目
+func (h *ShopHandler) authorizeTrash(c *gin.Context, ownerOf func() (uint, error)) bool {
+	scope, ok := h.trashScope(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return false
+	}
+	owner, err := ownerOf()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found in trash"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if scope != 0 && scope != owner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return false
+	}
+	return true
+}
+
+func writeTrashResult(c *gin.Context, err error, message string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found in trash"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// RestoreShop POST /trash/shops/:id/restore
+func (h *ShopHandler) RestoreShop(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeTrash(c, func() (uint, error) { return h.service.DeletedShopOwner(uint(id)) }) {
+		return
+	}
+	writeTrashResult(c, h.service.RestoreShop(c.Request.Context(), uint(id)), "shop restored")
+}
+
+// RestoreProduct POST /trash/products/:id/restore
+func (h *ShopHandler) RestoreProduct(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeTrash(c, func() (uint, error) { return h.service.ProductOwner(uint(id)) }) {
+		return
+	}
+	writeTrashResult(c, h.service.RestoreProduct(c.Request.Context(), uint(id)), "product restored")
+}
+
+// PurgeShop DELETE /trash/shops/:id
+func (h *ShopHandler) PurgeShop(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeTrash(c, func() (uint, error) { return h.service.DeletedShopOwner(uint(id)) }) {
+		return
+	}
+	writeTrashResult(c, h.service.PurgeShop(c.Request.Context(), uint(id)), "shop purged")
+}
+
+// PurgeProduct DELETE /trash/products/:id
+func (h *ShopHandler) PurgeProduct(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeTrash(c, func() (uint, error) { return h.service.ProductOwner(uint(id)) }) {
+		return
+	}
+	writeTrashResult(c, h.service.PurgeProduct(c.Request.Context(), uint(id)), "product purged")
+}
+
+//=========================仓库==================
+
+// CreateWarehouse POST /shops/:id/warehouses
+func (h *ShopHandler) CreateWarehouse(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.canManageShop(c, uint(shopID), rbac.PermInventoryWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
+	}
+	var req warehouseReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	w := Warehouse{
+		ShopID:    uint(shopID),
+		Name:      req.Name,
+		Address:   req.Address,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Priority:  req.Priority,
+		IsActive:  req.IsActive == nil || *req.IsActive,
+	}
+	if err := h.service.CreateWarehouse(&w); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, w)
+}
+
+// ListWarehouses GET /shops/:id/warehouses
+func (h *ShopHandler) ListWarehouses(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.canManageShop(c, uint(shopID), rbac.PermInventoryWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
+	}
+	warehouses, err := h.service.ListWarehouses(uint(shopID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, warehouses)
+}
+
+// loadWarehouse 读取路径中的仓库并校验当前用户能否管理其所属店铺，失败时已写入响应
+func (h *ShopHandler) loadWarehouse(c *gin.Context) (*Warehouse, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	w, err := h.service.GetWarehouse(uint(id))
+	if errors.Is(err, ErrWarehouseNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !h.canManageShop(c, w.ShopID, rbac.PermInventoryWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return nil, false
+	}
+	return w, true
+}
+
+// UpdateWarehouse PATCH /warehouses/:id
+func (h *ShopHandler) UpdateWarehouse(c *gin.Context) {
+	w, ok := h.loadWarehouse(c)
+	if !ok {
+		return
+	}
+	var req warehouseReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	w.Name = req.Name
+	w.Address = req.Address
+	w.Latitude = req.Latitude
+	w.Longitude = req.Longitude
+	w.Priority = req.Priority
+	if req.IsActive != nil {
+		w.IsActive = *req.IsActive
+	}
+	if err := h.service.UpdateWarehouse(w); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+// DeleteWarehouse DELETE /warehouses/:id，仓库仍有库存时拒绝删除
+func (h *ShopHandler) DeleteWarehouse(c *gin.Context) {
+	w, ok := h.loadWarehouse(c)
+	if !ok {
+		return
+	}
+	err := h.service.DeleteWarehouse(w.ID)
+	if errors.Is(err, ErrWarehouseNotEmpty) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "warehouse deleted"})
+}
+
+// ListWarehouseStock GET /warehouses/:id/stock
+func (h *ShopHandler) ListWarehouseStock(c *gin.Context) {
+	w, ok := h.loadWarehouse(c)
+	if !ok {
+		return
+	}
+	stocks, err := h.service.ListWarehouseStock(w.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stocks)
+}
+
+// SetWarehouseStock PUT /warehouses/:id/stock
+func (h *ShopHandler) SetWarehouseStock(c *gin.Context) {
+	w, ok := h.loadWarehouse(c)
+	if !ok {
+		return
+	}
+	var req warehouseStockReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actorID, _ := getUserID(c)
+	p, err := h.service.SetWarehouseStock(w, req.ProductID, *req.Stock, StockChange{ActorID: actorID, Note: req.Note})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"product_id": p.ID, "warehouse_id": w.ID, "stock": *req.Stock, "total_stock": p.Stock})
+}
@@ -1,15 +1,45 @@
 package shop
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+type ProductStatus string
+
+const (
+	ProductStatusDraft     ProductStatus = "draft"     // 草稿，仅商家可见
+	ProductStatusPublished ProductStatus = "published" // 已上架，顾客可见
+	ProductStatusArchived  ProductStatus = "archived"  // 已下架，仅商家可见
+)
+
+type ShopStatus string
+
+const (
+	ShopStatusPending  ShopStatus = "pending"  // 待审核，不出现在店铺列表中
+	ShopStatusApproved ShopStatus = "approved" // 审核通过
+	ShopStatusRejected ShopStatus = "rejected" // 审核未通过
+)
+
 type Shop struct {
 	gorm.Model
 	Name        string    `gorm:"size:100;not null"` // 商店名称Name
 	Description string    `gorm:"size:255"`          // 商店描述
 	OwnerID     uint      `gorm:"index"`             // 店主用户ID
 	Products    []Product `gorm:"foreignKey:ShopID"` // 关联的商品
+
+	Status       ShopStatus `gorm:"size:16;index;default:approved"` // 审核状态，加入审核前创建的店铺视为已通过
+	ReviewReason string     `gorm:"size:500"`                       // 审核意见
+	ReviewedBy   uint       // 审核人
+	ReviewedAt   *time.Time // 审核时间
+
+	FollowerCount int64 `gorm:"-"` // 关注人数，查询详情时从 Redis 填充
+}
+
+// IsApproved 店铺是否对顾客可见；缓存中加入审核前的旧数据没有状态，同样视为已通过
+func (s *Shop) IsApproved() bool {
+	return s.Status == "" || s.Status == ShopStatusApproved
 }
 
 type Product struct {
@@ -22,6 +52,189 @@ type Product struct {
 	Stock       int     // 库存数量
 	ProductImg  string  `gorm:"size:500"`                         // 商品图片URL
 	Tsv         string  `gorm:"type:tsvector;index:,type:gin;->"` // 用于全文搜索, GORM不会写入，由数据库触发器填充
+
+	Status      ProductStatus `gorm:"size:16;index;default:published"` // 上架状态
+	PublishAt   *time.Time    `gorm:"index"`                           // 定时上架时间
+	UnpublishAt *time.Time    `gorm:"index"`                           // 定时下架时间
+
+	DeletedWithShop bool `gorm:"default:false"` // 是否随店铺一起被删除，恢复店铺时据此恢复商品
+
+	ReorderThreshold int `gorm:"default:0"` // 补货阈值，库存降到该值及以下时触发低库存提醒，0 表示不提醒
+
+	FavoriteCount int64 `gorm:"-"` // 收藏人数，查询详情时从 Redis 填充
+}
+
+type MovementReason string
+
+const (
+	MovementInitial      MovementReason = "initial"      // 商品创建时的初始库存
+	MovementCheckout     MovementReason = "checkout"     // 下单扣减
+	MovementCancellation MovementReason = "cancellation" // 取消订单返还
+	MovementReturn       MovementReason = "return"       // 退货入库
+	MovementAdjustment   MovementReason = "adjustment"   // 商家手工调整
+	MovementImport       MovementReason = "import"       // 批量导入
+)
+
+// InventoryMovement 库存流水，只追加不修改；products.stock 应始终等于同一商品 Delta 之和
+type InventoryMovement struct {
+	ID          uint           `gorm:"primaryKey"`
+	ProductID   uint           `gorm:"index;not null"` // 商品ID
+	ShopID      uint           `gorm:"index"`          // 所属商店ID
+	WarehouseID uint           `gorm:"index"`          // 变动的仓库，0 表示店铺未启用多仓
+	Delta       int            // 库存变化量，扣减为负
+	StockAfter  int            // 变化后的商品总库存
+	Reason      MovementReason `gorm:"size:32;index"` // 变动原因
+	Reference   string         `gorm:"size:64;index"` // 关联单据，如订单号
+	ActorID     uint           `gorm:"index"`         // 操作人，0 表示系统
+	Note        string         `gorm:"size:255"`      // 备注
+	CreatedAt   time.Time      `gorm:"index"`
+}
+
+// StockChange 描述一次库存变动的来源，随库存操作一起传入以写入流水
+type StockChange struct {
+	Reason      MovementReason
+	Reference   string
+	ActorID     uint
+	Note        string
+	WarehouseID uint      // 指定仓库；为 0 时扣减自动选仓，增加放入默认仓库
+	Near        *GeoPoint // 收货位置，自动选仓时优先选择最近的仓库
+}
+
+// GeoPoint 经纬度坐标
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Warehouse 店铺的仓库；店铺创建第一个仓库后启用多仓，products.stock 为各仓库存之和
+type Warehouse struct {
+	gorm.Model
+	ShopID    uint    `gorm:"index;not null"`    // 所属商店ID
+	Name      string  `gorm:"size:100;not null"` // 仓库名称
+	Address   string  `gorm:"size:255"`          // 仓库地址
+	Latitude  float64 // 纬度
+	Longitude float64 // 经度
+	Priority  int     // 优先级，越小越优先；无收货位置时按优先级选仓
+	IsActive  bool    `gorm:"default:true"` // 停用的仓库不参与下单选仓
+}
+
+// WarehouseStock 某仓库中某商品的库存
+type WarehouseStock struct {
+	ID          uint `gorm:"primaryKey"`
+	WarehouseID uint `gorm:"uniqueIndex:idx_warehouse_product;not null"`       // 仓库ID
+	ProductID   uint `gorm:"uniqueIndex:idx_warehouse_product;index;not null"` // 商品ID
+	Stock       int  // 库存
+	UpdatedAt   time.Time
+}
+
+func (p *Product) IsPublished() bool {
+	return p.Status == "" || p.Status == ProductStatusPublished
+}
+
+func ValidProductStatus(status ProductStatus) bool {
+	switch status {
+	case ProductStatusDraft, ProductStatusPublished, ProductStatusArchived:
+		return true
+	}
+	return false
+}
+
+// ProductPriceHistory 记录商品的每一次价格变动
+type ProductPriceHistory struct {
+	ID        uint      `gorm:"primaryKey"`
+	ProductID uint      `gorm:"index;not null"`     // 商品ID
+	OldPrice  float64   `gorm:"type:decimal(10,2)"` // 变动前价格
+	NewPrice  float64   `gorm:"type:decimal(10,2)"` // 变动后价格
+	CreatedAt time.Time `gorm:"index"`              // 变动时间
+}
+
+func (ProductPriceHistory) TableName() string {
+	return "product_price_history"
+}
+
+// PriceAlert 顾客订阅的降价提醒，价格低于 TargetPrice 时通知一次
+type PriceAlert struct {
+	ID          uint       `gorm:"primaryKey"`
+	UserID      uint       `gorm:"uniqueIndex:idx_price_alert_user_product;not null"`       // 订阅者
+	ProductID   uint       `gorm:"uniqueIndex:idx_price_alert_user_product;index;not null"` // 商品ID
+	TargetPrice float64    `gorm:"type:decimal(10,2)"`                                      // 期望价格
+	TriggeredAt *time.Time // 已触发时间，为空表示仍在等待
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// LowStockAlert 一次库存跌破阈值的记录；同一商品同时只有一条未恢复的提醒，用于去重
+type LowStockAlert struct {
+	ID          uint       `gorm:"primaryKey"`
+	ShopID      uint       `gorm:"index;not null"`                                                    // 所属商店ID
+	ProductID   uint       `gorm:"not null;uniqueIndex:idx_low_stock_open,where:resolved_at IS NULL"` // 商品ID
+	ProductName string     `gorm:"size:100"`                                                          // 商品名称
+	Threshold   int        // 触发时的阈值
+	Stock       int        // 触发时的库存
+	CreatedAt   time.Time  `gorm:"index"` // 触发时间
+	DigestedAt  *time.Time `gorm:"index"` // 已汇总通知商家的时间
+	ResolvedAt  *time.Time // 库存恢复到阈值以上的时间
+}
+
+// ProductFavorite 用户收藏的商品；写入先落 Redis 集合，由后台任务批量同步到这里
+type ProductFavorite struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"uniqueIndex:idx_favorite_user_product;not null"`       // 用户ID
+	ProductID uint `gorm:"uniqueIndex:idx_favorite_user_product;index;not null"` // 商品ID
+	CreatedAt time.Time
+}
+
+// ShopFollow 用户关注的店铺，同步方式与收藏相同
+type ShopFollow struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"uniqueIndex:idx_follow_user_shop;not null"`       // 用户ID
+	ShopID    uint `gorm:"uniqueIndex:idx_follow_user_shop;index;not null"` // 店铺ID
+	CreatedAt time.Time
+}
+
+// RestockEvent 商品从无货变为有货的记录，由后台任务通知收藏了该商品的用户
+type RestockEvent struct {
+	ID          uint   `gorm:"primaryKey"`
+	ProductID   uint   `gorm:"index;not null"` // 商品ID
+	ProductName string `gorm:"size:100"`       // 商品名称
+	Stock       int    // 补货后的库存
+	CreatedAt   time.Time
+	NotifiedAt  *time.Time `gorm:"index"` // 已通知收藏用户的时间
+}
+
+// ProductView 浏览记录归档，每个用户每个商品只保留最近一次浏览时间；最近的记录在 Redis 中
+type ProductView struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"uniqueIndex:idx_view_user_product;not null"`       // 用户ID
+	ProductID uint      `gorm:"uniqueIndex:idx_view_user_product;index;not null"` // 商品ID
+	ViewedAt  time.Time `gorm:"index"`                                            // 最近浏览时间
+}
+
+// ProductRecommendation 离线计算的“买了又买”相似商品，每个商品保留得分最高的若干个
+type ProductRecommendation struct {
+	ProductID uint    `gorm:"primaryKey;autoIncrement:false"` // 商品ID
+	RelatedID uint    `gorm:"primaryKey;autoIncrement:false"` // 相似商品ID
+	Score     float64 // 余弦相似度：共同购买订单数 / sqrt(两者各自的订单数之积)
+	Orders    int     // 共同购买的订单数
+	Rank      int     // 在该商品推荐中的名次，从 1 开始
+	UpdatedAt time.Time
+}
+
+// APIKey 店铺的 API key，供商家 ERP 等服务端集成使用。只保存 key 的 SHA-256，明文只在创建时返回一次；
+// 请求以创建者的身份执行，权限为 Scopes 与创建者当前权限的交集，并且只能操作所属店铺
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey"`
+	ShopID     uint       `gorm:"index;not null"`    // 所属店铺ID
+	UserID     uint       `gorm:"index;not null"`    // 创建者ID
+	Name       string     `gorm:"size:100;not null"` // 用途说明
+	Prefix     string     `gorm:"size:16;not null"`  // key 的开头几位，便于辨认
+	KeyHash    string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"serializer:json"` // 允许的权限码
+	RateLimit  int        `gorm:"not null"`        // 每分钟最多请求数
+	LastUsedAt *time.Time // 最近使用时间，精度约为一分钟
+	ExpiresAt  *time.Time // 为空表示不过期
+	RevokedAt  *time.Time `gorm:"index"`
+	CreatedAt  time.Time
 }
 
 type Category struct {
@@ -3,9 +3,12 @@ package shop
 import (
 	"context"
 	"errors"
+	"time"
 
+	rbac "github.com/myproject/shop/internal/Rbac"
 	"github.com/myproject/shop/pkg/database"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ShopRepository struct {
@@ -16,17 +19,47 @@ func NewRepository(db *database.Database) *ShopRepository {
 	return &ShopRepository{Database: db}
 }
 
-func (r *ShopRepository) List(limit, offset int) ([]Shop, error) {
+// approvedShopSQL 商品所属店铺未删除且已通过审核；顾客可见的商品查询和下单扣减都要带上
+const approvedShopSQL = "EXISTS (SELECT 1 FROM shops WHERE shops.id = products.shop_id AND shops.deleted_at IS NULL AND shops.status = ?)"
+
+// List 按 ListQuery 分页查询店铺，返回当前页和总数
+func (r *ShopRepository) List(q ListQuery) ([]Shop, int64, error) {
+	db := r.Database.DB
+	query := db.Model(&Shop{}).Where("shops.status = ?", ShopStatusApproved)
+	if q.Keyword != "" {
+		query = query.Where("shops.name ILIKE ?", "%"+q.Keyword+"%")
+	}
+	if q.MinPrice != nil || q.MaxPrice != nil || q.InStock {
+		matching := q.applyProductFilters(db.Model(&Product{}).Select("products.shop_id").
+			Where("products.status = ?", ProductStatusPublished), "products")
+		query = query.Where("shops.id IN (?)", matching)
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	switch q.Sort {
+	case SortName:
+		query = query.Order("shops.name, shops.id")
+	case SortSales:
+		sales := db.Table("products p").Select("p.shop_id, SUM(s.sold) AS sold").
+			Joins("JOIN (?) s ON s.product_id = p.id", productSales(db)).Group("p.shop_id")
+		query = query.Joins("LEFT JOIN (?) ss ON ss.shop_id = shops.id", sales).
+			Order("COALESCE(ss.sold, 0) DESC, shops.id DESC")
+	default:
+		query = query.Order("shops.id DESC")
+	}
 	var shops []Shop
-	if err := r.Database.DB.Preload("Products").Limit(limit).Offset(offset).Find(&shops).Error; err != nil {
-		return nil, err
+	if err := query.Select("shops.*").Preload("Products", "status = ?", ProductStatusPublished).
+		Limit(q.PageSize).Offset(q.Offset()).Find(&shops).Error; err != nil {
+		return nil, 0, err
 	}
-	return shops, nil
+	return shops, total, nil
 }
 
 func (r *ShopRepository) Get(id uint) (*Shop, error) {
 	var s Shop
-	if err := r.Database.DB.Preload("Products").First(&s, id).Error; err != nil {
+	if err := r.Database.DB.Preload("Products", "status = ?", ProductStatusPublished).First(&s, id).Error; err != nil {
 		return nil, err
 	}
 	return &s, nil
@@ -34,7 +67,7 @@ func (r *ShopRepository) Get(id uint) (*Shop, error) {
 
 func (r *ShopRepository) Create(s *Shop) error {
 	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(s).Error; err != nil {
+		if err := tx.Omit("Products").Create(s).Error; err != nil {
 			return err
 		}
 		for i := range s.Products {
@@ -45,22 +78,36 @@ func (r *ShopRepository) Create(s *Shop) error {
 				return err
 			}
 		}
-		return nil
+		return recordInitialStockTx(tx, s.Products, s.OwnerID)
 	})
 }
 
-func (r *ShopRepository) Update(s *Shop) error {
+func (r *ShopRepository) Update(s *Shop, actorID uint) error {
 
 	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		created := make([]int, 0, len(s.Products))
+		for i := range s.Products {
+			if s.Products[i].ID == 0 {
+				created = append(created, i)
+			}
+		}
 		if err := tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(s).Error; err != nil {
 			return err
 		}
-		return nil
+		products := make([]Product, len(created))
+		for i, idx := range created {
+			products[i] = s.Products[idx]
+		}
+		return recordInitialStockTx(tx, products, actorID)
 	})
 }
 
+// Delete 软删除店铺及其商品，并标记随店铺一起删除的商品，便于恢复店铺时一并恢复
 func (r *ShopRepository) Delete(id uint) error {
 	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Product{}).Where("shop_id = ?", id).Update("deleted_with_shop", true).Error; err != nil {
+			return err
+		}
 		if err := tx.Where("shop_id = ?", id).Delete(&Product{}).Error; err != nil {
 			return err
 		}
@@ -76,6 +123,9 @@ func (r *ShopRepository) BatchDelete(ids []uint) error {
 		return errors.New("empty ids")
 	}
 	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Product{}).Where("shop_id IN ?", ids).Update("deleted_with_shop", true).Error; err != nil {
+			return err
+		}
 		if err := tx.Where("shop_id IN ?", ids).Delete(&Product{}).Error; err != nil {
 			return err
 		}
@@ -83,10 +133,206 @@ func (r *ShopRepository) BatchDelete(ids []uint) error {
 	})
 }
 
+//===================Trash=====================================================
+
+// GetDeletedShop 查询已软删除的店铺
+func (r *ShopRepository) GetDeletedShop(id uint) (*Shop, error) {
+	var s Shop
+	if err := r.Database.DB.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetShopUnscoped 查询店铺，包括已软删除的
+func (r *ShopRepository) GetShopUnscoped(id uint) (*Shop, error) {
+	var s Shop
+	if err := r.Database.DB.Unscoped().First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetProductUnscoped 查询商品，包括已软删除的
+func (r *ShopRepository) GetProductUnscoped(id uint) (*Product, error) {
+	var p Product
+	if err := r.Database.DB.Unscoped().First(&p, id).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListDeletedShops ownerID 为 0 时列出全部（管理员视角）
+func (r *ShopRepository) ListDeletedShops(ownerID uint, limit, offset int) ([]Shop, error) {
+	var shops []Shop
+	query := r.Database.DB.Unscoped().Where("deleted_at IS NOT NULL")
+	if ownerID != 0 {
+		query = query.Where("owner_id = ?", ownerID)
+	}
+	if err := query.Order("deleted_at desc").Limit(limit).Offset(offset).Find(&shops).Error; err != nil {
+		return nil, err
+	}
+	return shops, nil
+}
+
+// ListDeletedProducts ownerID 为 0 时不限店主，shopID 为 0 时不限店铺
+func (r *ShopRepository) ListDeletedProducts(ownerID, shopID uint, limit, offset int) ([]Product, error) {
+	var products []Product
+	query := r.Database.DB.Unscoped().Where("deleted_at IS NOT NULL")
+	if shopID != 0 {
+		query = query.Where("shop_id = ?", shopID)
+	}
+	if ownerID != 0 {
+		query = query.Where("shop_id IN (?)", r.Database.DB.Unscoped().Model(&Shop{}).Select("id").Where("owner_id = ?", ownerID))
+	}
+	if err := query.Order("deleted_at desc").Limit(limit).Offset(offset).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// RestoreShop 恢复店铺，以及当初随店铺一起删除的商品；单独删除的商品保持删除状态
+func (r *ShopRepository) RestoreShop(id uint) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().Model(&Shop{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Unscoped().Model(&Product{}).
+			Where("shop_id = ? AND deleted_with_shop = ?", id, true).
+			Updates(map[string]interface{}{"deleted_at": nil, "deleted_with_shop": false}).Error
+	})
+}
+
+func (r *ShopRepository) RestoreProduct(id uint) error {
+	res := r.Database.DB.Unscoped().Model(&Product{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "deleted_with_shop": false})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PurgeShop 永久删除已软删除的店铺及其全部商品
+func (r *ShopRepository) PurgeShop(id uint) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var productIDs []uint
+		if err := tx.Unscoped().Model(&Product{}).Where("shop_id = ?", id).Pluck("id", &productIDs).Error; err != nil {
+			return err
+		}
+		if err := purgeProductsTx(tx, productIDs); err != nil {
+			return err
+		}
+		if err := purgeShopDataTx(tx, []uint{id}); err != nil {
+			return err
+		}
+		res := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).Delete(&Shop{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// PurgeProduct 永久删除已软删除的商品
+func (r *ShopRepository) PurgeProduct(id uint) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Unscoped().Model(&Product{}).Where("id = ? AND deleted_at IS NOT NULL", id).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return purgeProductsTx(tx, ids)
+	})
+}
+
+// PurgeDeletedBefore 永久删除在 before 之前软删除的店铺和商品，返回删除的店铺数和商品数
+func (r *ShopRepository) PurgeDeletedBefore(before time.Time) (int, int, error) {
+	var shopIDs, productIDs []uint
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&Shop{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Pluck("id", &shopIDs).Error; err != nil {
+			return err
+		}
+		query := tx.Unscoped().Model(&Product{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", before)
+		if len(shopIDs) > 0 {
+			query = query.Or("shop_id IN ?", shopIDs)
+		}
+		if err := query.Pluck("id", &productIDs).Error; err != nil {
+			return err
+		}
+		if err := purgeProductsTx(tx, productIDs); err != nil {
+			return err
+		}
+		if len(shopIDs) == 0 {
+			return nil
+		}
+		if err := purgeShopDataTx(tx, shopIDs); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&Shop{}, shopIDs).Error
+	})
+	return len(shopIDs), len(productIDs), err
+}
+
+// purgeProductsTx 硬删除商品以及依附于商品的数据
+func purgeProductsTx(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, model := range []interface{}{&ProductPriceHistory{}, &PriceAlert{}, &LowStockAlert{}, &InventoryMovement{}, &WarehouseStock{},
+		&ProductFavorite{}, &RestockEvent{}, &ProductView{}} {
+		if err := tx.Where("product_id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	// 推荐关系两端任一商品被删除都失效
+	if err := tx.Where("product_id IN ? OR related_id IN ?", ids, ids).Delete(&ProductRecommendation{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&Product{}, ids).Error
+}
+
+// purgeShopDataTx 硬删除依附于店铺本身的数据，商品相关的数据由 purgeProductsTx 处理
+func purgeShopDataTx(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	warehouses := tx.Unscoped().Model(&Warehouse{}).Select("id").Where("shop_id IN ?", ids)
+	if err := tx.Where("warehouse_id IN (?)", warehouses).Delete(&WarehouseStock{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("shop_id IN ?", ids).Delete(&Warehouse{}).Error; err != nil {
+		return err
+	}
+	for _, model := range []interface{}{&ShopFollow{}, &rbac.ShopStaff{}, &APIKey{}} {
+		if err := tx.Where("shop_id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Product-related methods
-func (r *ShopRepository) CreateProduct(shopID uint, p *Product) error {
+func (r *ShopRepository) CreateProduct(shopID uint, p *Product, actorID uint) error {
 	p.ShopID = shopID
-	return r.Database.DB.Create(p).Error
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(p).Error; err != nil {
+			return err
+		}
+		return recordInitialStockTx(tx, []Product{*p}, actorID)
+	})
 }
 
 func (r *ShopRepository) GetProductByCode(code uint) (*Product, error) {
@@ -105,19 +351,168 @@ func (r *ShopRepository) GetProductByName(shopID uint, name string) (*Product, e
 	return &p, nil
 }
 
-func (r *ShopRepository) ListProductsByShop(shopID uint, limit, offset int) ([]Product, error) {
+// ListProductsByShop 按 ListQuery 分页列出店铺商品，返回当前页和总数；publishedOnly 为 false 时包含草稿和已下架商品（商家视角）
+func (r *ShopRepository) ListProductsByShop(shopID uint, q ListQuery, publishedOnly bool) ([]Product, int64, error) {
+	query := r.Database.DB.Model(&Product{}).Where("products.shop_id = ?", shopID)
+	if publishedOnly {
+		query = query.Where("products.status = ?", ProductStatusPublished)
+	}
+	if q.Keyword != "" {
+		query = query.Where("products.name ILIKE ?", "%"+q.Keyword+"%")
+	}
+	query = q.applyProductFilters(query, "products")
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	switch q.Sort {
+	case SortPriceAsc:
+		query = query.Order("products.price, products.id")
+	case SortPriceDesc:
+		query = query.Order("products.price DESC, products.id DESC")
+	case SortSales:
+		query = query.Joins("LEFT JOIN (?) s ON s.product_id = products.id", productSales(r.Database.DB)).
+			Order("COALESCE(s.sold, 0) DESC, products.id DESC")
+	default:
+		query = query.Order("products.id DESC")
+	}
 	var products []Product
-	if err := r.Database.DB.Where("shop_id = ?", shopID).Limit(limit).Offset(offset).Find(&products).Error; err != nil {
+	if err := query.Select("products.*").Limit(q.PageSize).Offset(q.Offset()).Find(&products).Error; err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+func (r *ShopRepository) UpdateProductStatus(id uint, status ProductStatus, publishAt, unpublishAt *time.Time) error {
+	return r.Database.DB.Model(&Product{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       status,
+		"publish_at":   publishAt,
+		"unpublish_at": unpublishAt,
+	}).Error
+}
+
+// PublishDue 将到达定时上架时间的草稿/下架商品改为上架，返回受影响的商品
+func (r *ShopRepository) PublishDue(now time.Time) ([]Product, error) {
+	var products []Product
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("status <> ? AND publish_at IS NOT NULL AND publish_at <= ?", ProductStatusPublished, now).
+			Find(&products).Error; err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(products))
+		for i := range products {
+			ids[i] = products[i].ID
+		}
+		return tx.Model(&Product{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":     ProductStatusPublished,
+			"publish_at": nil,
+		}).Error
+	})
+	return products, err
+}
+
+// ArchiveDue 将到达定时下架时间的已上架商品改为下架，返回受影响的商品
+func (r *ShopRepository) ArchiveDue(now time.Time) ([]Product, error) {
+	var products []Product
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("status = ? AND unpublish_at IS NOT NULL AND unpublish_at <= ?", ProductStatusPublished, now).
+			Find(&products).Error; err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(products))
+		for i := range products {
+			ids[i] = products[i].ID
+		}
+		return tx.Model(&Product{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":       ProductStatusArchived,
+			"unpublish_at": nil,
+		}).Error
+	})
+	return products, err
+}
+
+// UpdateProduct 更新商品，价格发生变化时在同一事务内写入价格历史，库存变化记为手工调整流水，返回变动前的价格
+func (r *ShopRepository) UpdateProduct(p *Product, actorID uint) (float64, error) {
+	if p == nil || p.ShopID == 0 {
+		return 0, errors.New("invalid product")
+	}
+	var oldPrice float64
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var old Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "price", "stock").First(&old, p.ID).Error; err != nil {
+			return err
+		}
+		oldPrice = old.Price
+		if err := tx.Model(p).Select("name", "description", "price", "product_img").Updates(p).Error; err != nil {
+			return err
+		}
+		if delta := p.Stock - old.Stock; delta != 0 {
+			change := StockChange{Reason: MovementAdjustment, ActorID: actorID, Note: "product update"}
+			if _, err := applyStockDeltaTx(tx, p.ID, delta, change); err != nil {
+				return err
+			}
+		}
+		if old.Price == p.Price {
+			return nil
+		}
+		return tx.Create(&ProductPriceHistory{
+			ProductID: p.ID,
+			OldPrice:  old.Price,
+			NewPrice:  p.Price,
+		}).Error
+	})
+	return oldPrice, err
+}
+
+func (r *ShopRepository) ListPriceHistory(productID uint, limit int) ([]ProductPriceHistory, error) {
+	var history []ProductPriceHistory
+	if err := r.Database.DB.Where("product_id = ?", productID).Order("created_at desc").Limit(limit).Find(&history).Error; err != nil {
 		return nil, err
 	}
-	return products, nil
+	return history, nil
 }
 
-func (r *ShopRepository) UpdateProduct(p *Product) error {
-	if p.ShopID == 0 || p == nil {
-		return errors.New("invalid product")
+// UpsertPriceAlert 同一用户对同一商品只保留一条提醒，重复订阅会覆盖目标价并重新激活
+func (r *ShopRepository) UpsertPriceAlert(a *PriceAlert) error {
+	return r.Database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "product_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"target_price": a.TargetPrice, "triggered_at": nil, "updated_at": time.Now()}),
+	}).Create(a).Error
+}
+
+func (r *ShopRepository) DeletePriceAlert(userID, productID uint) error {
+	return r.Database.DB.Where("user_id = ? AND product_id = ?", userID, productID).Delete(&PriceAlert{}).Error
+}
+
+func (r *ShopRepository) ListPriceAlertsByUser(userID uint) ([]PriceAlert, error) {
+	var alerts []PriceAlert
+	if err := r.Database.DB.Where("user_id = ?", userID).Order("id desc").Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// ListDuePriceAlerts 找出尚未触发且当前价格已低于目标价的提醒
+func (r *ShopRepository) ListDuePriceAlerts(productID uint, price float64) ([]PriceAlert, error) {
+	var alerts []PriceAlert
+	if err := r.Database.DB.Where("product_id = ? AND triggered_at IS NULL AND target_price > ?", productID, price).
+		Find(&alerts).Error; err != nil {
+		return nil, err
 	}
-	return r.Database.DB.Model(p).Select("name", "description", "price", "stock", "product_img").Save(p).Error
+	return alerts, nil
+}
+
+func (r *ShopRepository) MarkPriceAlertsTriggered(ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.Database.DB.Model(&PriceAlert{}).Where("id IN ?", ids).Update("triggered_at", at).Error
 }
 
 func (r *ShopRepository) DeleteProduct(id uint) error {
@@ -131,29 +526,81 @@ func (r *ShopRepository) BatchDeleteProducts(ids []uint) error {
 	return r.Database.DB.Delete(&Product{}, ids).Error
 }
 
-// 数据库层面的乐观锁扣减
-func (r *ShopRepository) DecreaseStockWithTx(ctx context.Context, tx *gorm.DB, id uint, quannity int) error {
+// 数据库层面的乐观锁扣减，返回实际扣减的仓库；本次扣减使库存跌破补货阈值时，在同一事务内记录低库存提醒并返回
+func (r *ShopRepository) DecreaseStockWithTx(ctx context.Context, tx *gorm.DB, id uint, quannity int, change StockChange) (uint, *LowStockAlert, error) {
 	if quannity <= 0 {
-		return errors.New("quantity must be greater than 0")
+		return 0, nil, errors.New("quantity must be greater than 0")
 	}
 	db := r.Database.DB
 	if tx != nil {
 		db = tx
 	}
-	result := db.Model(&Product{}).
-		Where("id = ? AND stock >= ?", id, quannity).
-		Update("stock", gorm.Expr("stock - ?", quannity))
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("insufficient stock")
+	res, err := applyStockDeltaTx(db, id, -quannity, change)
+	if err != nil {
+		return 0, nil, err
 	}
-	return nil
+	return res.warehouseID, res.alert, nil
 }
 
 // 回滚库存
-func (r *ShopRepository) AddStock(id uint, quannity int) error {
-	return r.Database.DB.Model(&Product{}).Where("id = ?", id).Update("stock", gorm.Expr("stock + ?", quannity)).Error
+func (r *ShopRepository) AddStock(id uint, quannity int, change StockChange) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := r.IncreaseStockWithTx(context.Background(), tx, id, quannity, change)
+		return err
+	})
+}
+
+// resolveLowStockTx 库存回到阈值以上时关闭未恢复的低库存提醒，下一次跌破会重新提醒
+func resolveLowStockTx(tx *gorm.DB, productID uint) error {
+	return tx.Model(&LowStockAlert{}).
+		Where("product_id = ? AND resolved_at IS NULL", productID).
+		Where("EXISTS (SELECT 1 FROM products WHERE products.id = ? AND products.stock > products.reorder_threshold)", productID).
+		Update("resolved_at", time.Now()).Error
+}
+
+func (r *ShopRepository) UpdateReorderThreshold(id uint, threshold int) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Product{}).Where("id = ?", id).Update("reorder_threshold", threshold)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return resolveLowStockTx(tx, id)
+	})
+}
 
+// ListLowStockAlerts openOnly 为 true 时只返回尚未恢复的提醒
+func (r *ShopRepository) ListLowStockAlerts(shopID uint, openOnly bool, limit, offset int) ([]LowStockAlert, error) {
+	var alerts []LowStockAlert
+	query := r.Database.DB.Where("shop_id = ?", shopID)
+	if openOnly {
+		query = query.Where("resolved_at IS NULL")
+	}
+	if err := query.Order("created_at desc").Limit(limit).Offset(offset).Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// ClaimUndigestedLowStockAlerts 把尚未汇总通知且仍未恢复的提醒标记为在 at 汇总并返回；
+// 标记和读取是同一条语句，多个实例同时执行时每条提醒只会被其中一个取到
+func (r *ShopRepository) ClaimUndigestedLowStockAlerts(at time.Time) ([]LowStockAlert, error) {
+	var alerts []LowStockAlert
+	if err := r.Database.DB.Model(&alerts).
+		Clauses(clause.Returning{}).
+		Where("digested_at IS NULL AND resolved_at IS NULL").
+		Update("digested_at", at).Error; err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// ReleaseLowStockAlerts 通知失败时撤销 ClaimUndigestedLowStockAlerts 的标记，下次任务重新汇总
+func (r *ShopRepository) ReleaseLowStockAlerts(ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.Database.DB.Model(&LowStockAlert{}).Where("id IN ? AND digested_at = ?", ids, at).Update("digested_at", nil).Error
 }
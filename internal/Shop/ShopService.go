@@ -4,11 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/sync/singleflight"
 
+	audit "github.com/myproject/shop/internal/Audit"
+	notification "github.com/myproject/shop/internal/Notification"
+	"github.com/myproject/shop/pkg/logger"
 	"github.com/myproject/shop/pkg/middleware"
 	"gorm.io/gorm"
 )
@@ -38,33 +43,73 @@ return redis.call("decrby",KEYS[1],qty)
 `
 
 type ShopService struct {
-	rep   *ShopRepository
-	cache *middleware.RedisStore
-	sf    singleflight.Group
+	rep      *ShopRepository
+	cache    *middleware.RedisStore
+	notifier *notification.NotificationService
+	audit    *audit.AuditService
+	sf       singleflight.Group
 }
 
-func NewShopService(rep *ShopRepository, cache *middleware.RedisStore) *ShopService {
-	return &ShopService{rep: rep, cache: cache}
+func NewShopService(rep *ShopRepository, cache *middleware.RedisStore, notifier *notification.NotificationService, auditor *audit.AuditService) *ShopService {
+	s := &ShopService{rep: rep, cache: cache, notifier: notifier, audit: auditor}
+	middleware.InitAPIKeys(s)
+	return s
 }
 
-func (s *ShopService) List(limit, offset int) ([]Shop, error) {
-	if limit <= 0 {
-		limit = 20
+// List 分页查询店铺列表，结果按列表版本号缓存
+func (s *ShopService) List(q ListQuery) (*ListPage[Shop], error) {
+	if err := q.normalize(SortNewest, SortName, SortSales); err != nil {
+		return nil, err
 	}
-	cacheKey := fmt.Sprintf("shops:list:%d:%d", limit, offset)
+	var cacheKey string
 	if s.cache != nil {
-		var cached []Shop
+		cacheKey = fmt.Sprintf("shops:list:v%d:%s", s.listVersion(shopListVersionKey), q.cacheKey())
+		var cached ListPage[Shop]
 		if ok, err := s.cache.GetObject(context.Background(), cacheKey, &cached); err == nil && ok {
-			return cached, nil
+			return &cached, nil
 		}
 	}
 
-	shops, err := s.rep.List(limit, offset)
-	if err != nil || s.cache == nil {
-		return shops, err
+	shops, total, err := s.rep.List(q)
+	if err != nil {
+		return nil, err
+	}
+	page := newListPage(shops, q, total)
+	if s.cache != nil {
+		_ = s.cache.SetObjectWithTTL(context.Background(), cacheKey, page, shopTTL)
 	}
-	_ = s.cache.SetObjectWithTTL(context.Background(), cacheKey, shops, shopTTL)
-	return shops, err
+	return page, nil
+}
+
+// 列表缓存 key 带版本号，数据变化时递增版本号，所有分页和过滤组合的旧缓存一起失效，随 TTL 过期
+const shopListVersionKey = "shops:list:version"
+
+func productListVersionKey(shopID uint) string {
+	return fmt.Sprintf("shop_products:%d:version", shopID)
+}
+
+func (s *ShopService) listVersion(key string) int64 {
+	v, err := s.cache.Client.Get(context.Background(), key).Int64()
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func (s *ShopService) invalidateShopList() {
+	if s.cache == nil {
+		return
+	}
+	s.cache.Client.Incr(context.Background(), shopListVersionKey)
+}
+
+// invalidateProductList 店铺列表中带有商品，商品列表变化时一并失效
+func (s *ShopService) invalidateProductList(shopID uint) {
+	if s.cache == nil {
+		return
+	}
+	s.cache.Client.Incr(context.Background(), productListVersionKey(shopID))
+	s.cache.Client.Incr(context.Background(), shopListVersionKey)
 }
 
 func (s *ShopService) GetShopByID(id uint) (*Shop, error) {
@@ -84,51 +129,72 @@ func (s *ShopService) GetShopByID(id uint) (*Shop, error) {
 	return res, nil
 }
 
-func (s *ShopService) CreateShop(sh *Shop) error {
+func (s *ShopService) CreateShop(ctx context.Context, sh *Shop) error {
 	if sh == nil {
 		return errors.New("shop is nil")
 	}
 	if sh.Name == "" {
 		return errors.New("shop name is required")
 	}
+	if sh.Status == "" {
+		sh.Status = ShopStatusPending
+	}
 	if err := s.rep.Create(sh); err != nil {
 		return err
 	}
 	if s.cache != nil {
 		_ = s.cache.SetObjectWithTTL(context.Background(), "shop_"+strconv.FormatUint(uint64(sh.ID), 10), sh, shopTTL)
-		_ = s.cache.DelteKey(context.Background(), "shops:list:20:0")
+		s.invalidateShopList()
 	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionCreate, ResourceType: audit.ResourceShop, ResourceID: audit.ID(sh.ID), After: shopAuditView(sh)})
 	return nil
 }
 
-func (s *ShopService) UpdateShop(sh *Shop) error {
+func (s *ShopService) UpdateShop(ctx context.Context, sh *Shop, actorID uint) error {
 	if sh == nil || sh.ID == 0 {
 		return errors.New("invalid shop")
 	}
-	if err := s.rep.Update(sh); err != nil {
+	existing, err := s.rep.Get(sh.ID)
+	if err != nil {
+		return err
+	}
+	// 整行保存，请求中没有的店主、创建时间和审核状态沿用原值，避免待审核店铺借修改绕过审核
+	sh.OwnerID = existing.OwnerID
+	sh.CreatedAt = existing.CreatedAt
+	sh.Status = existing.Status
+	sh.ReviewReason = existing.ReviewReason
+	sh.ReviewedBy = existing.ReviewedBy
+	sh.ReviewedAt = existing.ReviewedAt
+	if err := s.rep.Update(sh, actorID); err != nil {
 		return err
 	}
 	if s.cache != nil {
 		key := "shop_" + strconv.FormatUint(uint64(sh.ID), 10)
 		_ = s.cache.SetObjectWithTTL(context.Background(), key, sh, shopTTL)
-		_ = s.cache.DelteKey(context.Background(), "shops:list:20:0")
+		s.invalidateShopList()
 	}
+	s.audit.Record(ctx, audit.Entry{
+		ActorID: actorID, Action: audit.ActionUpdate, ResourceType: audit.ResourceShop, ResourceID: audit.ID(sh.ID),
+		Before: shopAuditView(existing), After: shopAuditView(sh),
+		Detail: map[string]interface{}{"products": len(sh.Products)},
+	})
 	return nil
 }
 
-func (s *ShopService) Delete(id uint) error {
+func (s *ShopService) Delete(ctx context.Context, id uint) error {
+	before, _ := s.rep.Get(id)
 	if err := s.rep.Delete(id); err != nil {
 		return err
 	}
 	if s.cache != nil {
 		_ = s.cache.DelteKey(context.Background(), "shop_"+strconv.FormatUint(uint64(id), 10))
-		_ = s.cache.DelteKey(context.Background(), "shops:list:20:0")
-		_ = s.cache.DelteKey(context.Background(), fmt.Sprintf("shop_products:%d:20:0", id))
+		s.invalidateProductList(id)
 	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionDelete, ResourceType: audit.ResourceShop, ResourceID: audit.ID(id), Before: shopAuditView(before)})
 	return nil
 }
 
-func (s *ShopService) BatchDelete(ids []uint) error {
+func (s *ShopService) BatchDelete(ctx context.Context, ids []uint) error {
 	if err := s.rep.BatchDelete(ids); err != nil {
 		return err
 	}
@@ -136,15 +202,147 @@ func (s *ShopService) BatchDelete(ids []uint) error {
 		for _, id := range ids {
 			_ = s.cache.DelteKey(context.Background(), "shop_"+strconv.FormatUint(uint64(id), 10))
 		}
-		_ = s.cache.DelteKey(context.Background(), "shops:list:20:0")
+		s.invalidateShopList()
+	}
+	for _, id := range ids {
+		s.audit.Record(ctx, audit.Entry{Action: audit.ActionDelete, ResourceType: audit.ResourceShop, ResourceID: audit.ID(id), Detail: map[string]interface{}{"batch": len(ids)}})
+	}
+	return nil
+}
+
+// shopAuditView 审计日志中记录的店铺字段
+func shopAuditView(sh *Shop) map[string]interface{} {
+	if sh == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"name":        sh.Name,
+		"description": sh.Description,
+		"owner_id":    sh.OwnerID,
+		"status":      sh.Status,
+	}
+}
+
+//===================Trash=====================================================
+
+// ListDeletedShops ownerID 为 0 表示管理员视角，列出全部
+func (s *ShopService) ListDeletedShops(ownerID uint, limit, offset int) ([]Shop, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	return s.rep.ListDeletedShops(ownerID, limit, offset)
+}
+
+func (s *ShopService) ListDeletedProducts(ownerID, shopID uint, limit, offset int) ([]Product, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	return s.rep.ListDeletedProducts(ownerID, shopID, limit, offset)
+}
+
+// DeletedShopOwner 返回已删除店铺的店主，用于回收站的权限校验
+func (s *ShopService) DeletedShopOwner(id uint) (uint, error) {
+	sh, err := s.rep.GetDeletedShop(id)
+	if err != nil {
+		return 0, err
+	}
+	return sh.OwnerID, nil
+}
+
+// ProductOwner 返回商品（包括已删除商品）所属店铺的店主
+func (s *ShopService) ProductOwner(id uint) (uint, error) {
+	p, err := s.rep.GetProductUnscoped(id)
+	if err != nil {
+		return 0, err
+	}
+	sh, err := s.rep.GetShopUnscoped(p.ShopID)
+	if err != nil {
+		return 0, err
+	}
+	return sh.OwnerID, nil
+}
+
+func (s *ShopService) RestoreShop(ctx context.Context, id uint) error {
+	if err := s.rep.RestoreShop(id); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		_ = s.cache.DelteKey(context.Background(), "shop_"+strconv.FormatUint(uint64(id), 10))
+		s.invalidateProductList(id)
+	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionRestore, ResourceType: audit.ResourceShop, ResourceID: audit.ID(id)})
+	return nil
+}
+
+// RestoreProduct 恢复单个商品，所属店铺仍在回收站时不允许恢复
+func (s *ShopService) RestoreProduct(ctx context.Context, id uint) error {
+	p, err := s.rep.GetProductUnscoped(id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.rep.GetDeletedShop(p.ShopID); err == nil {
+		return errors.New("shop is deleted, restore the shop first")
+	}
+	if err := s.rep.RestoreProduct(id); err != nil {
+		return err
+	}
+	s.invalidateProduct(p)
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionRestore, ResourceType: audit.ResourceProduct, ResourceID: audit.ID(id)})
+	return nil
+}
+
+func (s *ShopService) PurgeShop(ctx context.Context, id uint) error {
+	before, _ := s.rep.GetShopUnscoped(id)
+	if err := s.rep.PurgeShop(id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionPurge, ResourceType: audit.ResourceShop, ResourceID: audit.ID(id), Before: shopAuditView(before)})
+	return nil
+}
+
+func (s *ShopService) PurgeProduct(ctx context.Context, id uint) error {
+	before, _ := s.rep.GetProductUnscoped(id)
+	if err := s.rep.PurgeProduct(id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionPurge, ResourceType: audit.ResourceProduct, ResourceID: audit.ID(id), Before: productAuditView(before)})
+	return nil
+}
+
+// PurgeTrash 由后台任务调用，永久删除超过保留期的店铺和商品
+func (s *ShopService) PurgeTrash(ctx context.Context, retention time.Duration) error {
+	shops, products, err := s.rep.PurgeDeletedBefore(time.Now().Add(-retention))
+	if err != nil {
+		return fmt.Errorf("purge trash: %w", err)
+	}
+	if shops > 0 || products > 0 {
+		logger.Info("trash_purged", map[string]interface{}{
+			"shops":    shops,
+			"products": products,
+		})
 	}
 	return nil
 }
 
 //===================Product===================================================
 
+// productAuditView 审计日志中记录的商品字段
+func productAuditView(p *Product) map[string]interface{} {
+	if p == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"shop_id":     p.ShopID,
+		"name":        p.Name,
+		"description": p.Description,
+		"price":       p.Price,
+		"stock":       p.Stock,
+		"product_img": p.ProductImg,
+	}
+}
+
 // Product-related methods
-func (s *ShopService) CreateProduct(shopID uint, p *Product) error {
+func (s *ShopService) CreateProduct(shopID uint, p *Product, actorID uint) error {
 	if shopID == 0 {
 		return errors.New("shop id is required")
 	}
@@ -157,13 +355,13 @@ func (s *ShopService) CreateProduct(shopID uint, p *Product) error {
 	if p.Price <= 0 {
 		return errors.New("product price must be greater than 0")
 	}
-	if err := s.rep.CreateProduct(shopID, p); err != nil {
+	if err := s.rep.CreateProduct(shopID, p, actorID); err != nil {
 		return err
 	}
 	if s.cache != nil {
 		stockKey := fmt.Sprintf("product:stock:%d", p.ID)
 		s.cache.SetObjectWithTTL(context.Background(), stockKey, p.Stock, 0) // 0 表示永不过期
-		_ = s.cache.DelteKey(context.Background(), fmt.Sprintf("shop_products:%d:20:0", shopID))
+		s.invalidateProductList(shopID)
 	}
 	return nil
 }
@@ -206,27 +404,101 @@ func (s *ShopService) GetProductByName(shopID uint, name string) (*Product, erro
 	return s.rep.GetProductByName(shopID, name)
 }
 
-func (s *ShopService) ListProductsByShop(shopID uint, limit, offset int) ([]Product, error) {
-	if limit <= 0 {
-		limit = 20
+// ListProductsByShop 顾客视角，只含已上架商品，结果按该店铺的列表版本号缓存
+func (s *ShopService) ListProductsByShop(shopID uint, q ListQuery) (*ListPage[Product], error) {
+	if err := q.normalize(SortNewest, SortPriceAsc, SortPriceDesc, SortSales); err != nil {
+		return nil, err
 	}
-	cacheKey := fmt.Sprintf("shop_products:%d:%d:%d", shopID, limit, offset)
+	var cacheKey string
 	if s.cache != nil {
-		var cached []Product
+		cacheKey = fmt.Sprintf("shop_products:%d:v%d:%s", shopID, s.listVersion(productListVersionKey(shopID)), q.cacheKey())
+		var cached ListPage[Product]
 		if ok, err := s.cache.GetObject(context.Background(), cacheKey, &cached); err == nil && ok {
-			return cached, nil
+			return &cached, nil
 		}
 	}
 
-	products, err := s.rep.ListProductsByShop(shopID, limit, offset)
-	if err != nil || s.cache == nil {
-		return products, err
+	products, total, err := s.rep.ListProductsByShop(shopID, q, true)
+	if err != nil {
+		return nil, err
+	}
+	page := newListPage(products, q, total)
+	if s.cache != nil {
+		_ = s.cache.SetObjectWithTTL(context.Background(), cacheKey, page, productListTTL)
 	}
-	_ = s.cache.SetObjectWithTTL(context.Background(), cacheKey, products, productListTTL)
-	return products, err
+	return page, nil
 }
 
-func (s *ShopService) UpdateProduct(p *Product) error {
+// ListAllProductsByShop 商家视角，包含草稿和已下架商品，不走缓存
+func (s *ShopService) ListAllProductsByShop(shopID uint, q ListQuery) (*ListPage[Product], error) {
+	if err := q.normalize(SortNewest, SortPriceAsc, SortPriceDesc, SortSales); err != nil {
+		return nil, err
+	}
+	products, total, err := s.rep.ListProductsByShop(shopID, q, false)
+	if err != nil {
+		return nil, err
+	}
+	return newListPage(products, q, total), nil
+}
+
+// SetProductStatus 修改商品上架状态，可同时设置定时上/下架时间
+func (s *ShopService) SetProductStatus(id uint, status ProductStatus, publishAt, unpublishAt *time.Time) (*Product, error) {
+	if id == 0 {
+		return nil, errors.New("invalid product")
+	}
+	if !ValidProductStatus(status) {
+		return nil, errors.New("invalid product status")
+	}
+	if publishAt != nil && unpublishAt != nil && !unpublishAt.After(*publishAt) {
+		return nil, errors.New("unpublish_at must be after publish_at")
+	}
+	p, err := s.rep.GetProductByCode(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rep.UpdateProductStatus(id, status, publishAt, unpublishAt); err != nil {
+		return nil, err
+	}
+	p.Status = status
+	p.PublishAt = publishAt
+	p.UnpublishAt = unpublishAt
+	s.invalidateProduct(p)
+	return p, nil
+}
+
+// ApplyProductSchedules 由后台任务周期调用，处理到期的定时上架/下架
+func (s *ShopService) ApplyProductSchedules(ctx context.Context) error {
+	now := time.Now()
+	published, err := s.rep.PublishDue(now)
+	if err != nil {
+		return fmt.Errorf("publish due products: %w", err)
+	}
+	archived, err := s.rep.ArchiveDue(now)
+	if err != nil {
+		return fmt.Errorf("archive due products: %w", err)
+	}
+	for i := range published {
+		s.invalidateProduct(&published[i])
+	}
+	for i := range archived {
+		s.invalidateProduct(&archived[i])
+	}
+	return nil
+}
+
+// invalidateProduct 清理商品详情、店铺商品列表和店铺详情缓存
+func (s *ShopService) invalidateProduct(p *Product) {
+	if s.cache == nil || p == nil {
+		return
+	}
+	_ = s.cache.DelteKey(context.Background(), fmt.Sprintf("product:%d", p.ID))
+	if p.ShopID != 0 {
+		s.invalidateProductList(p.ShopID)
+		_ = s.cache.DelteKey(context.Background(), "shop_"+strconv.FormatUint(uint64(p.ShopID), 10))
+	}
+}
+
+func (s *ShopService) UpdateProduct(ctx context.Context, p *Product, actorID uint) error {
 	if p == nil || p.ID == 0 {
 		return errors.New("invalid product")
 	}
@@ -236,14 +508,31 @@ func (s *ShopService) UpdateProduct(p *Product) error {
 	if p.Price <= 0 {
 		return errors.New("product price must be greater than 0")
 	}
-	if err := s.rep.UpdateProduct(p); err != nil {
+	existing, err := s.rep.GetProductByCode(p.ID)
+	if err != nil {
 		return err
 	}
+	if p.ShopID == 0 {
+		p.ShopID = existing.ShopID
+	}
+	oldPrice, err := s.rep.UpdateProduct(p, actorID)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Entry{
+		ActorID: actorID, Action: audit.ActionUpdate, ResourceType: audit.ResourceProduct, ResourceID: audit.ID(p.ID),
+		Before: productAuditView(existing), After: productAuditView(p),
+	})
+	if p.Price < oldPrice {
+		notified := s.firePriceAlerts(context.Background(), p)
+		s.notifyFavoritesOnSale(context.Background(), p, oldPrice, notified)
+	}
 	if s.cache != nil {
-		_ = s.cache.SetObjectWithTTL(context.Background(), fmt.Sprintf("product:%d", p.ID), p, productSingleTTL)
+		// 请求体不含上架状态，直接删除详情缓存，避免把草稿商品以空状态写进缓存
+		_ = s.cache.DelteKey(context.Background(), fmt.Sprintf("product:%d", p.ID))
 		//清除失效缓存
 		if p.ShopID != 0 {
-			_ = s.cache.DelteKey(context.Background(), fmt.Sprintf("shop_products:%d:20:0", p.ShopID))
+			s.invalidateProductList(p.ShopID)
 		}
 
 		stockKey := fmt.Sprintf("product:stock:%d", p.ID)
@@ -252,7 +541,74 @@ func (s *ShopService) UpdateProduct(p *Product) error {
 	return nil
 }
 
-func (s *ShopService) DeleteProduct(id uint) error {
+func (s *ShopService) ListPriceHistory(productID uint, limit int) ([]ProductPriceHistory, error) {
+	if productID == 0 {
+		return nil, errors.New("invalid product")
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return s.rep.ListPriceHistory(productID, limit)
+}
+
+// SubscribePriceAlert 订阅降价提醒，目标价必须低于当前价格
+func (s *ShopService) SubscribePriceAlert(userID, productID uint, targetPrice float64) (*PriceAlert, error) {
+	if userID == 0 || productID == 0 {
+		return nil, errors.New("user id and product id are required")
+	}
+	if targetPrice <= 0 {
+		return nil, errors.New("target price must be greater than 0")
+	}
+	p, err := s.rep.GetProductByCode(productID)
+	if err != nil {
+		return nil, err
+	}
+	if targetPrice >= p.Price {
+		return nil, errors.New("target price must be lower than current price")
+	}
+	a := &PriceAlert{UserID: userID, ProductID: productID, TargetPrice: targetPrice}
+	if err := s.rep.UpsertPriceAlert(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *ShopService) UnsubscribePriceAlert(userID, productID uint) error {
+	return s.rep.DeletePriceAlert(userID, productID)
+}
+
+func (s *ShopService) ListPriceAlerts(userID uint) ([]PriceAlert, error) {
+	return s.rep.ListPriceAlertsByUser(userID)
+}
+
+// firePriceAlerts 价格下降后通知所有达到目标价的订阅者，返回已通知的用户；失败只记录日志，不影响商品更新
+func (s *ShopService) firePriceAlerts(ctx context.Context, p *Product) map[uint]bool {
+	notified := make(map[uint]bool)
+	if s.notifier == nil {
+		return notified
+	}
+	alerts, err := s.rep.ListDuePriceAlerts(p.ID, p.Price)
+	if err != nil {
+		logger.Error("price_alert_query_failed", map[string]interface{}{"product_id": p.ID, "error": err.Error()})
+		return notified
+	}
+	fired := make([]uint, 0, len(alerts))
+	for _, a := range alerts {
+		title := fmt.Sprintf("%s 降价了", p.Name)
+		content := fmt.Sprintf("您关注的商品 %s 当前价格 %.2f，已低于您设置的目标价 %.2f", p.Name, p.Price, a.TargetPrice)
+		if err := s.notifier.Notify(ctx, a.UserID, notification.TypePriceDrop, title, content); err != nil {
+			continue
+		}
+		fired = append(fired, a.ID)
+		notified[a.UserID] = true
+	}
+	if err := s.rep.MarkPriceAlertsTriggered(fired, time.Now()); err != nil {
+		logger.Error("price_alert_mark_failed", map[string]interface{}{"product_id": p.ID, "error": err.Error()})
+	}
+	return notified
+}
+
+func (s *ShopService) DeleteProduct(ctx context.Context, id uint) error {
 	var p *Product
 	if s.cache != nil || id > 0 {
 		// best-effort fetch to know ShopID for invalidation; ignore error
@@ -264,13 +620,22 @@ func (s *ShopService) DeleteProduct(id uint) error {
 	if s.cache != nil {
 		_ = s.cache.DelteKey(context.Background(), fmt.Sprintf("product:%d", id))
 		if p != nil && p.ShopID != 0 {
-			_ = s.cache.DelteKey(context.Background(), fmt.Sprintf("shop_products:%d:20:0", p.ShopID))
+			s.invalidateProductList(p.ShopID)
 		}
 	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionDelete, ResourceType: audit.ResourceProduct, ResourceID: audit.ID(id), Before: productAuditView(p)})
 	return nil
 }
 
-func (s *ShopService) BatchDeleteProducts(ids []uint) error {
+func (s *ShopService) BatchDeleteProducts(ctx context.Context, ids []uint) error {
+	shopIDs := make(map[uint]bool)
+	if s.cache != nil {
+		for _, id := range ids {
+			if p, err := s.rep.GetProductByCode(id); err == nil {
+				shopIDs[p.ShopID] = true
+			}
+		}
+	}
 	if err := s.rep.BatchDeleteProducts(ids); err != nil {
 		return err
 	}
@@ -278,11 +643,18 @@ func (s *ShopService) BatchDeleteProducts(ids []uint) error {
 		for _, id := range ids {
 			_ = s.cache.DelteKey(context.Background(), fmt.Sprintf("product:%d", id))
 		}
+		for shopID := range shopIDs {
+			s.invalidateProductList(shopID)
+		}
+	}
+	for _, id := range ids {
+		s.audit.Record(ctx, audit.Entry{Action: audit.ActionDelete, ResourceType: audit.ResourceProduct, ResourceID: audit.ID(id), Detail: map[string]interface{}{"batch": len(ids)}})
 	}
 	return nil
 }
 
-func (s *ShopService) DecreaseStockWithTx(ctx context.Context, tx *gorm.DB, productid uint, quantity int) error {
+// DecreaseStockWithTx 先在 Redis 预扣总库存，再在调用方事务内扣减数据库库存，返回实际发货的仓库
+func (s *ShopService) DecreaseStockWithTx(ctx context.Context, tx *gorm.DB, productid uint, quantity int, change StockChange) (uint, error) {
 	//构架cache key
 	cachekey := fmt.Sprintf("product:stock:%d", productid)
 	if s.cache != nil {
@@ -297,7 +669,7 @@ func (s *ShopService) DecreaseStockWithTx(ctx context.Context, tx *gorm.DB, prod
 			case -1:
 				//Key 不存在：说明缓存过期或者没有进行数据预热
 			case -2:
-				return errors.New("insufficient stock (redis)")
+				return 0, errors.New("insufficient stock (redis)")
 			default:
 				//获取扣除数据库的资格
 			}
@@ -305,17 +677,272 @@ func (s *ShopService) DecreaseStockWithTx(ctx context.Context, tx *gorm.DB, prod
 	}
 
 	//数据库阶段
-	err := s.rep.DecreaseStockWithTx(ctx, tx, productid, quantity)
+	warehouseID, alert, err := s.rep.DecreaseStockWithTx(ctx, tx, productid, quantity, change)
 	if err != nil {
 		//4.数据库扣除失败必须将缓存中扣除的库存返还回去
 		if s.cache != nil {
 			s.cache.Client.IncrBy(context.Background(), cachekey, int64(quantity))
 		}
-		return fmt.Errorf("decrease stock failed: %w", err)
+		return 0, fmt.Errorf("decrease stock failed: %w", err)
 	}
 	// 扣减成功，可以清理商品详情缓存，保证数据新鲜度
 	if s.cache != nil {
 		_ = s.cache.DelteKey(context.Background(), fmt.Sprintf("product:%d", productid))
 	}
+	s.emitLowStock(alert)
+	return warehouseID, nil
+}
+
+// IncreaseStockWithTx 在调用方事务内返还库存；事务提交后需调用 RefreshStockCache 同步 Redis 计数
+func (s *ShopService) IncreaseStockWithTx(ctx context.Context, tx *gorm.DB, productID uint, quantity int, change StockChange) error {
+	if _, err := s.rep.IncreaseStockWithTx(ctx, tx, productID, quantity, change); err != nil {
+		return fmt.Errorf("increase stock failed: %w", err)
+	}
+	return nil
+}
+
+// OutstandingCheckoutWithTx 订单下单扣减后尚未返还的库存，取消和退货只返还这部分
+func (s *ShopService) OutstandingCheckoutWithTx(ctx context.Context, tx *gorm.DB, orderID string) ([]StockHold, error) {
+	return s.rep.OutstandingCheckoutWithTx(ctx, tx, orderID)
+}
+
+// RefreshStockCache 用数据库中的库存覆盖 Redis 库存计数，并清理商品详情缓存
+func (s *ShopService) RefreshStockCache(productIDs ...uint) {
+	if s.cache == nil {
+		return
+	}
+	for _, id := range productIDs {
+		p, err := s.rep.GetProductByCode(id)
+		if err != nil {
+			continue
+		}
+		s.cache.Client.Set(context.Background(), fmt.Sprintf("product:stock:%d", id), p.Stock, 0)
+		s.invalidateProduct(p)
+	}
+}
+
+// emitLowStock 低库存事件；商家通知由每日汇总任务发送
+func (s *ShopService) emitLowStock(alert *LowStockAlert) {
+	if alert == nil {
+		return
+	}
+	logger.Warn("low_stock", map[string]interface{}{
+		"shop_id":    alert.ShopID,
+		"product_id": alert.ProductID,
+		"stock":      alert.Stock,
+		"threshold":  alert.Threshold,
+	})
+}
+
+//===================Inventory ledger==========================================
+
+// StockImportItem 批量导入中的一行，Stock 为导入后的绝对库存
+type StockImportItem struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	Stock     int  `json:"stock" binding:"min=0"`
+}
+
+// StockImportResult 单行导入结果
+type StockImportResult struct {
+	ProductID uint   `json:"product_id"`
+	Stock     int    `json:"stock"`
+	Changed   bool   `json:"changed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AdjustStock 商家手工增减库存
+func (s *ShopService) AdjustStock(productID uint, delta int, change StockChange) (*Product, error) {
+	if productID == 0 {
+		return nil, errors.New("invalid product")
+	}
+	change.Reason = MovementAdjustment
+	p, alert, err := s.rep.AdjustStock(productID, delta, change)
+	if err != nil {
+		return nil, err
+	}
+	s.emitLowStock(alert)
+	s.RefreshStockCache(productID)
+	return p, nil
+}
+
+// ImportStock 批量设置店铺内商品的库存，逐行处理，单行失败不影响其他行
+func (s *ShopService) ImportStock(shopID uint, items []StockImportItem, change StockChange) ([]StockImportResult, error) {
+	if shopID == 0 {
+		return nil, errors.New("shop id is required")
+	}
+	if len(items) == 0 {
+		return nil, errors.New("empty items")
+	}
+	change.Reason = MovementImport
+	results := make([]StockImportResult, len(items))
+	for i, item := range items {
+		results[i] = StockImportResult{ProductID: item.ProductID, Stock: item.Stock}
+		p, err := s.rep.GetProductByCode(item.ProductID)
+		if err == nil && p.ShopID != shopID {
+			err = errors.New("product does not belong to this shop")
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		updated, alert, err := s.rep.SetStock(item.ProductID, item.Stock, change)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if updated != nil {
+			results[i].Changed = true
+			s.emitLowStock(alert)
+			s.RefreshStockCache(item.ProductID)
+		}
+	}
+	return results, nil
+}
+
+func (s *ShopService) ListMovements(f MovementFilter) ([]InventoryMovement, error) {
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	return s.rep.ListMovements(f)
+}
+
+func (s *ShopService) CheckStockConsistency(shopID uint) ([]StockMismatch, error) {
+	return s.rep.CheckStockConsistency(shopID)
+}
+
+// RunStockConsistencyCheck 由后台任务调用：先为历史商品补期初流水，再检查全部商品并记录差异
+func (s *ShopService) RunStockConsistencyCheck(ctx context.Context) error {
+	if n, err := s.rep.BackfillOpeningBalances(); err != nil {
+		return fmt.Errorf("backfill opening balances: %w", err)
+	} else if n > 0 {
+		logger.Info("inventory_opening_balances", map[string]interface{}{"products": n})
+	}
+	mismatches, err := s.rep.CheckStockConsistency(0)
+	if err != nil {
+		return fmt.Errorf("check stock consistency: %w", err)
+	}
+	for _, m := range mismatches {
+		logger.Error("inventory_mismatch", map[string]interface{}{
+			"shop_id":      m.ShopID,
+			"product_id":   m.ProductID,
+			"stock":        m.Stock,
+			"ledger_stock": m.LedgerStock,
+		})
+	}
 	return nil
 }
+
+//===================Inventory alerts==========================================
+
+func (s *ShopService) SetReorderThreshold(productID uint, threshold int) error {
+	if productID == 0 {
+		return errors.New("invalid product")
+	}
+	if threshold < 0 {
+		return errors.New("threshold must not be negative")
+	}
+	return s.rep.UpdateReorderThreshold(productID, threshold)
+}
+
+func (s *ShopService) ListLowStockAlerts(shopID uint, openOnly bool, limit, offset int) ([]LowStockAlert, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.rep.ListLowStockAlerts(shopID, openOnly, limit, offset)
+}
+
+// SendLowStockDigest 由每日任务调用，把每个店铺新增的低库存提醒汇总成一条通知发给店主
+func (s *ShopService) SendLowStockDigest(ctx context.Context) error {
+	if s.notifier == nil {
+		return nil
+	}
+	// 截断到微秒与数据库精度一致，撤销标记时按这个时间匹配
+	now := time.Now().Truncate(time.Microsecond)
+	alerts, err := s.rep.ClaimUndigestedLowStockAlerts(now)
+	if err != nil {
+		return fmt.Errorf("claim low stock alerts: %w", err)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].CreatedAt.Before(alerts[j].CreatedAt) })
+	byShop := make(map[uint][]LowStockAlert)
+	for _, a := range alerts {
+		byShop[a.ShopID] = append(byShop[a.ShopID], a)
+	}
+	for shopID, items := range byShop {
+		ids := make([]uint, len(items))
+		var b strings.Builder
+		for i, a := range items {
+			ids[i] = a.ID
+			fmt.Fprintf(&b, "%s（ID %d）库存 %d，阈值 %d\n", a.ProductName, a.ProductID, a.Stock, a.Threshold)
+		}
+		sh, err := s.rep.GetShopUnscoped(shopID)
+		if err == nil {
+			title := fmt.Sprintf("店铺 %s 有 %d 个商品库存不足", sh.Name, len(items))
+			err = s.notifier.Notify(ctx, sh.OwnerID, notification.TypeLowStockDigest, title, b.String())
+		}
+		if err != nil {
+			logger.Error("low_stock_digest_failed", map[string]interface{}{"shop_id": shopID, "error": err.Error()})
+			if err := s.rep.ReleaseLowStockAlerts(ids, now); err != nil {
+				logger.Error("low_stock_digest_release_failed", map[string]interface{}{"shop_id": shopID, "error": err.Error()})
+			}
+		}
+	}
+	return nil
+}
+
+//===================Warehouses==========================================
+
+func (s *ShopService) CreateWarehouse(w *Warehouse) error {
+	if w == nil || w.ShopID == 0 {
+		return errors.New("shop id is required")
+	}
+	if strings.TrimSpace(w.Name) == "" {
+		return errors.New("warehouse name is required")
+	}
+	return s.rep.CreateWarehouse(w)
+}
+
+func (s *ShopService) GetWarehouse(id uint) (*Warehouse, error) {
+	return s.rep.GetWarehouse(id)
+}
+
+func (s *ShopService) ListWarehouses(shopID uint) ([]Warehouse, error) {
+	return s.rep.ListWarehouses(shopID)
+}
+
+func (s *ShopService) UpdateWarehouse(w *Warehouse) error {
+	if strings.TrimSpace(w.Name) == "" {
+		return errors.New("warehouse name is required")
+	}
+	return s.rep.UpdateWarehouse(w)
+}
+
+func (s *ShopService) DeleteWarehouse(id uint) error {
+	return s.rep.DeleteWarehouse(id)
+}
+
+func (s *ShopService) ListWarehouseStock(warehouseID uint) ([]WarehouseStock, error) {
+	return s.rep.ListWarehouseStock(warehouseID)
+}
+
+// SetWarehouseStock 设置某仓库中某商品的库存，差额同步到商品总库存和 Redis 计数
+func (s *ShopService) SetWarehouseStock(w *Warehouse, productID uint, stock int, change StockChange) (*Product, error) {
+	p, err := s.rep.GetProductByCode(productID)
+	if err != nil {
+		return nil, err
+	}
+	if p.ShopID != w.ShopID {
+		return nil, errors.New("product does not belong to this shop")
+	}
+	change.Reason = MovementAdjustment
+	change.WarehouseID = w.ID
+	updated, alert, err := s.rep.SetStock(productID, stock, change)
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		return p, nil
+	}
+	s.emitLowStock(alert)
+	s.RefreshStockCache(productID)
+	return updated, nil
+}
@@ -0,0 +1,78 @@
+package shop
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	rbac "github.com/myproject/shop/internal/Rbac"
+)
+
+type shopStaffReq struct {
+	RoleID uint `json:"role_id" binding:"required"`
+}
+
+func writeStaffError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, rbac.ErrRoleNotFound), errors.Is(err, rbac.ErrStaffNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, rbac.ErrNotShopRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListShopStaff GET /shops/:id/staff
+func (h *ShopHandler) ListShopStaff(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	if !h.authorizeShops(c, rbac.PermStaffManage, uint(shopID)) {
+		return
+	}
+	staff, err := h.rbac.ListShopStaff(uint(shopID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, staff)
+}
+
+// SetShopStaff PUT /shops/:id/staff/:user_id，添加员工或修改员工角色
+func (h *ShopHandler) SetShopStaff(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	staffID, _ := strconv.Atoi(c.Param("user_id"))
+	if !h.authorizeShops(c, rbac.PermStaffManage, uint(shopID)) {
+		return
+	}
+	var req shopStaffReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actorID, _ := getUserID(c)
+	if uint(staffID) == actorID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot change your own staff role"})
+		return
+	}
+	st, err := h.rbac.SetShopStaff(c.Request.Context(), uint(shopID), uint(staffID), req.RoleID, actorID)
+	if err != nil {
+		writeStaffError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+// RemoveShopStaff DELETE /shops/:id/staff/:user_id
+func (h *ShopHandler) RemoveShopStaff(c *gin.Context) {
+	shopID, _ := strconv.Atoi(c.Param("id"))
+	staffID, _ := strconv.Atoi(c.Param("user_id"))
+	if !h.authorizeShops(c, rbac.PermStaffManage, uint(shopID)) {
+		return
+	}
+	if err := h.rbac.RemoveShopStaff(c.Request.Context(), uint(shopID), uint(staffID)); err != nil {
+		writeStaffError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "staff removed"})
+}
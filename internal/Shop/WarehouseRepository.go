@@ -0,0 +1,179 @@
+package shop
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrWarehouseNotFound = errors.New("warehouse not found")
+	ErrWarehouseNotEmpty = errors.New("warehouse still has stock")
+)
+
+// applyWarehouseDeltaTx 把库存变动落到具体仓库，返回仓库ID；店铺没有仓库时不做任何事并返回 0。
+// 扣减未指定仓库时，优先选择离收货位置最近、否则优先级最高的、库存足够的启用仓库，不拆单
+func applyWarehouseDeltaTx(tx *gorm.DB, shopID, productID uint, delta int, change StockChange) (uint, error) {
+	if change.WarehouseID != 0 {
+		var w Warehouse
+		err := tx.Select("id").Where("id = ? AND shop_id = ?", change.WarehouseID, shopID).First(&w).Error
+		switch {
+		case err == nil:
+			if delta > 0 {
+				return w.ID, addWarehouseStockTx(tx, w.ID, productID, delta)
+			}
+			return w.ID, takeWarehouseStockTx(tx, w.ID, productID, -delta)
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return 0, err
+		case delta < 0 || (change.Reason != MovementCancellation && change.Reason != MovementReturn):
+			return 0, ErrWarehouseNotFound
+		}
+		// 发货仓库已被删除时，取消和退货的库存放回默认仓库
+	}
+	if delta > 0 {
+		w, err := defaultWarehouseTx(tx, shopID)
+		if err != nil || w == nil {
+			return 0, err
+		}
+		return w.ID, addWarehouseStockTx(tx, w.ID, productID, delta)
+	}
+	var count int64
+	if err := tx.Model(&Warehouse{}).Where("shop_id = ?", shopID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	query := tx.Table("warehouse_stocks AS ws").
+		Select("ws.warehouse_id").
+		Joins("JOIN warehouses AS w ON w.id = ws.warehouse_id AND w.deleted_at IS NULL").
+		Where("w.shop_id = ? AND w.is_active AND ws.product_id = ? AND ws.stock >= ?", shopID, productID, -delta)
+	if change.Near != nil {
+		// 按经纬度近似平面距离排序，经度按纬度余弦缩放
+		query = query.Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "power(w.latitude - ?, 2) + power((w.longitude - ?) * cos(radians(?)), 2)",
+			Vars:               []interface{}{change.Near.Latitude, change.Near.Longitude, change.Near.Latitude},
+			WithoutParentheses: true,
+		}})
+	}
+	var candidates []uint
+	if err := query.Order("w.priority, w.id").Pluck("ws.warehouse_id", &candidates).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range candidates {
+		err := takeWarehouseStockTx(tx, id, productID, -delta)
+		if errors.Is(err, ErrInsufficientStock) {
+			// 并发下单时该仓库已被扣空，尝试下一个
+			continue
+		}
+		return id, err
+	}
+	return 0, ErrInsufficientStock
+}
+
+func addWarehouseStockTx(tx *gorm.DB, warehouseID, productID uint, quantity int) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "warehouse_id"}, {Name: "product_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"stock": gorm.Expr("warehouse_stocks.stock + ?", quantity), "updated_at": time.Now()}),
+	}).Create(&WarehouseStock{WarehouseID: warehouseID, ProductID: productID, Stock: quantity}).Error
+}
+
+func takeWarehouseStockTx(tx *gorm.DB, warehouseID, productID uint, quantity int) error {
+	result := tx.Model(&WarehouseStock{}).
+		Where("warehouse_id = ? AND product_id = ? AND stock >= ?", warehouseID, productID, quantity).
+		Updates(map[string]interface{}{"stock": gorm.Expr("stock - ?", quantity), "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// defaultWarehouseTx 返回店铺的默认仓库（优先级最高的启用仓库），店铺没有仓库时返回 nil
+func defaultWarehouseTx(tx *gorm.DB, shopID uint) (*Warehouse, error) {
+	var w Warehouse
+	err := tx.Where("shop_id = ?", shopID).Order("is_active desc, priority, id").First(&w).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// CreateWarehouse 创建仓库；店铺的第一个仓库会接管所有商品的现有库存
+func (r *ShopRepository) CreateWarehouse(w *Warehouse) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Warehouse{}).Where("shop_id = ?", w.ShopID).Count(&count).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(w).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		// 包括回收站中的商品，恢复后库存仍然对得上
+		return tx.Exec(`
+INSERT INTO warehouse_stocks (warehouse_id, product_id, stock, updated_at)
+SELECT ?, p.id, p.stock, ?
+FROM products p
+WHERE p.shop_id = ? AND p.stock <> 0
+ON CONFLICT (warehouse_id, product_id) DO NOTHING`, w.ID, time.Now(), w.ShopID).Error
+	})
+}
+
+func (r *ShopRepository) GetWarehouse(id uint) (*Warehouse, error) {
+	var w Warehouse
+	if err := r.Database.DB.First(&w, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWarehouseNotFound
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *ShopRepository) ListWarehouses(shopID uint) ([]Warehouse, error) {
+	var warehouses []Warehouse
+	if err := r.Database.DB.Where("shop_id = ?", shopID).Order("priority, id").Find(&warehouses).Error; err != nil {
+		return nil, err
+	}
+	return warehouses, nil
+}
+
+func (r *ShopRepository) UpdateWarehouse(w *Warehouse) error {
+	return r.Database.DB.Model(w).Select("name", "address", "latitude", "longitude", "priority", "is_active").Updates(w).Error
+}
+
+// DeleteWarehouse 只允许删除已经没有库存的仓库
+func (r *ShopRepository) DeleteWarehouse(id uint) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var total int64
+		if err := tx.Model(&WarehouseStock{}).Where("warehouse_id = ?", id).
+			Select("COALESCE(SUM(stock), 0)").Scan(&total).Error; err != nil {
+			return err
+		}
+		if total != 0 {
+			return ErrWarehouseNotEmpty
+		}
+		if err := tx.Where("warehouse_id = ?", id).Delete(&WarehouseStock{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Warehouse{}, id).Error
+	})
+}
+
+func (r *ShopRepository) ListWarehouseStock(warehouseID uint) ([]WarehouseStock, error) {
+	var stocks []WarehouseStock
+	if err := r.Database.DB.Where("warehouse_id = ? AND stock <> 0", warehouseID).Order("product_id").Find(&stocks).Error; err != nil {
+		return nil, err
+	}
+	return stocks, nil
+}
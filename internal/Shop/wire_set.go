@@ -5,5 +5,6 @@ import "github.com/google/wire"
 var ProviderSet = wire.NewSet(
 	NewRepository,
 	NewShopService,
+	NewShopAuthorizer,
 	NewShopHandler,
 )
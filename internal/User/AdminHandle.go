@@ -0,0 +1,223 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	audit "github.com/myproject/shop/internal/Audit"
+)
+
+// AdminUserResponse 管理后台看到的用户信息，比 UserResponse 多出账号状态
+type AdminUserResponse struct {
+	UserResponse
+	Status                string     `json:"status"`
+	StatusReason          string     `json:"status_reason,omitempty"`
+	StatusUntil           *time.Time `json:"status_until,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+}
+
+func newAdminUserResponse(u *User, now time.Time) AdminUserResponse {
+	res := AdminUserResponse{
+		UserResponse:          NewUserResponse(u),
+		Status:                u.EffectiveStatus(now),
+		PasswordResetRequired: u.PasswordResetRequired,
+	}
+	if res.Status != StatusActive {
+		res.StatusReason = u.StatusReason
+		res.StatusUntil = u.StatusUntil
+	}
+	return res
+}
+
+type blockUserReq struct {
+	Reason    string     `json:"reason" binding:"required,max=500"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type adminActionReq struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type changeRoleReq struct {
+	Role   uint   `json:"role" binding:"required"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+func writeAdminUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrCannotModifySelf):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidUserQuery), errors.Is(err, ErrInvalidExpiry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		writeUserError(c, err)
+	}
+}
+
+func targetUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// bindAdminAction 请求体可以为空
+func bindAdminAction(c *gin.Context) (adminActionReq, bool) {
+	var req adminActionReq
+	if c.Request.ContentLength == 0 {
+		return req, true
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, false
+	}
+	return req, true
+}
+
+// AdminListUsers GET /api/admin/users?q=&role=&status=&created_from=&created_to=&page=&page_size=
+func (h *UserHandle) AdminListUsers(c *gin.Context) {
+	var q UserQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	users, total, q, err := h.servive.SearchUsers(q)
+	if err != nil {
+		writeAdminUserError(c, err)
+		return
+	}
+	now := time.Now()
+	items := make([]AdminUserResponse, 0, len(users))
+	for i := range users {
+		items = append(items, newAdminUserResponse(&users[i], now))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":     items,
+		"page":      q.Page,
+		"page_size": q.PageSize,
+		"total":     total,
+		"has_more":  int64(q.Offset()+len(items)) < total,
+	})
+}
+
+// AdminGetUser GET /api/admin/users/:id
+func (h *UserHandle) AdminGetUser(c *gin.Context) {
+	id, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+	u, err := h.servive.Repo.GetUserByID(id)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": newAdminUserResponse(u, time.Now())})
+}
+
+// SuspendUser POST /api/admin/users/:id/suspend，必须提供 expires_at
+func (h *UserHandle) SuspendUser(c *gin.Context) {
+	h.blockUser(c, StatusSuspended)
+}
+
+// BanUser POST /api/admin/users/:id/ban，不提供 expires_at 为永久封禁
+func (h *UserHandle) BanUser(c *gin.Context) {
+	h.blockUser(c, StatusBanned)
+}
+
+func (h *UserHandle) blockUser(c *gin.Context, status string) {
+	id, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+	var req blockUserReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	operatorID, _ := getUserID(c)
+	if err := h.servive.BlockUser(c.Request.Context(), operatorID, id, status, req.Reason, req.ExpiresAt); err != nil {
+		writeAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ReinstateUser POST /api/admin/users/:id/reinstate，提前解除停用或封禁
+func (h *UserHandle) ReinstateUser(c *gin.Context) {
+	id, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+	operatorID, _ := getUserID(c)
+	if err := h.servive.ReinstateUser(c.Request.Context(), operatorID, id, req.Reason); err != nil {
+		writeAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ChangeUserRole PUT /api/admin/users/:id/role
+func (h *UserHandle) ChangeUserRole(c *gin.Context) {
+	id, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+	var req changeRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	operatorID, _ := getUserID(c)
+	u, err := h.servive.ChangeRole(c.Request.Context(), operatorID, id, req.Role, req.Reason)
+	if err != nil {
+		writeAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": newAdminUserResponse(u, time.Now())})
+}
+
+// ForceLogout POST /api/admin/users/:id/logout，吊销用户的全部会话
+func (h *UserHandle) ForceLogout(c *gin.Context) {
+	id, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+	operatorID, _ := getUserID(c)
+	if err := h.servive.ForceLogout(c.Request.Context(), operatorID, id, req.Reason); err != nil {
+		writeAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ListUserAuditLogs GET /api/admin/users/:id/audit?page=&page_size=
+func (h *UserHandle) ListUserAuditLogs(c *gin.Context) {
+	id, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	logs, total, err := h.servive.ListAuditLogs(id, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if logs == nil {
+		logs = []audit.Log{}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": logs, "total": total})
+}
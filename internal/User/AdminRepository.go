@@ -0,0 +1,53 @@
+package user
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchUsers 管理后台的用户列表，返回当前页和总数
+func (r *UserRepository) SearchUsers(q UserQuery, now time.Time) ([]User, int64, error) {
+	db := r.Database.DB.Model(&User{})
+	if q.Keyword != "" {
+		like := "%" + strings.ToLower(q.Keyword) + "%"
+		if id, err := strconv.ParseUint(q.Keyword, 10, 64); err == nil {
+			db = db.Where("id = ? OR LOWER(username) LIKE ? OR LOWER(email) LIKE ? OR phone LIKE ?", id, like, like, like)
+		} else {
+			db = db.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ? OR phone LIKE ?", like, like, like)
+		}
+	}
+	if q.Role != 0 {
+		db = db.Where("role = ?", q.Role)
+	}
+	switch q.Status {
+	case StatusActive:
+		db = db.Where("status = ? OR status_until <= ?", StatusActive, now)
+	case StatusSuspended, StatusBanned:
+		db = db.Where("status = ? AND (status_until IS NULL OR status_until > ?)", q.Status, now)
+	}
+	if q.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", *q.CreatedFrom)
+	}
+	if q.CreatedTo != nil {
+		db = db.Where("created_at < ?", *q.CreatedTo)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []User
+	if err := db.Order("id DESC").Limit(q.PageSize).Offset(q.Offset()).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *UserRepository) SetStatus(id uint, status, reason string, until *time.Time) error {
+	return r.Database.DB.Model(&User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": status, "status_reason": reason, "status_until": until}).Error
+}
+
+func (r *UserRepository) SetRole(id, role uint) error {
+	return r.Database.DB.Model(&User{}).Where("id = ?", id).Update("role", role).Error
+}
@@ -0,0 +1,214 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	audit "github.com/myproject/shop/internal/Audit"
+	"github.com/myproject/shop/pkg/logger"
+	"github.com/myproject/shop/pkg/middleware"
+)
+
+var (
+	ErrCannotModifySelf = errors.New("administrators cannot change their own role or status")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrInvalidUserQuery = errors.New("invalid user query")
+	ErrInvalidExpiry    = errors.New("expires_at must be in the future")
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// UserQuery 管理后台用户列表的搜索、过滤和分页参数，从 query string 绑定。
+// q 匹配用户名、邮箱、电话，或者是用户ID；created_from / created_to 为 RFC3339 时间
+type UserQuery struct {
+	Page        int        `form:"page"`
+	PageSize    int        `form:"page_size"`
+	Keyword     string     `form:"q"`
+	Role        uint       `form:"role"`
+	Status      string     `form:"status"`
+	CreatedFrom *time.Time `form:"created_from"`
+	CreatedTo   *time.Time `form:"created_to"`
+}
+
+func (q *UserQuery) normalize() error {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = defaultUserPageSize
+	}
+	if q.PageSize > maxUserPageSize {
+		q.PageSize = maxUserPageSize
+	}
+	q.Keyword = strings.TrimSpace(q.Keyword)
+	switch q.Status {
+	case "", StatusActive, StatusSuspended, StatusBanned:
+	default:
+		return fmt.Errorf("%w: unsupported status %q", ErrInvalidUserQuery, q.Status)
+	}
+	if q.CreatedFrom != nil && q.CreatedTo != nil && q.CreatedFrom.After(*q.CreatedTo) {
+		return fmt.Errorf("%w: created_from must not be after created_to", ErrInvalidUserQuery)
+	}
+	return nil
+}
+
+func (q UserQuery) Offset() int {
+	return (q.Page - 1) * q.PageSize
+}
+
+// SetRoleValidator 注册判断角色能否分配给用户的方法，由 RBAC 模块提供；未注册时只接受内置角色
+func (s *UserService) SetRoleValidator(fn func(role uint) (bool, error)) {
+	s.validateRole = fn
+}
+
+func (s *UserService) validRole(role uint) (bool, error) {
+	if s.validateRole == nil {
+		return role == RoleCustomer || role == RoleMerchant || role == RoleAdmin, nil
+	}
+	return s.validateRole(role)
+}
+
+// SetSessionRevoker 注册吊销用户全部会话的方法，由认证模块提供；强制下线、封禁和修改角色时调用
+func (s *UserService) SetSessionRevoker(fn func(ctx context.Context, userID uint) error) {
+	s.revokeSessions = fn
+}
+
+func (s *UserService) SearchUsers(q UserQuery) ([]User, int64, UserQuery, error) {
+	if err := q.normalize(); err != nil {
+		return nil, 0, q, err
+	}
+	if q.Role != 0 {
+		ok, err := s.validRole(q.Role)
+		if err != nil {
+			return nil, 0, q, err
+		}
+		if !ok {
+			return nil, 0, q, fmt.Errorf("%w: unsupported role %d", ErrInvalidUserQuery, q.Role)
+		}
+	}
+	users, total, err := s.Repo.SearchUsers(q, time.Now())
+	return users, total, q, err
+}
+
+// BlockUser 停用或封禁账号：已登录的会话全部失效，到期前无法登录或访问接口。
+// 停用必须提供到期时间，封禁的 until 为空表示永久
+func (s *UserService) BlockUser(ctx context.Context, operatorID, id uint, status, reason string, until *time.Time) error {
+	if operatorID == id {
+		return ErrCannotModifySelf
+	}
+	if until != nil && !until.After(time.Now()) {
+		return ErrInvalidExpiry
+	}
+	if status == StatusSuspended && until == nil {
+		return fmt.Errorf("%w: suspension requires an expiry", ErrInvalidExpiry)
+	}
+	if _, err := s.Repo.GetUserByID(id); err != nil {
+		return err
+	}
+	if err := s.Repo.SetStatus(id, status, reason, until); err != nil {
+		return err
+	}
+	if err := middleware.BlockAccount(ctx, id, middleware.AccountBlock{Status: status, Reason: reason, Until: until}); err != nil {
+		logger.Error("account_block_marker_failed", map[string]interface{}{"user_id": id, "error": err.Error()})
+	}
+	s.revokeAllSessions(ctx, id)
+	action := AuditSuspend
+	if status == StatusBanned {
+		action = AuditBan
+	}
+	s.RecordAudit(ctx, id, operatorID, action, reason, map[string]interface{}{"until": until})
+	return nil
+}
+
+// ReinstateUser 提前解除停用或封禁
+func (s *UserService) ReinstateUser(ctx context.Context, operatorID, id uint, reason string) error {
+	u, err := s.Repo.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.SetStatus(id, StatusActive, "", nil); err != nil {
+		return err
+	}
+	if err := middleware.UnblockAccount(ctx, id); err != nil {
+		logger.Error("account_unblock_marker_failed", map[string]interface{}{"user_id": id, "error": err.Error()})
+	}
+	s.RecordAudit(ctx, id, operatorID, AuditReinstate, reason, map[string]interface{}{"previous_status": u.EffectiveStatus(time.Now())})
+	return nil
+}
+
+// ChangeRole 修改角色。token 中带有角色，修改后吊销全部会话，用户重新登录后按新角色授权
+func (s *UserService) ChangeRole(ctx context.Context, operatorID, id, role uint, reason string) (*User, error) {
+	if operatorID == id {
+		return nil, ErrCannotModifySelf
+	}
+	ok, err := s.validRole(role)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidRole
+	}
+	u, err := s.Repo.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Role == role {
+		return u, nil
+	}
+	previous := u.Role
+	if err := s.Repo.SetRole(id, role); err != nil {
+		return nil, err
+	}
+	u.Role = role
+	s.revokeAllSessions(ctx, id)
+	s.RecordAudit(ctx, id, operatorID, AuditRoleChange, reason, map[string]interface{}{"from": previous, "to": role})
+	return u, nil
+}
+
+// ForceLogout 吊销用户在所有设备上的会话
+func (s *UserService) ForceLogout(ctx context.Context, operatorID, id uint, reason string) error {
+	if _, err := s.Repo.GetUserByID(id); err != nil {
+		return err
+	}
+	if s.revokeSessions == nil {
+		return errors.New("session revocation is not configured")
+	}
+	if err := s.revokeSessions(ctx, id); err != nil {
+		return err
+	}
+	s.RecordAudit(ctx, id, operatorID, AuditForceLogout, reason, nil)
+	return nil
+}
+
+func (s *UserService) revokeAllSessions(ctx context.Context, id uint) {
+	if s.revokeSessions == nil {
+		return
+	}
+	if err := s.revokeSessions(ctx, id); err != nil {
+		logger.Error("revoke_sessions_failed", map[string]interface{}{"user_id": id, "error": err.Error()})
+	}
+}
+
+// RecordAudit 把管理员对账号的操作写入全局审计日志；写入失败只记日志，不影响操作本身
+func (s *UserService) RecordAudit(ctx context.Context, userID, operatorID uint, action, reason string, detail map[string]interface{}) {
+	global := map[string]interface{}{"reason": reason}
+	for k, v := range detail {
+		global[k] = v
+	}
+	s.audit.Record(ctx, audit.Entry{ActorID: operatorID, Action: action, ResourceType: audit.ResourceUser, ResourceID: audit.ID(userID), Detail: global})
+}
+
+// ListAuditLogs 从全局审计日志中查询该账号的操作记录
+func (s *UserService) ListAuditLogs(userID uint, page, pageSize int) ([]audit.Log, int64, error) {
+	if s.audit == nil {
+		return nil, 0, nil
+	}
+	logs, total, _, err := s.audit.List(audit.Query{Page: page, PageSize: pageSize, ResourceType: audit.ResourceUser, ResourceID: audit.ID(userID)})
+	return logs, total, err
+}
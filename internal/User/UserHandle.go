@@ -1,11 +1,14 @@
 package user
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/myproject/shop/pkg/utils"
+	"github.com/myproject/shop/pkg/middleware"
+	"gorm.io/gorm"
 )
 
 type UserHandle struct {
@@ -16,7 +19,8 @@ type RegisterUserRequest struct {
 	Username string `json:"username" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=6"`
-	Role     uint   `json:"role" binding:"required,oneof=1 5 10"`
+	// 注册只能成为顾客；商家通过入驻申请审核后升级，管理员由管理员在后台设置
+	Role uint `json:"role" binding:"omitempty,oneof=1"`
 }
 
 type UpdateUserRequest struct {
@@ -25,30 +29,123 @@ type UpdateUserRequest struct {
 	Password string `json:"password" binding:"omitempty,min=6"`
 	UserImg  string `json:"user_img" binding:"omitempty,url"`
 	Phone    string `json:"phonenums" binding:"omitempty,phone"`
+	// 修改自己的邮箱或密码时必须提供
+	CurrentPassword string `json:"current_password"`
+}
+
+func (r UpdateUserRequest) profileUpdate() ProfileUpdate {
+	return ProfileUpdate{Username: r.Username, Email: r.Email, Password: r.Password, UserImg: r.UserImg, Phone: r.Phone}
+}
+
+// UserResponse 返回给客户端的用户信息，不包含密码哈希等内部字段
+type UserResponse struct {
+	ID            uint       `json:"id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	Role          uint       `json:"role"`
+	UserImg       string     `json:"user_img"`
+	Phone         string     `json:"phone"`
+	LastLoginAt   *time.Time `json:"last_login_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func NewUserResponse(u *User) UserResponse {
+	return UserResponse{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		Role:          u.Role,
+		UserImg:       u.UserImg,
+		Phone:         u.Phone,
+		LastLoginAt:   u.LastLoginAt,
+		CreatedAt:     u.CreatedAt,
+	}
 }
 
 func NewUserHandle(service *UserService) *UserHandle {
 	return &UserHandle{servive: service}
 }
 
+func getUserID(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(middleware.CtxUserIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(uint)
+	return id, ok
+}
+
+func writeUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, ErrUsernameTaken), errors.Is(err, ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrWrongPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNoFieldsToUpdate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// GetMe GET /api/v1/me
+func (h *UserHandle) GetMe(c *gin.Context) {
+	id, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	user, err := h.servive.Repo.GetUserByID(id)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": NewUserResponse(user)})
+}
+
+// UpdateMe PATCH /api/v1/me，修改邮箱或密码需要 current_password
+func (h *UserHandle) UpdateMe(c *gin.Context) {
+	id, ok := getUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := h.servive.UpdateProfile(c.Request.Context(), id, req.profileUpdate(), &req.CurrentPassword)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": NewUserResponse(user)})
+}
+
+// GetUserByID GET /users/:id，仅管理员
 func (h *UserHandle) GetUserByID(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	user, err := h.servive.Repo.GetUserByID(uint(id))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeUserError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{"user": NewUserResponse(user)})
 }
 
 func (h *UserHandle) GetUserByName(c *gin.Context) {
 	username := c.Query("username")
 	user, err := h.servive.Repo.GetUserByName(username)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeUserError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{"user": NewUserResponse(user)})
 }
 
 func (h *UserHandle) RegisterUser(c *gin.Context) {
@@ -57,57 +154,36 @@ func (h *UserHandle) RegisterUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	user, err := h.servive.RegisterUser(req.Username, req.Email, req.Password, req.Role)
+	user, err := h.servive.RegisterUser(req.Username, req.Email, req.Password, RoleCustomer)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeUserError(c, err)
 		return
 	}
-	//等待规范返回的数据
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{"user": NewUserResponse(user)})
 }
 
+// DeleteUser DELETE /users/:id，仅管理员
 func (h *UserHandle) DeleteUser(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := h.servive.DeleteUser(uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.servive.DeleteUser(c.Request.Context(), uint(id)); err != nil {
+		writeUserError(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
+// UpdateUser PATCH /users/:id，仅管理员，不需要当前密码
 func (h *UserHandle) UpdateUser(c *gin.Context) {
 	var req UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if req.Username == "" && req.Email == "" && req.Password == "" && req.UserImg == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
-		return
-	}
 	id, _ := strconv.Atoi(c.Param("id"))
-	user, err := h.servive.Repo.GetUserByID(uint(id))
+	user, err := h.servive.UpdateProfile(c.Request.Context(), uint(id), req.profileUpdate(), nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	if req.Username != "" {
-		user.Username = req.Username
-	}
-	if req.Email != "" {
-		user.Email = req.Email
-	}
-	if req.Password != "" {
-		user.Password = utils.HashPassword(req.Password)
-	}
-	if req.UserImg != "" {
-		user.UserImg = req.UserImg
-	}
-	if req.Phone != "" {
-		user.Phone = req.Phone
-	}
-	if err := h.servive.Repo.UpdateUser(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeUserError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{"user": NewUserResponse(user)})
 }
@@ -1,6 +1,11 @@
 package user
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	audit "github.com/myproject/shop/internal/Audit"
+	"gorm.io/gorm"
+)
 
 const (
 	RoleCustomer uint = 1
@@ -8,12 +13,45 @@ const (
 	RoleAdmin    uint = 10
 )
 
+// 账号状态：停用必须有到期时间，封禁可以是永久的；到期后自动恢复为正常
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusBanned    = "banned"
+)
+
 type User struct {
 	gorm.Model
-	Username string `gorm:"size:100;not null;unique"` // 用户名
-	Email    string `gorm:"size:100;not null;unique"` // 邮箱
-	Password string `gorm:"size:255;not null"`        // 密码（哈希值）
-	Role     uint   `gorm:"not null"`                 // 角色（admin, customer）
-	UserImg  string `gorm:"size:500"`                 // 用户头像URL
-	Phone    string `gorm:"size:30"`                  //用户的电话
+	Username string `gorm:"size:100;not null;unique"`   // 用户名
+	Email    string `gorm:"size:100;not null;unique"`   // 邮箱
+	Password string `gorm:"size:255;not null" json:"-"` // 密码（哈希值），不输出到 JSON
+	Role     uint   `gorm:"not null"`                   // 角色（admin, customer）
+	UserImg  string `gorm:"size:500"`                   // 用户头像URL
+	Phone    string `gorm:"size:30"`                    //用户的电话
+
+	LastLoginAt           *time.Time // 最近一次登录时间，为空表示从未登录
+	EmailVerifiedAt       *time.Time // 邮箱验证时间，为空表示未验证；修改邮箱后需要重新验证
+	PasswordResetRequired bool       `gorm:"default:false"` // 必须重置密码后才能登录
+
+	Status       string     `gorm:"size:20;not null;default:active;index"` // 账号状态
+	StatusReason string     `gorm:"size:500"`                              // 停用或封禁的原因
+	StatusUntil  *time.Time // 停用或封禁的到期时间，为空表示永久
+}
+
+// EffectiveStatus 考虑到期时间后的账号状态
+func (u *User) EffectiveStatus(now time.Time) string {
+	if u.Status == "" || u.Status == StatusActive || (u.StatusUntil != nil && !now.Before(*u.StatusUntil)) {
+		return StatusActive
+	}
+	return u.Status
 }
+
+// 管理员操作，与全局审计日志的操作类型一致
+const (
+	AuditSuspend     = audit.ActionSuspend
+	AuditBan         = audit.ActionBan
+	AuditReinstate   = audit.ActionReinstate
+	AuditRoleChange  = audit.ActionRoleChange
+	AuditForceLogout = audit.ActionForceLogout
+	AuditUnlock      = audit.ActionUnlock
+)
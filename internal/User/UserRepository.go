@@ -1,6 +1,11 @@
 package user
 
-import "github.com/myproject/shop/pkg/database"
+import (
+	"time"
+
+	"github.com/myproject/shop/pkg/database"
+	"gorm.io/gorm"
+)
 
 type UserRepository struct {
 	Database *database.Database
@@ -55,3 +60,67 @@ func (r *UserRepository) ListUsers(limit, offset int) ([]User, error) {
 	}
 	return users, nil
 }
+
+// RecordLogin 记录登录时间；newHash 不为空时顺带升级密码哈希
+func (r *UserRepository) RecordLogin(id uint, at time.Time, newHash string) error {
+	updates := map[string]interface{}{"last_login_at": at}
+	if newHash != "" {
+		updates["password"] = newHash
+	}
+	return r.Database.DB.Model(&User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// FlagLegacyPasswordResets 把从未登录、仍是旧格式密码的账号标记为必须重置密码，返回标记的数量
+func (r *UserRepository) FlagLegacyPasswordResets(legacyPrefix string) (int64, error) {
+	res := r.Database.DB.Model(&User{}).
+		Where("last_login_at IS NULL AND starts_with(password, ?) AND NOT password_reset_required", legacyPrefix).
+		Update("password_reset_required", true)
+	return res.RowsAffected, res.Error
+}
+
+func (r *UserRepository) GetUserByEmail(email string) (*User, error) {
+	var u User
+	if err := r.Database.DB.Where("LOWER(email) = LOWER(?)", email).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// MarkEmailVerified 只有邮箱仍是 email 时才标记为已验证，验证期间改过邮箱则返回 false
+func (r *UserRepository) MarkEmailVerified(id uint, email string, at time.Time) (bool, error) {
+	res := r.Database.DB.Model(&User{}).
+		Where("id = ? AND email = ?", id, email).
+		Update("email_verified_at", gorm.Expr("COALESCE(email_verified_at, ?)", at))
+	return res.RowsAffected > 0, res.Error
+}
+
+// ResetPassword 设置新密码并清除必须重置密码的标记；verifiedAt 不为空时顺带把邮箱标记为已验证
+func (r *UserRepository) ResetPassword(id uint, hash string, verifiedAt *time.Time) error {
+	updates := map[string]interface{}{"password": hash, "password_reset_required": false}
+	if verifiedAt != nil {
+		updates["email_verified_at"] = gorm.Expr("COALESCE(email_verified_at, ?)", *verifiedAt)
+	}
+	return r.Database.DB.Model(&User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r *UserRepository) IsEmailVerified(id uint) (bool, error) {
+	var verified bool
+	err := r.Database.DB.Model(&User{}).Select("email_verified_at IS NOT NULL").Where("id = ?", id).Scan(&verified).Error
+	return verified, err
+}
+
+// UsernameTaken 用户名（不区分大小写）是否已被其他用户使用；软删除的用户仍占用唯一索引，一并计入
+func (r *UserRepository) UsernameTaken(username string, excludeID uint) (bool, error) {
+	var n int64
+	err := r.Database.DB.Unscoped().Model(&User{}).
+		Where("LOWER(username) = LOWER(?) AND id <> ?", username, excludeID).Count(&n).Error
+	return n > 0, err
+}
+
+// EmailTaken 邮箱（不区分大小写）是否已被其他用户使用
+func (r *UserRepository) EmailTaken(email string, excludeID uint) (bool, error) {
+	var n int64
+	err := r.Database.DB.Unscoped().Model(&User{}).
+		Where("LOWER(email) = LOWER(?) AND id <> ?", email, excludeID).Count(&n).Error
+	return n > 0, err
+}
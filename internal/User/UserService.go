@@ -1,42 +1,230 @@
 package user
 
 import (
+	"context"
 	"errors"
+	"strings"
 
+	audit "github.com/myproject/shop/internal/Audit"
+	"github.com/myproject/shop/pkg/middleware"
 	"github.com/myproject/shop/pkg/utils"
 )
 
+var (
+	ErrUsernameTaken    = errors.New("username already taken")
+	ErrEmailTaken       = errors.New("email already registered")
+	ErrWrongPassword    = errors.New("current password is incorrect")
+	ErrNoFieldsToUpdate = errors.New("no fields to update")
+)
+
 type UserService struct {
-	Repo *UserRepository
+	Repo  *UserRepository
+	audit *audit.AuditService
+
+	onRegistered   []func(u *User)
+	onEmailChanged []func(u *User)
+	onDeleted      []func(userID uint)
+	revokeSessions func(ctx context.Context, userID uint) error
+	validateRole   func(role uint) (bool, error)
+}
+
+func NewService(repo *UserRepository, auditor *audit.AuditService) *UserService {
+	s := &UserService{Repo: repo, audit: auditor}
+	middleware.InitEmailVerifier(s)
+	return s
+}
+
+// OnRegistered 注册成功后的回调，例如发送验证邮件；回调在注册请求中同步执行，耗时操作应自行异步处理
+func (s *UserService) OnRegistered(fn func(u *User)) {
+	s.onRegistered = append(s.onRegistered, fn)
 }
 
-func NewService(repo *UserRepository) *UserService {
-	return &UserService{Repo: repo}
+// OnEmailChanged 修改邮箱后的回调，新邮箱需要重新验证
+func (s *UserService) OnEmailChanged(fn func(u *User)) {
+	s.onEmailChanged = append(s.onEmailChanged, fn)
+}
+
+// OnDeleted 删除用户后的回调，例如吊销该用户的所有会话
+func (s *UserService) OnDeleted(fn func(userID uint)) {
+	s.onDeleted = append(s.onDeleted, fn)
+}
+
+// IsEmailVerified 实现 middleware.EmailVerifier
+func (s *UserService) IsEmailVerified(ctx context.Context, userID uint) (bool, error) {
+	return s.Repo.IsEmailVerified(userID)
 }
 
 func (s *UserService) RegisterUser(username, email, password string, role uint) (*User, error) {
 	if username == "" || email == "" || password == "" {
 		return nil, errors.New("the input cannot be empty")
 	}
-	// Check if user already exists
-	existingUser, _ := s.Repo.GetUserByName(username)
-	if existingUser != nil {
-		return nil, errors.New("User already exists")
+	if err := s.checkAvailable(0, username, email); err != nil {
+		return nil, err
 	}
 	// 等待检查是否符合 命名 ，密码 ，邮箱的规范
 
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
 	user := &User{
 		Username: username,
 		Email:    email,
-		Password: utils.HashPassword(password),
+		Password: hash,
 		Role:     role,
 	}
 	if err := s.Repo.CreateUser(user); err != nil {
 		return nil, err
 	}
+	for _, fn := range s.onRegistered {
+		fn(user)
+	}
 	return user, nil
 }
 
-func (s *UserService) DeleteUser(id uint) error {
-	return s.Repo.DeleteUserByID(id)
+// checkAvailable 用户名和邮箱（不区分大小写）没有被其他用户占用，空字符串表示不检查
+func (s *UserService) checkAvailable(selfID uint, username, email string) error {
+	if username != "" {
+		taken, err := s.Repo.UsernameTaken(username, selfID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrUsernameTaken
+		}
+	}
+	if email != "" {
+		taken, err := s.Repo.EmailTaken(email, selfID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrEmailTaken
+		}
+	}
+	return nil
+}
+
+// ProfileUpdate 要修改的资料，空字段表示不修改
+type ProfileUpdate struct {
+	Username string
+	Email    string
+	Password string
+	UserImg  string
+	Phone    string
+}
+
+// UpdateProfile 修改用户资料。currentPassword 不为 nil 表示用户修改自己的资料，
+// 修改邮箱或密码时必须提供正确的当前密码；管理员修改时传 nil。
+// 修改邮箱后需要重新验证
+func (s *UserService) UpdateProfile(ctx context.Context, id uint, upd ProfileUpdate, currentPassword *string) (*User, error) {
+	if upd == (ProfileUpdate{}) {
+		return nil, ErrNoFieldsToUpdate
+	}
+	user, err := s.Repo.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	before := *user
+	emailChanged := upd.Email != "" && !strings.EqualFold(upd.Email, user.Email)
+	if currentPassword != nil && (emailChanged || upd.Password != "") {
+		if ok, _ := utils.VerifyPassword(user.Password, *currentPassword); !ok {
+			return nil, ErrWrongPassword
+		}
+	}
+	var newUsername, newEmail string
+	if upd.Username != "" && upd.Username != user.Username {
+		newUsername = upd.Username
+	}
+	if emailChanged {
+		newEmail = upd.Email
+	}
+	if err := s.checkAvailable(id, newUsername, newEmail); err != nil {
+		return nil, err
+	}
+	if newUsername != "" {
+		user.Username = newUsername
+	}
+	if emailChanged {
+		user.Email = newEmail
+		user.EmailVerifiedAt = nil
+	} else if upd.Email != "" {
+		// 只是大小写不同，不需要重新验证
+		user.Email = upd.Email
+	}
+	if upd.Password != "" {
+		hash, err := utils.HashPassword(upd.Password)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = hash
+		user.PasswordResetRequired = false
+	}
+	if upd.UserImg != "" {
+		user.UserImg = upd.UserImg
+	}
+	if upd.Phone != "" {
+		user.Phone = upd.Phone
+	}
+	if err := s.Repo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+	detail := userChanges(&before, user)
+	detail["password_changed"] = upd.Password != ""
+	detail["by_admin"] = currentPassword == nil
+	s.audit.Record(ctx, audit.Entry{
+		Action: audit.ActionUpdate, ResourceType: audit.ResourceUser, ResourceID: audit.ID(id),
+		Before: userAuditView(&before), After: userAuditView(user), Detail: detail,
+	})
+	if emailChanged {
+		for _, fn := range s.onEmailChanged {
+			fn(user)
+		}
+	}
+	return user, nil
+}
+
+// CheckPassword 敏感操作（例如注销账号）前确认当前密码
+func (s *UserService) CheckPassword(id uint, password string) error {
+	user, err := s.Repo.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+	if ok, _ := utils.VerifyPassword(user.Password, password); !ok {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func (s *UserService) DeleteUser(ctx context.Context, id uint) error {
+	before, _ := s.Repo.GetUserByID(id)
+	if err := s.Repo.DeleteUserByID(id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Entry{Action: audit.ActionDelete, ResourceType: audit.ResourceUser, ResourceID: audit.ID(id), Before: userAuditView(before)})
+	for _, fn := range s.onDeleted {
+		fn(id)
+	}
+	return nil
+}
+
+// userAuditView 审计日志中记录的用户字段。审计日志只能追加，注销账号时无法清除，
+// 因此不记录用户名、邮箱、手机号等个人信息
+func userAuditView(u *User) map[string]interface{} {
+	if u == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"role": u.Role,
+	}
+}
+
+// userChanges 只记录哪些个人信息被修改，不记录修改前后的值
+func userChanges(before, after *User) map[string]interface{} {
+	return map[string]interface{}{
+		"username_changed": before.Username != after.Username,
+		"email_changed":    before.Email != after.Email,
+		"phone_changed":    before.Phone != after.Phone,
+		"user_img_changed": before.UserImg != after.UserImg,
+	}
 }
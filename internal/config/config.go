@@ -4,15 +4,28 @@ import (
 	"log"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/myproject/shop/pkg/mailer"
+	"github.com/myproject/shop/pkg/oidc"
+	"github.com/myproject/shop/pkg/storage"
+	"github.com/myproject/shop/pkg/utils"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Trash     TrashConfig     `mapstructure:"trash"`
+	Password  PasswordConfig  `mapstructure:"password"`
+	TwoFactor TwoFactorConfig `mapstructure:"two_factor"`
+	Mail      MailConfig      `mapstructure:"mail"`
+	Login     LoginConfig     `mapstructure:"login"`
+	OIDC      OIDCConfig      `mapstructure:"oidc"`
+	Privacy   PrivacyConfig   `mapstructure:"privacy"`
+	Storage   storage.Config  `mapstructure:"storage"`
 }
 
 type ServerConfig struct {
@@ -35,9 +48,71 @@ type RedisConfig struct {
 	DB       int    `mapstructure:"db"`
 }
 
+// JWTConfig 签名密钥配置，见 utils.JWTKeySpec；轮换时新增密钥并修改 active_key_id，旧密钥设置 expires_at 后保留到过期
 type JWTConfig struct {
-	Secret     string `mapstructure:"secret"`
-	Expiration int    `mapstructure:"expiration"` // 小时为单位
+	Expiration  int                `mapstructure:"expiration"` // 小时为单位
+	ActiveKeyID string             `mapstructure:"active_key_id"`
+	Keys        []utils.JWTKeySpec `mapstructure:"keys"`
+}
+
+// PasswordConfig argon2id 参数，未配置的字段使用默认值；调高后旧哈希在用户下次登录时升级
+type PasswordConfig struct {
+	MemoryKB    uint32 `mapstructure:"memory_kb"`
+	Iterations  uint32 `mapstructure:"iterations"`
+	Parallelism uint8  `mapstructure:"parallelism"`
+}
+
+// TwoFactorConfig TOTP 两步验证：issuer 显示在验证器 App 中，secret_key 为 base64 编码的 32 字节密钥，用于加密保存 TOTP 密钥
+type TwoFactorConfig struct {
+	Issuer    string `mapstructure:"issuer"`
+	SecretKey string `mapstructure:"secret_key"`
+}
+
+// MailConfig 邮件发送配置，见 mailer.Config；verify_url 和 reset_url 为前端验证邮箱和重置密码页面的地址，
+// 邮件中的链接为 {url}?token=...，未配置时邮件中直接给出 token
+type MailConfig struct {
+	mailer.Config `mapstructure:",squash"`
+	VerifyURL     string `mapstructure:"verify_url"`
+	ResetURL      string `mapstructure:"reset_url"`
+}
+
+// LoginConfig 登录失败锁定：同一用户名失败 max_failures 次后锁定 lockout_minutes 分钟，
+// 同一 IP 失败 ip_max_failures 次后封禁一小时；未配置的字段使用默认值（10 次、30 分钟、100 次）
+type LoginConfig struct {
+	MaxFailures    int `mapstructure:"max_failures"`
+	IPMaxFailures  int `mapstructure:"ip_max_failures"`
+	LockoutMinutes int `mapstructure:"lockout_minutes"`
+}
+
+// OIDCConfig 第三方身份登录的提供方，见 oidc.ProviderConfig
+type OIDCConfig struct {
+	Providers []oidc.ProviderConfig `mapstructure:"providers"`
+}
+
+type TrashConfig struct {
+	RetentionDays int `mapstructure:"retention_days"` // 软删除数据的保留天数，超过后永久删除
+}
+
+// Retention 未配置时默认保留 30 天
+func (c *TrashConfig) Retention() time.Duration {
+	days := c.RetentionDays
+	if days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+type PrivacyConfig struct {
+	DeletionCoolingOffDays int `mapstructure:"deletion_cooling_off_days"` // 申请注销账号后等待的天数，期间可以撤销
+}
+
+// DeletionCoolingOff 未配置时默认 14 天
+func (c *PrivacyConfig) DeletionCoolingOff() time.Duration {
+	days := c.DeletionCoolingOffDays
+	if days <= 0 {
+		days = 14
+	}
+	return time.Duration(days) * 24 * time.Hour
 }
 
 func LoadConfig(path string) (config *Config, err error) {
@@ -37,9 +37,16 @@ type productRecord struct {
 	Price       float64
 	Stock       int
 	ProductImg  string
+	Status      string
 	Tsv         string `gorm:"type:tsvector;index:,type:gin;->"`
 }
 
+// publishedStatus 与 shop.ProductStatusPublished 保持一致，顾客只能搜到已上架商品
+const publishedStatus = "published"
+
+// approvedShopStatus 与 shop.ShopStatusApproved 保持一致，待审核或被拒绝店铺的商品不出现在搜索结果中
+const approvedShopStatus = "approved"
+
 func (productRecord) TableName() string {
 	return "products"
 }
@@ -54,6 +61,8 @@ func (s *Service) Search(query, lang string) ([]Result, error) {
 
 	if err := s.db.Model(&productRecord{}).
 		Where("? @@ ?", tsvector, tsquery).
+		Where("status = ?", publishedStatus).
+		Where("EXISTS (SELECT 1 FROM shops WHERE shops.id = products.shop_id AND shops.deleted_at IS NULL AND shops.status = ?)", approvedShopStatus).
 		Order(gorm.Expr("ts_rank(?, ?) DESC", tsvector, tsquery)).
 		Find(&rows).Error; err != nil {
 		return nil, fmt.Errorf("search products: %w", err)
@@ -21,6 +21,9 @@ func GinLogger() gin.HandlerFunc {
 			"user_agent":  c.Request.UserAgent(),
 			"error_count": len(c.Errors),
 		}
+		if id := c.Writer.Header().Get("X-Request-ID"); id != "" {
+			fields["request_id"] = id
+		}
 		if status >= 500 {
 			Error("http_request", fields)
 			return
@@ -0,0 +1,154 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/myproject/shop/pkg/logger"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 发送邮件，具体实现由配置的 driver 决定
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// 邮件发送方式
+const (
+	DriverSMTP = "smtp" // 通过 SMTP 服务器发送
+	DriverFile = "file" // 写成 .eml 文件，便于本地开发时查看
+	DriverLog  = "log"  // 只写日志，未配置 driver 时的默认值
+)
+
+// Config 邮件配置，smtp 需要 host，file 需要 dir
+type Config struct {
+	Driver   string `mapstructure:"driver"`
+	From     string `mapstructure:"from"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Dir      string `mapstructure:"dir"`
+}
+
+// New 按配置创建 Mailer
+func New(cfg Config) (Mailer, error) {
+	from := cfg.From
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	switch cfg.Driver {
+	case DriverSMTP:
+		if cfg.Host == "" {
+			return nil, fmt.Errorf("mail: smtp driver requires host")
+		}
+		port := cfg.Port
+		if port == 0 {
+			port = 587
+		}
+		return &SMTPMailer{
+			addr: net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+			host: cfg.Host,
+			from: from,
+			user: cfg.Username,
+			pass: cfg.Password,
+		}, nil
+	case DriverFile:
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("mail: file driver requires dir")
+		}
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, err
+		}
+		return &FileMailer{dir: cfg.Dir, from: from}, nil
+	case DriverLog, "":
+		return &LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("mail: unknown driver %q", cfg.Driver)
+	}
+}
+
+// SMTPMailer 通过 SMTP 发送，服务器支持时自动使用 STARTTLS
+type SMTPMailer struct {
+	addr string
+	host string
+	from string
+	user string
+	pass string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.user != "" {
+		auth = smtp.PlainAuth("", m.user, m.pass, m.host)
+	}
+	// net/smtp 不支持 context，放到 goroutine 里执行，超时或取消时直接返回
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.addr, auth, m.from, []string{stripCRLF(msg.To)}, buildMessage(m.from, msg))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileMailer 把每封邮件写成 dir 下的一个 .eml 文件
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	name := time.Now().Format("20060102T150405") + "-" + uuid.NewString()[:8] + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), buildMessage(m.from, msg), 0o600)
+}
+
+// LogMailer 只把邮件内容写入日志，邮件中的链接带有一次性 token，不要在生产环境使用
+type LogMailer struct{}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	logger.Info("mail_sent", map[string]interface{}{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	})
+	return nil
+}
+
+// buildMessage 生成 RFC 5322 格式的邮件
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + stripCRLF(msg.To) + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// stripCRLF 防止收件人地址中夹带换行注入额外的邮件头
+func stripCRLF(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
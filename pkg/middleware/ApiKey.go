@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/myproject/shop/pkg/logger"
+)
+
+const (
+	CtxAPIKeyIDKey     = "apiKeyID"
+	CtxAPIKeyShopKey   = "apiKeyShop"
+	CtxAPIKeyScopesKey = "apiKeyScopes"
+
+	ctxAPIKeyPrincipalKey = "apiKeyPrincipal"
+)
+
+// APIKeyPrefix API key 的固定前缀，用来和 JWT 区分
+const APIKeyPrefix = "shk_"
+
+// APIKeyPrincipal API key 代表的调用方：以创建者的身份执行，权限限制在 Scopes 内，只能操作 ShopID
+type APIKeyPrincipal struct {
+	KeyID     uint
+	ShopID    uint
+	UserID    uint
+	Role      uint
+	Scopes    []string
+	RateLimit int // 每分钟请求数
+}
+
+// APIKeyAuthenticator 校验 API key，由店铺模块实现并在启动时注册；key 无效时返回 nil, nil
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*APIKeyPrincipal, error)
+}
+
+var apiKeys APIKeyAuthenticator
+
+func InitAPIKeys(authenticator APIKeyAuthenticator) {
+	apiKeys = authenticator
+}
+
+// AuthMiddleware 接受 JWT 或 API key（X-API-Key 头，或 Authorization: Bearer shk_...）。
+// API key 默认拒绝：只有通过 RequirePermission 的 scope 校验后才设置创建者的用户和角色上下文，
+// 没有 RequirePermission 的路由拿不到用户身份，因此只能挂在商家商品和库存等声明了权限的路由上
+func AuthMiddleware() gin.HandlerFunc {
+	jwtAuth := JWTAuthMiddleware()
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if key == "" {
+			if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && strings.HasPrefix(bearer, APIKeyPrefix) {
+				key = bearer
+			}
+		}
+		if key == "" {
+			jwtAuth(c)
+			return
+		}
+		apiKeyAuth(c, key)
+	}
+}
+
+func apiKeyAuth(c *gin.Context, key string) {
+	if apiKeys == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API keys are not supported"})
+		return
+	}
+	principal, err := apiKeys.AuthenticateAPIKey(c.Request.Context(), key)
+	if err != nil {
+		logger.Error("api_key_auth_failed", map[string]interface{}{"error": err.Error()})
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to authenticate API key"})
+		return
+	}
+	if principal == nil {
+		logger.Warn("invalid_api_key", map[string]interface{}{"path": c.Request.URL.Path, "ip": c.ClientIP()})
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+	if abortIfBlocked(c, principal.UserID) {
+		return
+	}
+	allowed, remaining, retryAfter := allowAPIKeyRequest(c.Request.Context(), principal)
+	c.Header("X-RateLimit-Limit", strconv.Itoa(principal.RateLimit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "API key rate limit exceeded"})
+		return
+	}
+	c.Set(ctxAPIKeyPrincipalKey, principal)
+	c.Set(CtxAPIKeyIDKey, principal.KeyID)
+	c.Set(CtxAPIKeyShopKey, principal.ShopID)
+	c.Set(CtxAPIKeyScopesKey, principal.Scopes)
+	c.Next()
+}
+
+// allowAPIKeyRequest 按分钟固定窗口限流，多个实例共享 Redis 计数；Redis 不可用时放行
+func allowAPIKeyRequest(ctx context.Context, p *APIKeyPrincipal) (allowed bool, remaining, retryAfter int) {
+	if RedisClient == nil || p.RateLimit <= 0 {
+		return true, p.RateLimit, 0
+	}
+	now := time.Now()
+	window := now.Unix() / 60
+	key := "apikey_rl:" + strconv.FormatUint(uint64(p.KeyID), 10) + ":" + strconv.FormatInt(window, 10)
+	n, err := RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		logger.Error("api_key_rate_limit_failed", map[string]interface{}{"key_id": p.KeyID, "error": err.Error()})
+		return true, p.RateLimit, 0
+	}
+	if n == 1 {
+		RedisClient.Expire(ctx, key, 2*time.Minute)
+	}
+	if n > int64(p.RateLimit) {
+		return false, 0, int((window+1)*60 - now.Unix())
+	}
+	return true, p.RateLimit - int(n), 0
+}
+
+// apiKeyPrincipal 使用 API key 访问时返回 key 代表的调用方
+func apiKeyPrincipal(c *gin.Context) (*APIKeyPrincipal, bool) {
+	v, ok := c.Get(ctxAPIKeyPrincipalKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(*APIKeyPrincipal)
+	return p, ok
+}
+
+// APIKeyShop 使用 API key 访问时返回 key 所属的店铺
+func APIKeyShop(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(CtxAPIKeyShopKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(uint)
+	return id, ok
+}
+
+// apiKeyAllows 使用 API key 访问时，perm 必须在 key 的 scopes 中
+func apiKeyAllows(c *gin.Context, perm string) bool {
+	v, ok := c.Get(CtxAPIKeyScopesKey)
+	if !ok {
+		return true
+	}
+	scopes, _ := v.([]string)
+	for _, s := range scopes {
+		if s == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 邮件 token（邮箱验证、重置密码）的单次使用状态：
+//
+//	email_token:{purpose}:{uid}            最近一次签发的 token 的 jti，重新发送会让之前的 token 失效
+//	email_token:{purpose}:{uid}:cooldown   发送冷却，防止被用来刷邮件
+func emailTokenKey(purpose string, userID uint) string {
+	return "email_token:" + purpose + ":" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// consumeScript 只有 jti 与当前保存的一致时才删除，保证每个 token 只能成功使用一次
+var consumeScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// SaveEmailToken 记录最新签发的 token
+func (r *RedisStore) SaveEmailToken(ctx context.Context, purpose string, userID uint, jti string, expiration time.Duration) error {
+	return r.Client.Set(ctx, emailTokenKey(purpose, userID), jti, expiration).Err()
+}
+
+// ConsumeEmailToken 使用 token，token 已被使用、已被新 token 取代或已过期时返回 false
+func (r *RedisStore) ConsumeEmailToken(ctx context.Context, purpose string, userID uint, jti string) (bool, error) {
+	n, err := consumeScript.Run(ctx, r.Client, []string{emailTokenKey(purpose, userID)}, jti).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// DeleteEmailToken 作废尚未使用的 token
+func (r *RedisStore) DeleteEmailToken(ctx context.Context, purpose string, userID uint) error {
+	return r.Client.Del(ctx, emailTokenKey(purpose, userID)).Err()
+}
+
+// AllowEmailSend 冷却期内返回 false
+func (r *RedisStore) AllowEmailSend(ctx context.Context, purpose string, userID uint, cooldown time.Duration) (bool, error) {
+	return r.Client.SetNX(ctx, emailTokenKey(purpose, userID)+":cooldown", 1, cooldown).Result()
+}
@@ -3,7 +3,6 @@ package middleware
 import (
 	"context"
 	"encoding/json"
-	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -23,12 +22,12 @@ func NewRedisStore(addr, password string, db int) *RedisStore {
 }
 
 func (r *RedisStore) SaveJwtRefreshToken(ctx context.Context, jti, token string, userID uint, expiration time.Duration) error {
-	key := "refresh_token:" + strconv.FormatUint(uint64(userID), 10) + ":" + jti
+	key := refreshTokenKey(userID, jti)
 	return r.Client.Set(ctx, key, token, expiration).Err()
 }
 
 func (r *RedisStore) IsJwtRefreshTokenExists(ctx context.Context, jti string, userID uint) (bool, error) {
-	key := "refresh_token:" + strconv.FormatUint(uint64(userID), 10) + ":" + jti
+	key := refreshTokenKey(userID, jti)
 	result, err := r.Client.Exists(ctx, key).Result()
 	if err == redis.Nil {
 		return false, nil
@@ -40,7 +39,7 @@ func (r *RedisStore) IsJwtRefreshTokenExists(ctx context.Context, jti string, us
 }
 
 func (r *RedisStore) DeleteJwtRefreshToken(ctx context.Context, jti string, userID uint) error {
-	key := "refresh_token:" + strconv.FormatUint(uint64(userID), 10) + ":" + jti
+	key := refreshTokenKey(userID, jti)
 	return r.Client.Del(ctx, key).Err()
 }
 
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// refresh token 族：一次登录签发的 refresh token 及其轮换出的后续 token 属于同一个族，
+// 一个族就是用户的一个登录会话。
+//
+//	refresh_token:{uid}:{jti}   当前有效的 refresh token，值为所属族的ID
+//	refresh_family:{fam}        族信息（user_id、当前 refresh/access jti、设备、IP、创建和最近使用时间）
+//	refresh_family:{fam}:used   已被轮换掉的 refresh jti，再次出现即视为被盗用
+//	bl:family:{fam}             已吊销的族，该族签发的所有 access token 立即失效
+//	sessions:{uid}              用户的族ID集合，列出会话时不必扫描 keyspace；族过期后成员在列出时清理
+func refreshTokenKey(userID uint, jti string) string {
+	return "refresh_token:" + strconv.FormatUint(uint64(userID), 10) + ":" + jti
+}
+
+func refreshFamilyKey(family string) string {
+	return "refresh_family:" + family
+}
+
+func familyBlacklistKey(family string) string {
+	return "bl:family:" + family
+}
+
+func userSessionsKey(userID uint) string {
+	return "sessions:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// RefreshFamily 一个 refresh token 族的当前状态
+type RefreshFamily struct {
+	ID         string
+	UserID     uint
+	RefreshJTI string
+	AccessJTI  string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// 轮换结果
+const (
+	RotateOK      = 1
+	RotateUnknown = 0  // 族不存在或 token 已失效
+	RotateReused  = -1 // 已轮换过的 token 被再次使用
+)
+
+// rotateScript 原子地校验旧 refresh token 是族内当前 token 并换成新 token，
+// 同一个 token 并发刷新时只有一个请求能成功
+var rotateScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'current')
+if current == ARGV[1] and redis.call('EXISTS', KEYS[3]) == 1 then
+	redis.call('DEL', KEYS[3])
+	redis.call('SADD', KEYS[2], ARGV[1])
+	redis.call('SET', KEYS[4], ARGV[4], 'EX', ARGV[5])
+	redis.call('HSET', KEYS[1], 'current', ARGV[2], 'access', ARGV[3], 'last_used_at', ARGV[6])
+	if ARGV[7] ~= '' then
+		redis.call('HSET', KEYS[1], 'ip', ARGV[7])
+	end
+	redis.call('EXPIRE', KEYS[1], ARGV[5])
+	redis.call('EXPIRE', KEYS[2], ARGV[5])
+	redis.call('SADD', KEYS[5], ARGV[4])
+	redis.call('EXPIRE', KEYS[5], ARGV[5])
+	return 1
+end
+if redis.call('SISMEMBER', KEYS[2], ARGV[1]) == 1 then
+	return -1
+end
+return 0
+`)
+
+// SaveRefreshFamily 登录时创建新的族并保存第一个 refresh token
+func (r *RedisStore) SaveRefreshFamily(ctx context.Context, fam RefreshFamily, expiration time.Duration) error {
+	key := refreshFamilyKey(fam.ID)
+	now := time.Now().Unix()
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, refreshTokenKey(fam.UserID, fam.RefreshJTI), fam.ID, expiration)
+		pipe.HSet(ctx, key,
+			"user_id", fam.UserID,
+			"current", fam.RefreshJTI,
+			"access", fam.AccessJTI,
+			"user_agent", fam.UserAgent,
+			"ip", fam.IP,
+			"created_at", now,
+			"last_used_at", now,
+		)
+		pipe.Expire(ctx, key, expiration)
+		pipe.SAdd(ctx, userSessionsKey(fam.UserID), fam.ID)
+		pipe.Expire(ctx, userSessionsKey(fam.UserID), expiration)
+		return nil
+	})
+	return err
+}
+
+// RotateRefreshFamily 用 next 替换族内的 oldJTI，并记录最近使用时间和 IP；
+// 返回 RotateOK、RotateUnknown 或 RotateReused
+func (r *RedisStore) RotateRefreshFamily(ctx context.Context, oldJTI string, next RefreshFamily, expiration time.Duration) (int, error) {
+	key := refreshFamilyKey(next.ID)
+	keys := []string{key, key + ":used", refreshTokenKey(next.UserID, oldJTI), refreshTokenKey(next.UserID, next.RefreshJTI), userSessionsKey(next.UserID)}
+	return rotateScript.Run(ctx, r.Client, keys,
+		oldJTI, next.RefreshJTI, next.AccessJTI, next.ID, int64(expiration/time.Second), time.Now().Unix(), next.IP,
+	).Int()
+}
+
+// GetRefreshFamily 族不存在时返回 nil
+func (r *RedisStore) GetRefreshFamily(ctx context.Context, family string) (*RefreshFamily, error) {
+	fields, err := r.Client.HGetAll(ctx, refreshFamilyKey(family)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return parseRefreshFamily(family, fields), nil
+}
+
+// ListRefreshFamilies 通过 sessions:{uid} 找出用户所有仍然有效的族，顺便清理已过期的成员
+func (r *RedisStore) ListRefreshFamilies(ctx context.Context, userID uint) ([]RefreshFamily, error) {
+	setKey := userSessionsKey(userID)
+	ids, err := r.Client.SMembers(ctx, setKey).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	cmds := make(map[string]*redis.MapStringStringCmd, len(ids))
+	_, err = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			cmds[id] = pipe.HGetAll(ctx, refreshFamilyKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	families := make([]RefreshFamily, 0, len(cmds))
+	var stale []interface{}
+	for id, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			stale = append(stale, id)
+			continue
+		}
+		fam := parseRefreshFamily(id, fields)
+		if fam.UserID != userID {
+			stale = append(stale, id)
+			continue
+		}
+		families = append(families, *fam)
+	}
+	if len(stale) > 0 {
+		_ = r.Client.SRem(ctx, setKey, stale...).Err()
+	}
+	return families, nil
+}
+
+// RevokeRefreshFamily 删除整个族并把它加入黑名单，返回被吊销前的状态；族不存在时返回 nil。
+// 黑名单保留 ttl，应不短于该族签发的任何 token 的有效期
+func (r *RedisStore) RevokeRefreshFamily(ctx context.Context, family string, ttl time.Duration) (*RefreshFamily, error) {
+	fam, err := r.GetRefreshFamily(ctx, family)
+	if err != nil || fam == nil {
+		return nil, err
+	}
+	key := refreshFamilyKey(family)
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, refreshTokenKey(fam.UserID, fam.RefreshJTI), key, key+":used")
+		pipe.SRem(ctx, userSessionsKey(fam.UserID), family)
+		pipe.Set(ctx, familyBlacklistKey(family), "revoked", ttl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fam, nil
+}
+
+// DeleteUserRefreshTokens 删除用户所有的 refresh token，包括没有族信息的旧 token。
+// 旧 token 不在 sessions:{uid} 中，只能扫描 keyspace；只在退出所有设备等少数场景调用
+func (r *RedisStore) DeleteUserRefreshTokens(ctx context.Context, userID uint) error {
+	keys, err := r.scanRefreshTokenKeys(ctx, userID)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	return r.Client.Del(ctx, keys...).Err()
+}
+
+func (r *RedisStore) scanRefreshTokenKeys(ctx context.Context, userID uint) ([]string, error) {
+	var keys []string
+	iter := r.Client.Scan(ctx, 0, refreshTokenKey(userID, "*"), 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+func parseRefreshFamily(id string, fields map[string]string) *RefreshFamily {
+	unix := func(field string) time.Time {
+		n, _ := strconv.ParseInt(fields[field], 10, 64)
+		return time.Unix(n, 0)
+	}
+	userID, _ := strconv.ParseUint(fields["user_id"], 10, 64)
+	return &RefreshFamily{
+		ID:         id,
+		UserID:     uint(userID),
+		RefreshJTI: fields["current"],
+		AccessJTI:  fields["access"],
+		UserAgent:  fields["user_agent"],
+		IP:         fields["ip"],
+		CreatedAt:  unix("created_at"),
+		LastUsedAt: unix("last_used_at"),
+	}
+}
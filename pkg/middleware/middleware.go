@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	user "github.com/myproject/shop/internal/User"
 	"github.com/myproject/shop/pkg/logger"
 	"github.com/myproject/shop/pkg/utils"
 	redis "github.com/redis/go-redis/v9"
@@ -19,15 +18,27 @@ const (
 	CtxUserIDKey   = "userID"
 	CtxUserRoleKey = "userRole"
 	CtxTokenJTIKey = "tokenJTI"
+	CtxTokenFamKey = "tokenFamily" // access token 所属的 refresh token 族，旧 token 没有
 )
 
 var (
-	JWTSecret   []byte
 	RedisClient *redis.Client // 在应用启动时初始化
 )
 
-func InitJWT(secret string) {
-	JWTSecret = []byte(secret)
+// InitJWT 加载 JWT 签名密钥；没有配置密钥时使用临时生成的密钥，仅适合本地开发
+func InitJWT(activeKeyID string, keys []utils.JWTKeySpec) error {
+	if len(keys) == 0 {
+		kid, err := utils.UseEphemeralSigningKey()
+		if err != nil {
+			return err
+		}
+		logger.Warn("jwt_ephemeral_key", map[string]interface{}{
+			"kid":    kid,
+			"reason": "no jwt keys configured, tokens will not survive a restart",
+		})
+		return nil
+	}
+	return utils.LoadSigningKeys(activeKeyID, keys)
 }
 
 func InitRedis(client *redis.Client) {
@@ -57,6 +68,11 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
+		// 只有 access token 不带 type 声明；refresh token、邮件 token 等不能当作 access token 使用
+		if _, ok := claims["type"]; ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token type"})
+			return
+		}
 		//超时检验
 		if expVal, ok := claims["exp"]; ok {
 			switch exp := expVal.(type) {
@@ -139,32 +155,115 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid role claim in token"})
 			return
 		}
-		// 检查黑名单
+		// 检查黑名单：token 本身或它所属的会话（refresh token 族）被吊销都会拒绝
+		fam, _ := claims["fam"].(string)
 		if RedisClient != nil {
 			ctx := context.Background()
-			if exists, _ := RedisClient.Get(ctx, "bl:access:"+jti).Result(); exists != "" {
+			keys := []string{"bl:access:" + jti}
+			if fam != "" {
+				keys = append(keys, familyBlacklistKey(fam))
+			}
+			if n, _ := RedisClient.Exists(ctx, keys...).Result(); n > 0 {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
 				return
 			}
 		}
+		if abortIfBlocked(c, userID) {
+			return
+		}
 
 		c.Set(CtxUserIDKey, userID)
 		c.Set(CtxUserRoleKey, role)
 		c.Set(CtxTokenJTIKey, jti)
+		if fam != "" {
+			c.Set(CtxTokenFamKey, fam)
+		}
 		c.Next()
 	}
 }
 
-func MerchantAuthMiddleware() gin.HandlerFunc {
+// PermissionChecker 判断用户是否拥有某个权限，由 RBAC 模块实现并在启动时注册
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, userID, role uint, perm string) (bool, error)
+}
+
+var permissions PermissionChecker
+
+func InitPermissions(checker PermissionChecker) {
+	permissions = checker
+}
+
+// HasPermission 当前登录用户是否拥有 perm，需要在 JWTAuthMiddleware 或 AuthMiddleware 之后调用；
+// 使用 API key 时还要求 perm 在 key 的 scopes 中
+func HasPermission(c *gin.Context, perm string) bool {
+	if permissions == nil || !apiKeyAllows(c, perm) {
+		return false
+	}
+	var uid, r uint
+	if p, ok := apiKeyPrincipal(c); ok {
+		uid, r = p.UserID, p.Role
+	} else {
+		userID, _ := c.Get(CtxUserIDKey)
+		role, _ := c.Get(CtxUserRoleKey)
+		var ok1, ok2 bool
+		uid, ok1 = userID.(uint)
+		r, ok2 = role.(uint)
+		if !ok1 || !ok2 {
+			return false
+		}
+	}
+	ok, err := permissions.HasPermission(c.Request.Context(), uid, r, perm)
+	if err != nil {
+		logger.Error("permission_check_failed", map[string]interface{}{"user_id": uid, "permission": perm, "error": err.Error()})
+		return false
+	}
+	return ok
+}
+
+// RequirePermission 要求当前用户拥有 perm。店铺员工只要在任一店铺拥有该权限即可通过，
+// 具体能否操作某个店铺由各 handler 校验。API key 通过校验后才以创建者的身份继续处理请求
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !HasPermission(ctx, perm) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied: " + perm + " is required"})
+			return
+		}
+		if p, ok := apiKeyPrincipal(ctx); ok {
+			ctx.Set(CtxUserIDKey, p.UserID)
+			ctx.Set(CtxUserRoleKey, p.Role)
+		}
+		ctx.Next()
+	}
+}
+
+// EmailVerifier 判断用户邮箱是否已验证，由用户模块实现并在启动时注册
+type EmailVerifier interface {
+	IsEmailVerified(ctx context.Context, userID uint) (bool, error)
+}
+
+var emailVerifier EmailVerifier
+
+func InitEmailVerifier(verifier EmailVerifier) {
+	emailVerifier = verifier
+}
+
+// RequireVerifiedEmail 要求当前用户已验证邮箱，需要在 JWTAuthMiddleware 之后使用
+func RequireVerifiedEmail() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		roleVal, exists := ctx.Get(CtxUserRoleKey)
-		if !exists {
-			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied: Role not found"})
+		userID, _ := ctx.Get(CtxUserIDKey)
+		uid, ok := userID.(uint)
+		if !ok || emailVerifier == nil {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Email verification is required"})
+			return
+		}
+		verified, err := emailVerifier.IsEmailVerified(ctx.Request.Context(), uid)
+		if err != nil {
+			logger.Error("email_verification_check_failed", map[string]interface{}{"user_id": uid, "error": err.Error()})
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check email verification"})
 			return
 		}
-		role, ok := roleVal.(uint)
-		if !ok || (role != user.RoleMerchant && role != user.RoleAdmin) {
-			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied: Only merchants and admins can perform this action"})
+		if !verified {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Email verification is required"})
 			return
 		}
 		ctx.Next()
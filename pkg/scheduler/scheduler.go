@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/myproject/shop/pkg/logger"
+)
+
+// Job 是一个按固定间隔执行的后台任务
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+type Jobs []Job
+
+// Start 为每个任务启动独立的 goroutine，ctx 取消后全部退出
+func Start(ctx context.Context, jobs Jobs) {
+	for _, job := range jobs {
+		if job.Run == nil || job.Interval <= 0 {
+			continue
+		}
+		go loop(ctx, job)
+	}
+}
+
+func loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runOnce(ctx, job)
+		}
+	}
+}
+
+// runOnce 执行一次任务，panic 和错误都只记录日志，不影响下一轮
+func runOnce(ctx context.Context, job Job) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("job_panic", map[string]interface{}{
+				"job":   job.Name,
+				"panic": r,
+			})
+		}
+	}()
+	if err := job.Run(ctx); err != nil {
+		logger.Error("job_failed", map[string]interface{}{
+			"job":        job.Name,
+			"error":      err.Error(),
+			"latency_ms": time.Since(start).Milliseconds(),
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -10,48 +11,54 @@ import (
 var (
 	AcessTTL   = time.Minute * 15
 	RefreshTTL = time.Hour * 24 * 7
-	JWTSecret  = []byte("replace-with-env-secret")
 )
 
-func GenerateTokens(userID uint, role uint) (string, string, string, error) {
+// TokenPair 一次签发的 access token 和 refresh token
+type TokenPair struct {
+	Access     string
+	Refresh    string
+	AccessJTI  string
+	RefreshJTI string
+	Family     string
+}
+
+// GenerateTokens 签发一对 token。family 为 refresh token 所属的族（一次登录会话），
+// 为空时新建一个族；两种 token 都带 fam 声明，注销时据此吊销整个会话
+func GenerateTokens(userID uint, role uint, family string) (*TokenPair, error) {
+	if family == "" {
+		family = uuid.NewString()
+	}
 	now := time.Now()
-	accessJTI := uuid.NewString()
+	pair := &TokenPair{AccessJTI: uuid.NewString(), RefreshJTI: uuid.NewString(), Family: family}
 	accessClaims := jwt.MapClaims{
 		"sub":  userID,
 		"role": role,
 		"exp":  now.Add(AcessTTL).Unix(),
 		"iat":  now.Unix(),
-		"jti":  accessJTI,
+		"jti":  pair.AccessJTI,
+		"fam":  family,
 	}
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	acessStr, err := at.SignedString(JWTSecret)
-	if err != nil {
-		return "", "", "", err
+	var err error
+	if pair.Access, err = signToken(accessClaims); err != nil {
+		return nil, err
 	}
-	refreshJTI := uuid.NewString()
 	refreshClaims := jwt.MapClaims{
 		"sub":  userID,
 		"role": role,
 		"exp":  now.Add(RefreshTTL).Unix(),
 		"iat":  now.Unix(),
-		"jti":  refreshJTI,
+		"jti":  pair.RefreshJTI,
+		"fam":  family,
 		"type": "refresh",
 	}
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshStr, err := rt.SignedString(JWTSecret)
-	if err != nil {
-		return "", "", "", err
+	if pair.Refresh, err = signToken(refreshClaims); err != nil {
+		return nil, err
 	}
-	return acessStr, refreshStr, accessJTI, nil
+	return pair, nil
 }
 
 func ParseToken(tokenStr string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return JWTSecret, nil
-	})
+	token, err := jwt.Parse(tokenStr, tokenKeyFunc)
 	if err != nil || token == nil || !token.Valid {
 		return nil, err
 	}
@@ -62,6 +69,39 @@ func ParseToken(tokenStr string) (jwt.MapClaims, error) {
 	return claims, nil
 }
 
-func HashPassword(password string) string {
-	return "hashed_" + password
+var ErrInvalidEmailToken = errors.New("invalid or expired token")
+
+// GenerateEmailToken 签发邮件中使用的一次性 token（邮箱验证、重置密码），purpose 写入 type 声明，
+// email 绑定签发时的邮箱，邮箱变更后旧 token 自然失效。
+// 不带 role 声明，JWTAuthMiddleware 不会把它当作 access token；单次使用由调用方在 Redis 中保证
+func GenerateEmailToken(userID uint, purpose, email string, ttl time.Duration) (token, jti string, err error) {
+	now := time.Now()
+	jti = uuid.NewString()
+	token, err = signToken(jwt.MapClaims{
+		"sub":   userID,
+		"email": email,
+		"exp":   now.Add(ttl).Unix(),
+		"iat":   now.Unix(),
+		"jti":   jti,
+		"type":  purpose,
+	})
+	return token, jti, err
+}
+
+// ParseEmailToken 校验签名、有效期和用途，返回用户ID、签发时的邮箱和 jti
+func ParseEmailToken(token, purpose string) (userID uint, email, jti string, err error) {
+	claims, err := ParseToken(token)
+	if err != nil || claims == nil {
+		return 0, "", "", ErrInvalidEmailToken
+	}
+	if typ, _ := claims["type"].(string); typ != purpose {
+		return 0, "", "", ErrInvalidEmailToken
+	}
+	sub, ok := claims["sub"].(float64)
+	email, _ = claims["email"].(string)
+	jti, _ = claims["jti"].(string)
+	if !ok || email == "" || jti == "" {
+		return 0, "", "", ErrInvalidEmailToken
+	}
+	return uint(sub), email, jti, nil
 }
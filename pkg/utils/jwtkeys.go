@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// JWTKeySpec 一把签名密钥的配置。私钥和公钥都可以是 PEM 文件路径或内联 PEM：
+// 有私钥的密钥可以签名，只有公钥的密钥只用于校验。
+// 轮换时把新密钥设为 active_key_id，旧密钥保留在列表中并设置 expires_at
+// （不早于轮换时间 + refresh token 有效期），到期后自动不再被接受，也不再出现在 JWKS 中
+type JWTKeySpec struct {
+	ID             string `mapstructure:"id"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PrivateKey     string `mapstructure:"private_key"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+	PublicKey      string `mapstructure:"public_key"`
+	ExpiresAt      string `mapstructure:"expires_at"` // RFC 3339
+}
+
+// signingKey 解析后的密钥
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	private   crypto.Signer // 只用于校验时为 nil
+	public    crypto.PublicKey
+	expiresAt time.Time // 零值表示不过期
+}
+
+func (k *signingKey) expired(now time.Time) bool {
+	return !k.expiresAt.IsZero() && now.After(k.expiresAt)
+}
+
+type keySet struct {
+	mu     sync.RWMutex
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+var jwtKeys = &keySet{keys: make(map[string]*signingKey)}
+
+var (
+	ErrNoSigningKey = errors.New("no active jwt signing key")
+	ErrUnknownKeyID = errors.New("unknown jwt key id")
+)
+
+// LoadSigningKeys 加载密钥并替换当前密钥集，activeID 指定签名用的密钥，必须带私钥
+func LoadSigningKeys(activeID string, specs []JWTKeySpec) error {
+	keys := make(map[string]*signingKey, len(specs))
+	for _, spec := range specs {
+		k, err := parseKeySpec(spec)
+		if err != nil {
+			return fmt.Errorf("jwt key %q: %w", spec.ID, err)
+		}
+		if _, dup := keys[k.id]; dup {
+			return fmt.Errorf("duplicate jwt key id %q", k.id)
+		}
+		keys[k.id] = k
+	}
+	active, ok := keys[activeID]
+	if !ok || active.private == nil {
+		return fmt.Errorf("active jwt key %q not found or has no private key", activeID)
+	}
+	if active.expired(time.Now()) {
+		return fmt.Errorf("active jwt key %q has expired", activeID)
+	}
+	jwtKeys.mu.Lock()
+	jwtKeys.active, jwtKeys.keys = active, keys
+	jwtKeys.mu.Unlock()
+	return nil
+}
+
+// UseEphemeralSigningKey 生成仅存在于内存中的 Ed25519 密钥，用于本地开发；重启后之前签发的 token 全部失效
+func UseEphemeralSigningKey() (string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	k := &signingKey{method: jwt.SigningMethodEdDSA, private: priv, public: pub}
+	if k.id, err = keyThumbprint(pub); err != nil {
+		return "", err
+	}
+	jwtKeys.mu.Lock()
+	jwtKeys.active, jwtKeys.keys = k, map[string]*signingKey{k.id: k}
+	jwtKeys.mu.Unlock()
+	return k.id, nil
+}
+
+func activeSigningKey() (*signingKey, error) {
+	jwtKeys.mu.RLock()
+	defer jwtKeys.mu.RUnlock()
+	if jwtKeys.active == nil {
+		return nil, ErrNoSigningKey
+	}
+	return jwtKeys.active, nil
+}
+
+func verificationKey(kid string) (*signingKey, error) {
+	jwtKeys.mu.RLock()
+	k, ok := jwtKeys.keys[kid]
+	jwtKeys.mu.RUnlock()
+	if !ok || k.expired(time.Now()) {
+		return nil, ErrUnknownKeyID
+	}
+	return k, nil
+}
+
+// signToken 用当前密钥签名并在 header 中写入 kid
+func signToken(claims jwt.MapClaims) (string, error) {
+	k, err := activeSigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.private)
+}
+
+// tokenKeyFunc 按 kid 找到公钥，并要求 token 的算法与该密钥一致，防止算法混淆
+func tokenKeyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	k, err := verificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return k.public, nil
+}
+
+// JWK 单个公钥的 JSON Web Key 表示
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS 返回所有仍然有效的公钥，供其他服务校验 token
+func JWKS() []JWK {
+	jwtKeys.mu.RLock()
+	defer jwtKeys.mu.RUnlock()
+	now := time.Now()
+	keys := make([]JWK, 0, len(jwtKeys.keys))
+	for _, k := range jwtKeys.keys {
+		if k.expired(now) {
+			continue
+		}
+		jwk := JWK{Kid: k.id, Alg: k.method.Alg(), Use: "sig"}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		keys = append(keys, jwk)
+	}
+	return keys
+}
+
+func parseKeySpec(spec JWTKeySpec) (*signingKey, error) {
+	k := &signingKey{id: spec.ID}
+	if spec.ExpiresAt != "" {
+		var err error
+		if k.expiresAt, err = time.Parse(time.RFC3339, spec.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("invalid expires_at: %w", err)
+		}
+	}
+	privPEM, err := readPEM(spec.PrivateKeyFile, spec.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if privPEM != nil {
+		if k.private, err = parsePrivateKey(privPEM); err != nil {
+			return nil, err
+		}
+		k.public = k.private.Public()
+	} else {
+		pubPEM, err := readPEM(spec.PublicKeyFile, spec.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if pubPEM == nil {
+			return nil, errors.New("either a private or a public key is required")
+		}
+		if k.public, err = x509.ParsePKIXPublicKey(pubPEM.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("rsa key must be at least 2048 bits")
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", pub)
+	}
+	if k.id == "" {
+		if k.id, err = keyThumbprint(k.public); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// readPEM 优先读取文件，其次使用内联内容，都为空时返回 nil
+func readPEM(file, inline string) (*pem.Block, error) {
+	data := []byte(inline)
+	if file != "" {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// keyThumbprint 未配置 kid 时用公钥摘要作为 kid
+func keyThumbprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
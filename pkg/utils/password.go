@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// PasswordParams argon2id 的参数，调整后旧哈希在下次登录时自动升级
+type PasswordParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// LegacyPasswordPrefix 早期版本把密码存成 "hashed_" + 明文
+const LegacyPasswordPrefix = "hashed_"
+
+var (
+	PasswordHashParams = PasswordParams{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+
+	ErrInvalidPasswordHash = errors.New("invalid password hash")
+)
+
+// SetPasswordParams 用配置覆盖默认参数，零值字段保持默认
+func SetPasswordParams(memory, iterations uint32, parallelism uint8) {
+	if memory > 0 {
+		PasswordHashParams.Memory = memory
+	}
+	if iterations > 0 {
+		PasswordHashParams.Iterations = iterations
+	}
+	if parallelism > 0 {
+		PasswordHashParams.Parallelism = parallelism
+	}
+}
+
+// HashPassword 使用 argon2id 和随机盐计算密码哈希，输出 PHC 格式：
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	p := PasswordHashParams
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword 以常量时间比较密码和哈希；needsRehash 表示哈希是旧格式或参数已过时，应在登录成功后重新计算
+func VerifyPassword(hash, password string) (ok bool, needsRehash bool) {
+	if strings.HasPrefix(hash, LegacyPasswordPrefix) {
+		ok = subtle.ConstantTimeCompare([]byte(hash), []byte(LegacyPasswordPrefix+password)) == 1
+		return ok, true
+	}
+	p, salt, key, err := decodePasswordHash(hash)
+	if err != nil {
+		return false, false
+	}
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false
+	}
+	current := PasswordHashParams
+	needsRehash = p.Memory != current.Memory || p.Iterations != current.Iterations ||
+		p.Parallelism != current.Parallelism || uint32(len(key)) != current.KeyLength || uint32(len(salt)) != current.SaltLength
+	return true, needsRehash
+}
+
+func decodePasswordHash(hash string) (PasswordParams, []byte, []byte, error) {
+	var p PasswordParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}